@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const helpText = `Commands:
+  auth [json]             authenticate, e.g. auth {"token":"..."}
+  leaderboard [json]      show the standings, e.g. leaderboard {"limit":10}
+  room:list               list the rooms on the server
+  room:join [json]        join a room, e.g. room:join {"room":"room-1"}, or any open room if omitted
+  room:create [json]      create and join a room, e.g. room:create {"name":"foo"}
+  room:leave              leave the current room
+  matchmake [json]        wait for an opponent, e.g. matchmake {"rating":1500}
+  matchmake:cancel        leave the matchmaking queue
+  join                    join the game
+  subscribe               subscribe to the game as spectator
+  setup <json>            send ship placements, e.g. setup [{"ID":1,"Coordinate":[0,0],"Direction":0}]
+  shot <x> <y>            fire a shot at (x, y)
+  admin:auth [json]       authenticate as administrator, e.g. admin:auth {"token":"..."}
+  admin:sessions          list the sessions and their rooms (admin)
+  admin:games             list the rooms and whether they are paused (admin)
+  admin:inspect [json]    show the full state of a game, e.g. admin:inspect {"room":"room-1"} (admin)
+  admin:kick [json]       disconnect a session, e.g. admin:kick {"session":"..."} (admin)
+  admin:pause [json]      pause a game, e.g. admin:pause {"room":"room-1"} (admin)
+  admin:resume [json]     resume a paused game, e.g. admin:resume {"room":"room-1"} (admin)
+  admin:end [json]        end a game with a result, e.g. admin:end {"room":"room-1","winner":"..."} (admin)
+  <request> [json]        send any request type with optional JSON data
+  help                    show this help
+  quit                    close the connection and exit`
+
+// parseCommand parses a line of user input into request type and data.
+func parseCommand(line string) (requestType string, data interface{}, err error) {
+	line = strings.TrimSpace(line)
+	requestType, args, _ := strings.Cut(line, " ")
+	args = strings.TrimSpace(args)
+
+	switch requestType {
+	case "":
+		return "", nil, fmt.Errorf("empty command")
+	case "shot":
+		fields := strings.Fields(args)
+		if len(fields) != 2 {
+			return "", nil, fmt.Errorf("usage: shot <x> <y>")
+		}
+		var cord [2]int
+		for i, f := range fields {
+			if cord[i], err = strconv.Atoi(f); err != nil {
+				return "", nil, fmt.Errorf("invalid coordinate %#v: %w", f, err)
+			}
+		}
+		return requestType, cord, nil
+	default:
+		if args == "" {
+			return requestType, nil, nil
+		}
+		if !json.Valid([]byte(args)) {
+			return "", nil, fmt.Errorf("invalid JSON data: %s", args)
+		}
+		return requestType, json.RawMessage(args), nil
+	}
+}
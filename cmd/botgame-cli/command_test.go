@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		line        string
+		requestType string
+		data        string
+	}{
+		{"join", "join", "null"},
+		{"  room:list  ", "room:list", "null"},
+		{"shot 3 4", "shot", "[3,4]"},
+		{"shot   0\t9 ", "shot", "[0,9]"},
+		{`auth {"token":"abc"}`, "auth", `{"token":"abc"}`},
+		{`room:create   {"name": "foo bar"}`, "room:create", `{"name":"foo bar"}`},
+		{`room:create {"name":"say \"hi\", {ok}"}`, "room:create", `{"name":"say \"hi\", {ok}"}`},
+		{`auth "abc def"`, "auth", `"abc def"`},
+		{`setup [{"ID":1,"Coordinate":[0,0],"Direction":0}]`, "setup", `[{"ID":1,"Coordinate":[0,0],"Direction":0}]`},
+		{"matchmake 1500", "matchmake", "1500"},
+	}
+	for _, test := range tests {
+		requestType, data, err := parseCommand(test.line)
+		if err != nil {
+			t.Errorf("%#v: unexpected error: %s", test.line, err)
+			continue
+		}
+		if want, have := test.requestType, requestType; want != have {
+			t.Errorf("%#v: unexpected request type. want %#v, have %#v", test.line, want, have)
+		}
+		b, err := json.Marshal(data)
+		if err != nil {
+			t.Errorf("%#v: unexpected error: %s", test.line, err)
+			continue
+		}
+		if want, have := test.data, string(b); want != have {
+			t.Errorf("%#v: unexpected data. want %s, have %s", test.line, want, have)
+		}
+	}
+}
+
+func TestParseCommand_Error(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"   ",
+		"shot",
+		"shot 1",
+		"shot 1 2 3",
+		"shot x 2",
+		"shot 1 2.5",
+		"auth abc",
+		`auth "abc`,
+		`auth 'abc'`,
+		`room:create {"name":"foo"`,
+		`room:create {"name":"foo"} x`,
+	} {
+		if _, _, err := parseCommand(line); err == nil {
+			t.Errorf("%#v: expected error", line)
+		}
+	}
+}
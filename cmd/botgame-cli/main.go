@@ -0,0 +1,153 @@
+// Command botgame-cli is an interactive client for manual
+// protocol testing against a comms server.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/yookoala/botgame-playground/comms"
+)
+
+// console prints messages to the terminal without messing up the prompt.
+type console struct {
+	lock    *sync.Mutex
+	pending map[string]string
+}
+
+// pretty formats the message as indented JSON.
+func pretty(m comms.Message) string {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Sprintf("%v", m)
+	}
+	out := &bytes.Buffer{}
+	if err := json.Indent(out, b, "  ", "  "); err != nil {
+		return string(b)
+	}
+	return out.String()
+}
+
+// sent remembers the request to match with its response later.
+func (c *console) sent(req comms.Request) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pending[req.RequestID()] = req.RequestType()
+	fmt.Printf("-> request #%s (%s)\n  %s\n", req.RequestID(), req.RequestType(), pretty(req))
+}
+
+// received prints the message received from server.
+func (c *console) received(m comms.Message) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch m.Type() {
+	case "response":
+		resp := m.(comms.Response)
+		requestType, ok := c.pending[resp.RequestID()]
+		if ok {
+			delete(c.pending, resp.RequestID())
+			fmt.Printf("\n<- response to #%s (%s): %d %s\n", resp.RequestID(), requestType, resp.Code(), resp.Response())
+		} else {
+			fmt.Printf("\n<- response to unknown request #%s: %d %s\n", resp.RequestID(), resp.Code(), resp.Response())
+		}
+	case "event":
+		fmt.Printf("\n<- event %s\n", m.(comms.Event).EventType())
+	default:
+		fmt.Printf("\n<- %s\n", m.Type())
+	}
+	fmt.Printf("  %s\n> ", pretty(m))
+}
+
+func main() {
+	network := flag.String("network", "unix", "network of the server address (unix or tcp)")
+	addr := flag.String("addr", "./echo.sock", "server address")
+	flag.Parse()
+
+	conn, err := net.Dial(*network, *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sess, greeting, err := comms.NewSessionFromConn(conn)
+	if err != nil {
+		log.Fatalf("error reading greeting: %s", err)
+	}
+	defer sess.Close()
+
+	fmt.Printf("connected to %s:%s as session %s\n  %s\n", *network, *addr, sess.ID(), pretty(greeting))
+	fmt.Println(`type "help" for available commands`)
+
+	c := &console{
+		lock:    &sync.Mutex{},
+		pending: make(map[string]string),
+	}
+
+	// Print all incoming messages.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			m, err := sess.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.received(m)
+		}
+	}()
+
+	// Read user input line by line.
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	nextID := 1
+	for {
+		fmt.Print("> ")
+		var line string
+		var ok bool
+		select {
+		case <-closed:
+			fmt.Println("\nconnection closed by server")
+			return
+		case line, ok = <-lines:
+			if !ok {
+				return
+			}
+		}
+
+		switch line {
+		case "":
+			continue
+		case "help":
+			fmt.Println(helpText)
+			continue
+		case "quit", "exit":
+			return
+		}
+
+		requestType, data, err := parseCommand(line)
+		if err != nil {
+			fmt.Printf("error: %s\n", err)
+			continue
+		}
+		req := comms.NewRequest(strconv.Itoa(nextID), requestType, data)
+		nextID++
+		c.sent(req)
+		if err := sess.WriteMessage(req); err != nil {
+			fmt.Printf("error sending request: %s\n", err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Command botgame-load simulates many bots connecting to a comms server
+// and reports the throughput, latency and errors of request-response.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+)
+
+// config is the configuration of simulated bots.
+type config struct {
+	network string
+	addr    string
+	mix     messageMix
+	rate    float64
+	timeout time.Duration
+}
+
+// runBot runs a simulated bot until the context is done.
+func runBot(ctx context.Context, id int, cfg config, st *stats) {
+	d := &net.Dialer{Timeout: cfg.timeout}
+	conn, err := d.DialContext(ctx, cfg.network, cfg.addr)
+	if err != nil {
+		st.add(func(s *stats) { s.dialErrors++ })
+		return
+	}
+	sess, _, err := comms.NewSessionFromConn(conn)
+	if err != nil {
+		conn.Close()
+		st.add(func(s *stats) { s.dialErrors++ })
+		return
+	}
+	st.add(func(s *stats) { s.connected++ })
+
+	lock := &sync.Mutex{}
+	pending := make(map[string]time.Time)
+	closing := false
+	answered := make(chan struct{}, 1)
+	readDone := make(chan struct{})
+
+	// Match responses with pending requests.
+	go func() {
+		defer close(readDone)
+		for {
+			m, err := sess.ReadMessage()
+			if err != nil {
+				lock.Lock()
+				if !closing {
+					st.add(func(s *stats) { s.readErrors++ })
+				}
+				lock.Unlock()
+				return
+			}
+			if m.Type() != "response" {
+				continue
+			}
+			resp := m.(comms.Response)
+			lock.Lock()
+			sentAt, ok := pending[resp.RequestID()]
+			delete(pending, resp.RequestID())
+			lock.Unlock()
+			if !ok {
+				continue
+			}
+			latency := time.Since(sentAt)
+			st.add(func(s *stats) { s.record(resp.Code(), latency) })
+			select {
+			case answered <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	var tick <-chan time.Time
+	if cfg.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+sendLoop:
+	for seq := 1; ; seq++ {
+		e := cfg.mix.pick(r)
+		var data interface{}
+		if e.data != nil {
+			data = e.data
+		}
+		req := comms.NewRequest(fmt.Sprintf("%d-%d", id, seq), e.requestType, data)
+
+		lock.Lock()
+		pending[req.RequestID()] = time.Now()
+		lock.Unlock()
+		if err := sess.WriteMessage(req); err != nil {
+			st.add(func(s *stats) { s.writeErrors++ })
+			break sendLoop
+		}
+		st.add(func(s *stats) { s.sent++ })
+
+		if tick != nil {
+			// Open loop: send at fixed rate.
+			select {
+			case <-ctx.Done():
+				break sendLoop
+			case <-tick:
+			}
+		} else {
+			// Closed loop: send the next request once answered.
+			select {
+			case <-ctx.Done():
+				break sendLoop
+			case <-answered:
+			case <-time.After(cfg.timeout):
+			}
+		}
+	}
+
+	// Wait for the remaining responses.
+	deadline := time.Now().Add(cfg.timeout)
+	for time.Now().Before(deadline) {
+		lock.Lock()
+		n := len(pending)
+		lock.Unlock()
+		if n == 0 {
+			break
+		}
+		select {
+		case <-readDone:
+			deadline = time.Now()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	lock.Lock()
+	closing = true
+	timeouts := len(pending)
+	lock.Unlock()
+	st.add(func(s *stats) { s.timeouts += timeouts })
+	sess.Close()
+	<-readDone
+}
+
+func main() {
+	network := flag.String("network", "unix", "network of the server address (unix or tcp)")
+	addr := flag.String("addr", "./echo.sock", "server address")
+	sessions := flag.Int("n", 10, "number of simulated bots")
+	mixSpec := flag.String("mix", "room:list=1", `weighted request types to send, e.g. "room:list=3,leaderboard=1,shot:[0,0]=2"`)
+	rate := flag.Float64("rate", 10, "requests per second of each bot. 0 to send the next request once answered")
+	duration := flag.Duration("duration", 10*time.Second, "duration to send requests")
+	timeout := flag.Duration("timeout", 5*time.Second, "time to wait for a response")
+	flag.Parse()
+
+	mix, err := parseMix(*mixSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := config{
+		network: *network,
+		addr:    *addr,
+		mix:     mix,
+		rate:    *rate,
+		timeout: *timeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	log.Printf("starting %d bots against %s:%s for %s", *sessions, *network, *addr, *duration)
+	st := newStats()
+	start := time.Now()
+	wg := &sync.WaitGroup{}
+	wg.Add(*sessions)
+	for i := 1; i <= *sessions; i++ {
+		go func(id int) {
+			defer wg.Done()
+			runBot(ctx, id, cfg, st)
+		}(i)
+	}
+
+	<-ctx.Done()
+	elapsed := time.Since(start)
+	log.Printf("stop sending. waiting for remaining responses")
+	wg.Wait()
+
+	st.report(os.Stdout, *sessions, elapsed)
+}
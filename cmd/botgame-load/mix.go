@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// mixEntry is a request type to send with its weight.
+type mixEntry struct {
+	requestType string
+	data        json.RawMessage
+	weight      int
+}
+
+// messageMix picks request types to send by weight.
+type messageMix []mixEntry
+
+// parseMix parses a comma separated list of "type=weight" or
+// "type:json=weight" entries. Weight defaults to 1 if omitted. The JSON
+// data may contain commas and equal signs.
+//
+// Example: "subscribe=3,join=1,shot:[0,0]=2"
+func parseMix(s string) (mix messageMix, err error) {
+	for rest := s; strings.TrimSpace(rest) != ""; {
+		var e mixEntry
+		if e, rest, err = parseMixEntry(rest); err != nil {
+			return nil, err
+		}
+		if e.requestType != "" {
+			mix = append(mix, e)
+		}
+	}
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("empty message mix")
+	}
+	return mix, nil
+}
+
+// parseMixEntry parses the first entry of the list, and returns the
+// rest of the list after the comma. The entry is empty if there is
+// nothing before the comma.
+func parseMixEntry(s string) (e mixEntry, next string, err error) {
+	e.weight = 1
+	i := strings.IndexAny(s, ":=,")
+	if i < 0 {
+		i = len(s)
+	}
+	e.requestType = strings.TrimSpace(s[:i])
+	rest := s[i:]
+
+	// Read the JSON data to its end, which may be after commas.
+	if strings.HasPrefix(rest, ":") {
+		dec := json.NewDecoder(strings.NewReader(rest[1:]))
+		if err = dec.Decode(&e.data); err != nil {
+			return e, "", fmt.Errorf("invalid JSON data of %#v: %w", e.requestType, err)
+		}
+		rest = rest[1+dec.InputOffset():]
+	}
+
+	weight, next, _ := strings.Cut(rest, ",")
+	entry := strings.TrimSpace(s[:len(s)-len(rest)+len(weight)])
+	if e.requestType == "" {
+		if entry != "" {
+			return e, "", fmt.Errorf("empty request type in %#v", entry)
+		}
+		return e, next, nil
+	}
+	if weight = strings.TrimSpace(weight); weight != "" {
+		if !strings.HasPrefix(weight, "=") {
+			return e, "", fmt.Errorf("invalid weight in %#v", entry)
+		}
+		if e.weight, err = strconv.Atoi(strings.TrimSpace(weight[1:])); err != nil || e.weight <= 0 {
+			return e, "", fmt.Errorf("invalid weight in %#v", entry)
+		}
+	}
+	return e, next, nil
+}
+
+// pick randomly picks an entry by weight.
+func (mix messageMix) pick(r *rand.Rand) mixEntry {
+	total := 0
+	for _, e := range mix {
+		total += e.weight
+	}
+	n := r.Intn(total)
+	for _, e := range mix {
+		if n < e.weight {
+			return e
+		}
+		n -= e.weight
+	}
+	return mix[len(mix)-1]
+}
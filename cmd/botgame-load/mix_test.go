@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestParseMix(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []mixEntry
+	}{
+		{"subscribe", []mixEntry{{requestType: "subscribe", weight: 1}}},
+		{"subscribe=3, join=1", []mixEntry{{requestType: "subscribe", weight: 3}, {requestType: "join", weight: 1}}},
+		{"subscribe=3,join=1,shot:[0,0]=2", []mixEntry{
+			{requestType: "subscribe", weight: 3},
+			{requestType: "join", weight: 1},
+			{requestType: "shot", data: []byte("[0,0]"), weight: 2},
+		}},
+		{`setup:{"a":[1,2],"b":"x=y,z"},shot:[0,0]`, []mixEntry{
+			{requestType: "setup", data: []byte(`{"a":[1,2],"b":"x=y,z"}`), weight: 1},
+			{requestType: "shot", data: []byte("[0,0]"), weight: 1},
+		}},
+		{"join:null = 4,,", []mixEntry{{requestType: "join", data: []byte("null"), weight: 4}}},
+	}
+	for _, test := range tests {
+		have, err := parseMix(test.spec)
+		if err != nil {
+			t.Errorf("%#v: unexpected error: %s", test.spec, err)
+			continue
+		}
+		if want := test.want; len(want) != len(have) {
+			t.Errorf("%#v: unexpected entries. want %d, have %d", test.spec, len(want), len(have))
+			continue
+		}
+		for i, want := range test.want {
+			if want.requestType != have[i].requestType || string(want.data) != string(have[i].data) || want.weight != have[i].weight {
+				t.Errorf("%#v: unexpected entry %d. want %s:%s=%d, have %s:%s=%d", test.spec, i,
+					want.requestType, want.data, want.weight, have[i].requestType, have[i].data, have[i].weight)
+			}
+		}
+	}
+}
+
+func TestParseMix_Error(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		" , ",
+		"=3",
+		":[0,0]",
+		"join=0",
+		"join=-1",
+		"join=x",
+		"shot:[0,0",
+		"shot:[0,0]x",
+		"shot:{a}=1",
+	} {
+		if _, err := parseMix(spec); err == nil {
+			t.Errorf("%#v: expected error", spec)
+		}
+	}
+}
+
+func TestMessageMix_Pick(t *testing.T) {
+	tests := []struct {
+		mix  messageMix
+		want map[string]float64
+	}{
+		{
+			messageMix{{requestType: "a", weight: 1}},
+			map[string]float64{"a": 1},
+		},
+		{
+			messageMix{{requestType: "a", weight: 3}, {requestType: "b", weight: 1}},
+			map[string]float64{"a": 0.75, "b": 0.25},
+		},
+		{
+			messageMix{{requestType: "a", weight: 1}, {requestType: "b", weight: 2}, {requestType: "c", weight: 1}},
+			map[string]float64{"a": 0.25, "b": 0.5, "c": 0.25},
+		},
+	}
+	const n = 10000
+	r := rand.New(rand.NewSource(1))
+	for i, test := range tests {
+		count := make(map[string]int)
+		for j := 0; j < n; j++ {
+			count[test.mix.pick(r).requestType]++
+		}
+		for requestType, want := range test.want {
+			if have := float64(count[requestType]) / n; have < want-0.02 || have > want+0.02 {
+				t.Errorf("test %d: unexpected share of %s. want %.2f, have %.3f", i, requestType, want, have)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stats collects the results of all simulated bots.
+type stats struct {
+	lock *sync.Mutex
+
+	connected int
+	sent      int
+	received  int
+	codes     map[int]int
+
+	// latencies are of the successful responses only.
+	latencies []time.Duration
+
+	dialErrors     int
+	writeErrors    int
+	readErrors     int
+	timeouts       int
+	errorResponses int
+}
+
+func newStats() *stats {
+	return &stats{
+		lock:      &sync.Mutex{},
+		codes:     make(map[int]int),
+		latencies: make([]time.Duration, 0),
+	}
+}
+
+// record records a response of the code after the latency. Error
+// responses are not counted in the latency, as they may be answered
+// without doing the work of the request.
+func (s *stats) record(code int, latency time.Duration) {
+	s.received++
+	s.codes[code]++
+	if code >= 400 {
+		s.errorResponses++
+		return
+	}
+	s.latencies = append(s.latencies, latency)
+}
+
+// add runs f with the stats locked.
+func (s *stats) add(f func(s *stats)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f(s)
+}
+
+// percentile returns the p-th percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// report writes the summary of the stats.
+func (s *stats) report(w io.Writer, sessions int, elapsed time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sorted := make([]time.Duration, len(s.latencies))
+	copy(sorted, s.latencies)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	fmt.Fprintf(w, "sessions:   %d requested, %d connected\n", sessions, s.connected)
+	fmt.Fprintf(w, "elapsed:    %s\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "requests:   %d sent, %d responses\n", s.sent, s.received)
+	fmt.Fprintf(w, "throughput: %.1f req/s sent, %.1f resp/s received\n",
+		float64(s.sent)/elapsed.Seconds(), float64(s.received)/elapsed.Seconds())
+	codes := make([]int, 0, len(s.codes))
+	for code := range s.codes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	fmt.Fprint(w, "codes:     ")
+	for _, code := range codes {
+		fmt.Fprintf(w, " %d=%d", code, s.codes[code])
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "latency:    p50=%s p95=%s p99=%s max=%s (%d successful responses)\n",
+		percentile(sorted, 50), percentile(sorted, 95), percentile(sorted, 99), percentile(sorted, 100), len(sorted))
+	fmt.Fprintf(w, "errors:     dial=%d write=%d read=%d timeout=%d error-response=%d\n",
+		s.dialErrors, s.writeErrors, s.readErrors, s.timeouts, s.errorResponses)
+}
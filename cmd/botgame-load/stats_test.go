@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	tenMs := make([]time.Duration, 10)
+	for i := range tenMs {
+		tenMs[i] = time.Duration(i+1) * time.Millisecond
+	}
+	tests := []struct {
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{nil, 50, 0},
+		{[]time.Duration{time.Second}, 0, time.Second},
+		{[]time.Duration{time.Second}, 100, time.Second},
+		{tenMs, 0, time.Millisecond},
+		{tenMs, 50, 5 * time.Millisecond},
+		{tenMs, 95, 10 * time.Millisecond},
+		{tenMs, 99, 10 * time.Millisecond},
+		{tenMs, 100, 10 * time.Millisecond},
+		{tenMs[:4], 50, 2 * time.Millisecond},
+		{tenMs[:4], 75, 3 * time.Millisecond},
+	}
+	for _, test := range tests {
+		if have := percentile(test.sorted, test.p); test.want != have {
+			t.Errorf("p%v of %v: want %s, have %s", test.p, test.sorted, test.want, have)
+		}
+	}
+}
+
+func TestStats_Report(t *testing.T) {
+	s := newStats()
+	s.record(200, 10*time.Millisecond)
+	s.record(200, 20*time.Millisecond)
+	s.record(404, time.Microsecond)
+
+	// Error responses are counted, but not in the latency.
+	b := &strings.Builder{}
+	s.report(b, 1, time.Second)
+	for _, want := range []string{
+		"requests:   0 sent, 3 responses\n",
+		"codes:      200=2 404=1\n",
+		"latency:    p50=10ms p95=20ms p99=20ms max=20ms (2 successful responses)\n",
+		"error-response=1\n",
+	} {
+		if have := b.String(); !strings.Contains(have, want) {
+			t.Errorf("expected %q in report:\n%s", want, have)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package comms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errNotSupported is returned when the message handler of a room does
+// not support an admin request.
+var errNotSupported = errors.New("not supported by the game")
+
+// Inspector is implemented by message handlers that can report their
+// full internal state to administrators.
+type Inspector interface {
+	Inspect() interface{}
+}
+
+// GameEnder is implemented by message handlers of games that can be
+// ended by administrators with a declared result. The winner is a
+// session ID, or empty for a draw. The game should write its result
+// to the message writer as it does when the game ends normally.
+type GameEnder interface {
+	EndGame(winner string, mw MessageWriter) error
+}
+
+// SessionInfo is the information of a session for administrators.
+type SessionInfo struct {
+	ID    string `json:"id"`
+	Room  string `json:"room,omitempty"`
+	Admin bool   `json:"admin,omitempty"`
+}
+
+// AdminHandler provides administrators a control channel over the comms
+// protocol. Sessions become administrators with the "admin:auth"
+// request, which data is {"token": "..."}, checked by an authenticator
+// separate from the one of bots. Administrators can then send:
+//
+//   - "admin:sessions": list the sessions and their rooms.
+//   - "admin:games": list the rooms, as the "room:list" request.
+//   - "admin:inspect": get the full state of the game of {"room": "..."}.
+//   - "admin:kick": close the session of {"session": "..."}.
+//   - "admin:pause": pause the game of {"room": "..."}.
+//   - "admin:resume": resume the game of {"room": "..."}.
+//   - "admin:end": end the game of {"room": "...", "winner": "..."}
+//     with the declared result. Empty winner for a draw.
+//
+// Other sessions are forbidden to send admin requests. All other
+// messages are sent to the next message handler.
+//
+// Implements MessageHandler interface.
+type AdminHandler struct {
+	authn Authenticator
+	rm    *RoomManager
+	next  MessageHandler
+
+	admins map[string]string
+	lock   *sync.RWMutex
+}
+
+// NewAdminHandler creates a new AdminHandler to manage the rooms of rm.
+func NewAdminHandler(authn Authenticator, rm *RoomManager, next MessageHandler) *AdminHandler {
+	return &AdminHandler{
+		authn:  authn,
+		rm:     rm,
+		next:   next,
+		admins: make(map[string]string),
+		lock:   &sync.RWMutex{},
+	}
+}
+
+// IsAdmin reports if the session is authenticated as administrator.
+func (h *AdminHandler) IsAdmin(sessionID string) bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	_, ok := h.admins[sessionID]
+	return ok
+}
+
+// HandleMessage handles the admin requests, and sends other messages to
+// the next message handler.
+//
+// Implements MessageHandler interface.
+func (h *AdminHandler) HandleMessage(ctx context.Context, m Message, mw MessageWriter) error {
+	req, ok := m.(Request)
+	if !ok || m.Type() != "request" || !strings.HasPrefix(req.RequestType(), "admin:") {
+		return h.next.HandleMessage(ctx, m, mw)
+	}
+
+	sessionID := GetSessionID(ctx)
+	if req.RequestType() == "admin:auth" {
+		return mw.WriteMessage(h.authenticate(ctx, req))
+	}
+	if !h.IsAdmin(sessionID) {
+		return mw.WriteMessage(NewErrorResponse(sessionID, req.RequestID(), 403, "error", "forbidden"))
+	}
+	return mw.WriteMessage(h.handleAdminRequest(ctx, req))
+}
+
+// authenticate handles the "admin:auth" request.
+func (h *AdminHandler) authenticate(ctx context.Context, req Request) Response {
+	sessionID := GetSessionID(ctx)
+	if h.IsAdmin(sessionID) {
+		return NewErrorResponse(sessionID, req.RequestID(), 409, "error", "already authenticated")
+	}
+
+	data := struct {
+		Token string `json:"token"`
+	}{}
+	req.ReadDataTo(&data)
+	identity, err := h.authn.Authenticate(data.Token)
+	if err != nil {
+		log.Printf("AdminHandler session %s failed to authenticate: %s", sessionID, err)
+		return NewErrorResponse(sessionID, req.RequestID(), 401, "error", err.Error())
+	}
+
+	h.lock.Lock()
+	h.admins[sessionID] = identity
+	h.lock.Unlock()
+	if sc := GetSessionCollection(ctx); sc != nil {
+		if s := sc.Get(sessionID); s != nil {
+			s.OnClose(func(s *Session) {
+				h.lock.Lock()
+				delete(h.admins, s.ID())
+				h.lock.Unlock()
+			})
+		}
+	}
+
+	log.Printf("AdminHandler session %s authenticated as administrator %s", sessionID, identity)
+	return NewResponse(sessionID, req.RequestID(), req.RequestType(), 200, "success", identity)
+}
+
+// handleAdminRequest handles a request of an administrator and returns
+// the response.
+func (h *AdminHandler) handleAdminRequest(ctx context.Context, req Request) Response {
+	sessionID := GetSessionID(ctx)
+	errorResponse := func(code int, err error) Response {
+		return NewErrorResponse(sessionID, req.RequestID(), code, "error", err.Error())
+	}
+	success := func(data interface{}) Response {
+		return NewResponse(sessionID, req.RequestID(), req.RequestType(), 200, "success", data)
+	}
+
+	data := struct {
+		Room    string `json:"room"`
+		Session string `json:"session"`
+		Winner  string `json:"winner"`
+	}{}
+	req.ReadDataTo(&data)
+
+	switch req.RequestType() {
+	case "admin:sessions":
+		ids := make([]string, 0)
+		if sc := GetSessionCollection(ctx); sc != nil {
+			lock := &sync.Mutex{}
+			sc.Map(func(s *Session) {
+				lock.Lock()
+				ids = append(ids, s.ID())
+				lock.Unlock()
+			})
+		}
+		sort.Strings(ids)
+		infos := make([]SessionInfo, len(ids))
+		for i, id := range ids {
+			infos[i] = SessionInfo{ID: id, Admin: h.IsAdmin(id)}
+			if r := h.rm.RoomOf(id); r != nil {
+				infos[i].Room = r.ID()
+			}
+		}
+		return success(infos)
+	case "admin:games":
+		rooms := h.rm.Rooms()
+		infos := make([]RoomInfo, len(rooms))
+		for i, r := range rooms {
+			infos[i] = r.Info()
+		}
+		return success(infos)
+	case "admin:kick":
+		var s *Session
+		if sc := GetSessionCollection(ctx); sc != nil {
+			s = sc.Get(data.Session)
+		}
+		if s == nil {
+			return errorResponse(404, fmt.Errorf("session not found: %s", data.Session))
+		}
+		log.Printf("AdminHandler session %s kicked session %s", sessionID, s.ID())
+		s.Close()
+		return success(nil)
+	}
+
+	r := h.rm.Room(data.Room)
+	if r == nil {
+		return errorResponse(404, fmt.Errorf("room not found: %s", data.Room))
+	}
+	switch req.RequestType() {
+	case "admin:inspect":
+		var state interface{}
+		err := r.Control(func(mh MessageHandler, mw MessageWriter) error {
+			i, ok := mh.(Inspector)
+			if !ok {
+				return errNotSupported
+			}
+			state = i.Inspect()
+			return nil
+		})
+		if errors.Is(err, errNotSupported) {
+			return errorResponse(501, err)
+		}
+		return success(state)
+	case "admin:pause":
+		if err := r.Pause(); err != nil {
+			return errorResponse(409, err)
+		}
+		log.Printf("AdminHandler session %s paused room %s", sessionID, r.ID())
+		return success(r.Info())
+	case "admin:resume":
+		if err := r.Resume(); err != nil {
+			return errorResponse(409, err)
+		}
+		log.Printf("AdminHandler session %s resumed room %s", sessionID, r.ID())
+		return success(r.Info())
+	case "admin:end":
+		err := r.Control(func(mh MessageHandler, mw MessageWriter) error {
+			ge, ok := mh.(GameEnder)
+			if !ok {
+				return errNotSupported
+			}
+			return ge.EndGame(data.Winner, mw)
+		})
+		if errors.Is(err, errNotSupported) {
+			return errorResponse(501, err)
+		}
+		if err != nil {
+			return errorResponse(400, err)
+		}
+		log.Printf("AdminHandler session %s ended room %s (winner=%q)", sessionID, r.ID(), data.Winner)
+		return success(nil)
+	}
+	return errorResponse(400, fmt.Errorf("unknown request: %s", req.RequestType()))
+}
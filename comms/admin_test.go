@@ -0,0 +1,134 @@
+package comms_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+	"github.com/yookoala/botgame-playground/comms/commstest"
+)
+
+// countingGame counts the requests it handled, and can be inspected
+// and ended by administrators.
+type countingGame struct {
+	count int
+	ended bool
+}
+
+func (g *countingGame) HandleMessage(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+	req, ok := m.(comms.Request)
+	if !ok || m.Type() != "request" {
+		return nil
+	}
+	g.count++
+	return mw.WriteMessage(comms.NewResponse(comms.GetSessionID(ctx), req.RequestID(), req.RequestType(), 200, "success", g.count))
+}
+
+func (g *countingGame) Inspect() interface{} {
+	return map[string]interface{}{"count": g.count, "ended": g.ended}
+}
+
+func (g *countingGame) EndGame(winner string, mw comms.MessageWriter) error {
+	if g.ended {
+		return errors.New("game already ended")
+	}
+	g.ended = true
+	return mw.WriteMessage(comms.NewEvent("game:result", map[string]string{"winner": winner}))
+}
+
+func TestAdminHandler(t *testing.T) {
+	rm := comms.NewRoomManager().Register("count", 2, func() comms.MessageHandler {
+		return &countingGame{}
+	})
+	ah := comms.NewAdminHandler(comms.TokenAuthenticator{"root": "secret"}, rm, rm)
+	h := commstest.NewHarness(t, ah)
+	admin, c1, c2 := h.Connect(), h.Connect(), h.Connect()
+
+	// Only administrators can send admin requests.
+	c1.ExpectResponseCode(c1.Request("admin:games", nil), 403)
+	admin.ExpectResponseCode(admin.Request("admin:auth", map[string]string{"token": "wrong"}), 401)
+	admin.ExpectResponseCode(admin.Request("admin:auth", map[string]string{"token": "secret"}), 200)
+	admin.ExpectResponseCode(admin.Request("admin:auth", map[string]string{"token": "secret"}), 409)
+	if !ah.IsAdmin(admin.ID()) || ah.IsAdmin(c1.ID()) {
+		t.Errorf("unexpected administrators")
+	}
+
+	room := readRoomInfo(t, c1.ExpectResponseCode(c1.Request("room:create", nil), 200))
+	c2.ExpectResponseCode(c2.Request("room:join", map[string]string{"room": room.ID}), 200)
+
+	var sessions []comms.SessionInfo
+	admin.ExpectResponseCode(admin.Request("admin:sessions", nil), 200).ReadDataTo(&sessions)
+	if want, have := 3, len(sessions); want != have {
+		t.Fatalf("unexpected number of sessions. want %d, have %d", want, have)
+	}
+	for _, s := range sessions {
+		want := room.ID
+		if s.ID == admin.ID() {
+			want = ""
+		}
+		if have := s.Room; want != have {
+			t.Errorf("unexpected room of session %s. want %#v, have %#v", s.ID, want, have)
+		}
+	}
+	var games []comms.RoomInfo
+	admin.ExpectResponseCode(admin.Request("admin:games", nil), 200).ReadDataTo(&games)
+	if want, have := 1, len(games); want != have {
+		t.Fatalf("unexpected number of games. want %d, have %d", want, have)
+	}
+
+	// Messages are held while the game is paused.
+	info := readRoomInfo(t, admin.ExpectResponseCode(admin.Request("admin:pause", map[string]string{"room": room.ID}), 200))
+	if !info.Paused {
+		t.Errorf("expected room to be paused")
+	}
+	admin.ExpectResponseCode(admin.Request("admin:pause", map[string]string{"room": room.ID}), 409)
+	c1.ExpectEvent("game:pause")
+	c2.ExpectEvent("game:pause")
+	requestID := c1.Request("move", nil)
+	c1.ExpectNoMessage(50 * time.Millisecond)
+	admin.ExpectResponseCode(admin.Request("admin:resume", map[string]string{"room": room.ID}), 200)
+	admin.ExpectResponseCode(admin.Request("admin:resume", map[string]string{"room": room.ID}), 409)
+	c1.ExpectEvent("game:resume")
+	c1.ExpectResponseCode(requestID, 200)
+
+	state := struct {
+		Count int `json:"count"`
+	}{}
+	admin.ExpectResponseCode(admin.Request("admin:inspect", map[string]string{"room": room.ID}), 200).ReadDataTo(&state)
+	if want, have := 1, state.Count; want != have {
+		t.Errorf("unexpected count. want %d, have %d", want, have)
+	}
+	admin.ExpectResponseCode(admin.Request("admin:inspect", map[string]string{"room": "no-such-room"}), 404)
+
+	// Force-end the game with a declared result.
+	admin.ExpectResponseCode(admin.Request("admin:end", map[string]string{"room": room.ID, "winner": c1.ID()}), 200)
+	admin.ExpectResponseCode(admin.Request("admin:end", map[string]string{"room": room.ID, "winner": c1.ID()}), 400)
+	result := struct {
+		Winner string `json:"winner"`
+	}{}
+	c2.ExpectEvent("game:result").ReadDataTo(&result)
+	if want, have := c1.ID(), result.Winner; want != have {
+		t.Errorf("unexpected winner. want %#v, have %#v", want, have)
+	}
+
+	// Kick a session.
+	admin.ExpectResponseCode(admin.Request("admin:kick", map[string]string{"session": c2.ID()}), 200)
+	admin.ExpectResponseCode(admin.Request("admin:kick", map[string]string{"session": c2.ID()}), 404)
+	admin.ExpectResponseCode(admin.Request("admin:sessions", nil), 200).ReadDataTo(&sessions)
+	if want, have := 2, len(sessions); want != have {
+		t.Errorf("unexpected number of sessions. want %d, have %d", want, have)
+	}
+}
+
+func TestAdminHandler_NotSupported(t *testing.T) {
+	rm := comms.NewRoomManager().Register("echo", 2, roomEchoHandler)
+	h := commstest.NewHarness(t, comms.NewAdminHandler(comms.TokenAuthenticator{"root": "secret"}, rm, rm))
+	admin, c := h.Connect(), h.Connect()
+	admin.ExpectResponseCode(admin.Request("admin:auth", map[string]string{"token": "secret"}), 200)
+	room := readRoomInfo(t, c.ExpectResponseCode(c.Request("room:create", nil), 200))
+
+	admin.ExpectResponseCode(admin.Request("admin:inspect", map[string]string{"room": room.ID}), 501)
+	admin.ExpectResponseCode(admin.Request("admin:end", map[string]string{"room": room.ID}), 501)
+}
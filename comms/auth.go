@@ -0,0 +1,152 @@
+package comms
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidToken is returned by Authenticator for unknown tokens.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Authenticator resolves the identity of a bot from its token.
+type Authenticator interface {
+	Authenticate(token string) (identity string, err error)
+}
+
+// AuthenticatorFunc is an adapter to allow the use of ordinary functions as Authenticator.
+type AuthenticatorFunc func(token string) (identity string, err error)
+
+// Authenticate implements Authenticator.
+func (f AuthenticatorFunc) Authenticate(token string) (identity string, err error) {
+	return f(token)
+}
+
+// TokenAuthenticator authenticates with a fixed set of tokens. Maps
+// identity to token.
+type TokenAuthenticator map[string]string
+
+// Authenticate implements Authenticator.
+func (ta TokenAuthenticator) Authenticate(token string) (identity string, err error) {
+	if token == "" {
+		return "", ErrInvalidToken
+	}
+	for id, t := range ta {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			identity = id
+		}
+	}
+	if identity == "" {
+		return "", ErrInvalidToken
+	}
+	return identity, nil
+}
+
+// LoadTokenFile loads a TokenAuthenticator from file. Each line of the
+// file is an identity and its token, separated by space. Empty lines
+// and lines starting with "#" are ignored.
+func LoadTokenFile(filename string) (TokenAuthenticator, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ta := make(TokenAuthenticator)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected identity and token", filename, n)
+		}
+		ta[fields[0]] = fields[1]
+	}
+	return ta, scanner.Err()
+}
+
+// AuthHandler authenticates sessions with the "auth" request, which
+// data is {"token": "..."}. The identity of authenticated sessions are
+// added to the context of their messages (see GetIdentity) before they
+// are sent to the next message handler.
+//
+// Implements MessageHandler interface.
+type AuthHandler struct {
+	authn Authenticator
+	next  MessageHandler
+
+	identities map[string]string
+	lock       *sync.RWMutex
+}
+
+// NewAuthHandler creates a new AuthHandler.
+func NewAuthHandler(authn Authenticator, next MessageHandler) *AuthHandler {
+	return &AuthHandler{
+		authn:      authn,
+		next:       next,
+		identities: make(map[string]string),
+		lock:       &sync.RWMutex{},
+	}
+}
+
+// Identity returns the identity of the session, or empty string if the
+// session is not authenticated.
+func (h *AuthHandler) Identity(sessionID string) string {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.identities[sessionID]
+}
+
+// HandleMessage handles the "auth" request, and sends other messages
+// to the next message handler.
+//
+// Implements MessageHandler interface.
+func (h *AuthHandler) HandleMessage(ctx context.Context, m Message, mw MessageWriter) error {
+	sessionID := GetSessionID(ctx)
+	req, ok := m.(Request)
+	if !ok || m.Type() != "request" || req.RequestType() != "auth" {
+		if identity := h.Identity(sessionID); identity != "" {
+			ctx = WithIdentity(ctx, identity)
+		}
+		return h.next.HandleMessage(ctx, m, mw)
+	}
+
+	if h.Identity(sessionID) != "" {
+		return mw.WriteMessage(NewErrorResponse(sessionID, req.RequestID(), 409, "error", "already authenticated"))
+	}
+
+	data := struct {
+		Token string `json:"token"`
+	}{}
+	req.ReadDataTo(&data)
+	identity, err := h.authn.Authenticate(data.Token)
+	if err != nil {
+		log.Printf("AuthHandler session %s failed to authenticate: %s", sessionID, err)
+		return mw.WriteMessage(NewErrorResponse(sessionID, req.RequestID(), 401, "error", err.Error()))
+	}
+
+	h.lock.Lock()
+	h.identities[sessionID] = identity
+	h.lock.Unlock()
+	if sc := GetSessionCollection(ctx); sc != nil {
+		if s := sc.Get(sessionID); s != nil {
+			s.OnClose(func(s *Session) {
+				h.lock.Lock()
+				delete(h.identities, s.ID())
+				h.lock.Unlock()
+			})
+		}
+	}
+
+	log.Printf("AuthHandler session %s authenticated as %s", sessionID, identity)
+	return mw.WriteMessage(NewResponse(sessionID, req.RequestID(), req.RequestType(), 200, "success", identity))
+}
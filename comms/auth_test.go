@@ -0,0 +1,73 @@
+package comms_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yookoala/botgame-playground/comms"
+	"github.com/yookoala/botgame-playground/comms/commstest"
+)
+
+func TestLoadTokenFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "tokens")
+	os.WriteFile(filename, []byte("# identity token\nalice secret-a\n\nbob secret-b\n"), 0600)
+
+	ta, err := comms.LoadTokenFile(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	identity, err := ta.Authenticate("secret-b")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want, have := "bob", identity; want != have {
+		t.Errorf("unexpected identity. want %#v, have %#v", want, have)
+	}
+	if _, err := ta.Authenticate("bob"); !errors.Is(err, comms.ErrInvalidToken) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	os.WriteFile(filename, []byte("alice\n"), 0600)
+	if _, err := comms.LoadTokenFile(filename); err == nil {
+		t.Errorf("expected error loading malformed file")
+	}
+}
+
+func TestAuthHandler(t *testing.T) {
+	// Responds with the identity in context.
+	whoami := comms.MessageHandlerFunc(func(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+		req := m.(comms.Request)
+		return mw.WriteMessage(comms.NewResponse(
+			comms.GetSessionID(ctx),
+			req.RequestID(),
+			req.RequestType(),
+			200,
+			"success",
+			comms.GetIdentity(ctx),
+		))
+	})
+	ah := comms.NewAuthHandler(comms.TokenAuthenticator{"alice": "secret"}, whoami)
+	h := commstest.NewHarness(t, ah)
+	c := h.Connect()
+
+	var identity string
+	c.ExpectResponseCode(c.Request("whoami", nil), 200).ReadDataTo(&identity)
+	if want, have := "", identity; want != have {
+		t.Errorf("unexpected identity. want %#v, have %#v", want, have)
+	}
+
+	c.ExpectResponseCode(c.Request("auth", map[string]string{"token": "wrong"}), 401)
+	c.ExpectResponseCode(c.Request("auth", map[string]string{"token": "secret"}), 200)
+	c.ExpectResponseCode(c.Request("auth", map[string]string{"token": "secret"}), 409)
+
+	c.ExpectResponseCode(c.Request("whoami", nil), 200).ReadDataTo(&identity)
+	if want, have := "alice", identity; want != have {
+		t.Errorf("unexpected identity. want %#v, have %#v", want, have)
+	}
+	if want, have := "alice", ah.Identity(c.ID()); want != have {
+		t.Errorf("unexpected identity. want %#v, have %#v", want, have)
+	}
+}
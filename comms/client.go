@@ -2,41 +2,217 @@ package comms
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"net"
+	"time"
 )
 
-func StartClient(mh MessageHandler, conn net.Conn) (err error) {
+// Dialer dials a new connection to the server.
+type Dialer interface {
+	Dial(ctx context.Context) (io.ReadWriteCloser, error)
+}
 
-	sessionID := ""
-	tempSess := NewSession("", conn)
-	sess := tempSess
+// DialerFunc is an adapter to allow the use of ordinary functions as Dialers.
+type DialerFunc func(ctx context.Context) (io.ReadWriteCloser, error)
 
-	// Signal message handler to initialize.
-	err = mh.HandleMessage(context.Background(), NewSignal("client:init", nil), tempSess)
-	if err != nil {
-		log.Fatal(err)
+// Dial calls f(ctx)
+func (f DialerFunc) Dial(ctx context.Context) (io.ReadWriteCloser, error) {
+	return f(ctx)
+}
+
+// NetDialer returns a Dialer that dials the given network address
+// (e.g. "unix", "./echo.sock").
+func NetDialer(network, address string) Dialer {
+	return DialerFunc(func(ctx context.Context) (io.ReadWriteCloser, error) {
+		d := &net.Dialer{}
+		return d.DialContext(ctx, network, address)
+	})
+}
+
+// Backoff returns the duration to wait before the given reconnection
+// attempt. Attempt starts from 1.
+type Backoff func(attempt int) time.Duration
+
+// ConstantBackoff returns a Backoff that always waits for the same duration.
+func ConstantBackoff(d time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		return d
+	}
+}
+
+// ExponentialBackoff returns a Backoff that starts waiting with base
+// and doubles the wait on every attempt, up to maxDelay.
+func ExponentialBackoff(base, maxDelay time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		d := base
+		for i := 1; i < attempt && d < maxDelay; i++ {
+			d *= 2
+		}
+		if d > maxDelay {
+			d = maxDelay
+		}
+		return d
+	}
+}
+
+// Client is the client runtime for a MessageHandler.
+//
+// A client dials the server, performs the greeting handshake, then feed
+// every message from the server to the message handler until either the
+// connection is closed or the context is cancelled.
+type Client struct {
+	dialer  Dialer
+	handler MessageHandler
+
+	reconnect  bool
+	maxRetries int
+	backoff    Backoff
+
+	onError func(error)
+}
+
+// NewClient creates a new Client that connects with the dialer and
+// handle messages with the message handler.
+//
+// Reconnection is disabled by default. See Client.Reconnect.
+func NewClient(dialer Dialer, mh MessageHandler) *Client {
+	return &Client{
+		dialer:  dialer,
+		handler: mh,
+		backoff: ExponentialBackoff(100*time.Millisecond, 10*time.Second),
+	}
+}
+
+// Reconnect enables reconnection when dialing fails or when the connection
+// is lost. The client gives up after maxRetries consecutive failed attempts.
+// Non-positive maxRetries means retry forever. If backoff is nil, the
+// default exponential backoff is used.
+func (c *Client) Reconnect(maxRetries int, backoff Backoff) *Client {
+	c.reconnect = true
+	c.maxRetries = maxRetries
+	if backoff != nil {
+		c.backoff = backoff
+	}
+	return c
+}
+
+// OnError sets a callback function to be called on every error the client
+// encounters, including errors returned by the message handler.
+//
+// If no callback is set, errors are logged.
+func (c *Client) OnError(f func(error)) *Client {
+	c.onError = f
+	return c
+}
+
+// reportError passes the error to the error callback.
+func (c *Client) reportError(err error) {
+	if c.onError == nil {
+		log.Printf("client error: %s", err)
+		return
 	}
+	c.onError(err)
+}
 
+// Run connects to the server and handle messages until the context is
+// cancelled, or until the connection ends and no reconnection is allowed.
+//
+// Run returns nil if the context is cancelled or the server closed the
+// connection. Otherwise it returns the last error encountered.
+func (c *Client) Run(ctx context.Context) error {
+	retries := 0
 	for {
-		m, err := sess.ReadMessage()
-		if err == io.EOF {
+		connected, err := c.runSession(ctx)
+		if ctx.Err() != nil {
+			// Context cancelled. Shutdown cleanly.
 			return nil
 		}
 		if err != nil {
-			log.Printf("unexpected read error: %s", err)
-			continue
+			c.reportError(err)
+		}
+		if !c.reconnect {
+			return err
 		}
 
-		if sess == tempSess && m.SessionID() == "" {
-			sessionID = m.SessionID()
-			sess = NewSession(sessionID, conn)
+		// Only count consecutive failures.
+		if connected {
+			retries = 0
+		}
+		retries++
+		if c.maxRetries > 0 && retries > c.maxRetries {
+			return fmt.Errorf("giving up after %d retries: %w", c.maxRetries, err)
 		}
 
-		err = mh.HandleMessage(WithSessionID(context.Background(), sessionID), m, sess)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.backoff(retries)):
+		}
+	}
+}
+
+// runSession dials and handles a single session.
+//
+// connected reports if the session was successfully initialized.
+// err is nil if the session ended because the server closed it.
+func (c *Client) runSession(ctx context.Context) (connected bool, err error) {
+	conn, err := c.dialer.Dial(ctx)
+	if err != nil {
+		return false, fmt.Errorf("dial error: %w", err)
+	}
+
+	// Close the connection when the context is cancelled so that
+	// any blocking read will return.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	// Obtain the session ID from the greeting message.
+	sess, greeting, err := NewSessionFromConn(conn)
+	if err != nil {
+		conn.Close()
+		return false, fmt.Errorf("handshake error: %w", err)
+	}
+	defer sess.Close()
+
+	// Signal message handler to initialize.
+	sctx := WithSessionID(ctx, sess.ID())
+	err = c.handler.HandleMessage(sctx, NewSignal("client:init", greeting), sess)
+	if err != nil {
+		return false, fmt.Errorf("init error: %w", err)
+	}
+
+	for {
+		m, err := sess.ReadMessage()
+		if err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return true, nil
+			}
+			return true, fmt.Errorf("read error: %w", err)
+		}
+
+		err = c.handler.HandleMessage(sctx, m, sess)
 		if err != nil {
-			log.Printf("unexpected handle error: %s", err)
+			c.reportError(fmt.Errorf("handle error: %w", err))
 		}
 	}
 }
+
+// StartClient handles messages from the connection with the message
+// handler until the connection is closed.
+//
+// Deprecated: use NewClient and Client.Run instead.
+func StartClient(mh MessageHandler, conn net.Conn) (err error) {
+	dialer := DialerFunc(func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return conn, nil
+	})
+	return NewClient(dialer, mh).Run(context.Background())
+}
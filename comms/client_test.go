@@ -0,0 +1,180 @@
+package comms_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+)
+
+// recordingMessageHandler records all messages and the session ID
+// in context on handling.
+type recordingMessageHandler struct {
+	messages   chan comms.Message
+	sessionIDs chan string
+}
+
+func (mh *recordingMessageHandler) HandleMessage(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+	mh.sessionIDs <- comms.GetSessionID(ctx)
+	mh.messages <- m
+	return nil
+}
+
+func newRecordingMessageHandler(size int) *recordingMessageHandler {
+	return &recordingMessageHandler{
+		messages:   make(chan comms.Message, size),
+		sessionIDs: make(chan string, size),
+	}
+}
+
+func TestClient_Run(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	dialer := comms.DialerFunc(func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return clientConn, nil
+	})
+
+	// Greet the client, then send an event.
+	go func() {
+		sess := comms.NewSession("session-1", serverConn)
+		sess.WriteMessage(comms.NewGreeting("session-1"))
+		sess.WriteMessage(comms.NewEvent("test:event", nil))
+	}()
+
+	mh := newRecordingMessageHandler(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- comms.NewClient(dialer, mh).Run(ctx)
+	}()
+
+	// The first message should be the init signal.
+	m := <-mh.messages
+	if want, have := "signal", m.Type(); want != have {
+		t.Fatalf("unexpected message type. want %#v, have %#v", want, have)
+	}
+	if want, have := "client:init", m.(comms.Signal).Signal(); want != have {
+		t.Errorf("unexpected signal. want %#v, have %#v", want, have)
+	}
+	if want, have := "session-1", <-mh.sessionIDs; want != have {
+		t.Errorf("unexpected session ID in context. want %#v, have %#v", want, have)
+	}
+	greeting := struct {
+		SessionID string `json:"sessionID"`
+	}{}
+	m.ReadDataTo(&greeting)
+	if want, have := "session-1", greeting.SessionID; want != have {
+		t.Errorf("unexpected greeting in signal data. want %#v, have %#v", want, have)
+	}
+
+	// Then the event from server.
+	m = <-mh.messages
+	if want, have := "test:event", m.(comms.Event).EventType(); want != have {
+		t.Errorf("unexpected event type. want %#v, have %#v", want, have)
+	}
+	if want, have := "session-1", <-mh.sessionIDs; want != have {
+		t.Errorf("unexpected session ID in context. want %#v, have %#v", want, have)
+	}
+
+	// Cancel the context and the client should stop cleanly.
+	cancel()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("client did not stop after context cancelled")
+	}
+}
+
+func TestClient_Run_ServerClose(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	dialer := comms.DialerFunc(func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return clientConn, nil
+	})
+
+	go func() {
+		comms.NewSession("session-1", serverConn).WriteMessage(comms.NewGreeting("session-1"))
+		serverConn.Close()
+	}()
+
+	mh := newRecordingMessageHandler(10)
+	if err := comms.NewClient(dialer, mh).Run(context.Background()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if want, have := 1, len(mh.messages); want != have {
+		t.Errorf("unexpected number of messages handled. want %d, have %d", want, have)
+	}
+}
+
+func TestClient_Run_Reconnect(t *testing.T) {
+	lock := &sync.Mutex{}
+	dials := 0
+	errs := make([]error, 0)
+
+	// Only the 3rd attempt will connect. The server will close
+	// the connection right after greeting.
+	dialer := comms.DialerFunc(func(ctx context.Context) (io.ReadWriteCloser, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		dials++
+		if dials != 3 {
+			return nil, fmt.Errorf("dummy dial error %d", dials)
+		}
+		serverConn, clientConn := net.Pipe()
+		go func() {
+			comms.NewSession("session-1", serverConn).WriteMessage(comms.NewGreeting("session-1"))
+			serverConn.Close()
+		}()
+		return clientConn, nil
+	})
+
+	mh := newRecordingMessageHandler(10)
+	err := comms.NewClient(dialer, mh).
+		Reconnect(2, comms.ConstantBackoff(0)).
+		OnError(func(err error) {
+			lock.Lock()
+			errs = append(errs, err)
+			lock.Unlock()
+		}).
+		Run(context.Background())
+	if err == nil {
+		t.Errorf("expected error after running out of retries")
+	}
+
+	// 2 failed dials, 1 success, then 2 more failed before giving up.
+	if want, have := 5, dials; want != have {
+		t.Errorf("unexpected number of dials. want %d, have %d", want, have)
+	}
+	if want, have := 4, len(errs); want != have {
+		t.Errorf("unexpected number of errors reported. want %d, have %d", want, have)
+	}
+	if want, have := 1, len(mh.messages); want != have {
+		t.Errorf("unexpected number of messages handled. want %d, have %d", want, have)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := comms.ExponentialBackoff(100*time.Millisecond, time.Second)
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	}
+	for _, test := range tests {
+		if have := b(test.attempt); test.want != have {
+			t.Errorf("attempt %d: want %s, have %s", test.attempt, test.want, have)
+		}
+	}
+}
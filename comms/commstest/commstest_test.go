@@ -0,0 +1,127 @@
+package commstest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+	"github.com/yookoala/botgame-playground/comms/commstest"
+)
+
+// echoHandler responds to every request with the request data.
+// Request of type "shout" is also broadcasted as an event.
+func echoHandler(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+	req, ok := m.(comms.Request)
+	if !ok || m.Type() != "request" {
+		return nil
+	}
+	var data interface{}
+	req.ReadDataTo(&data)
+	if req.RequestType() == "shout" {
+		mw.WriteMessage(comms.NewEvent("shout", data))
+	}
+	return mw.WriteMessage(comms.NewResponse(
+		comms.GetSessionID(ctx),
+		req.RequestID(),
+		req.RequestType(),
+		200,
+		"success",
+		data,
+	))
+}
+
+func TestListener(t *testing.T) {
+	l := commstest.NewListener()
+
+	accepted := make(chan error)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Write([]byte("hello\n"))
+		}
+		accepted <- err
+	}()
+
+	conn, err := l.DialConn(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error dialing: %s", err)
+	}
+	b := make([]byte, 6)
+	if _, err := conn.Read(b); err != nil {
+		t.Fatalf("unexpected error reading: %s", err)
+	}
+	if want, have := "hello\n", string(b); want != have {
+		t.Errorf("unexpected data. want %#v, have %#v", want, have)
+	}
+	if err := <-accepted; err != nil {
+		t.Errorf("unexpected error accepting: %s", err)
+	}
+
+	// Closed listener should neither accept nor dial.
+	l.Close()
+	if _, err := l.Accept(); err == nil {
+		t.Errorf("expected error accepting from closed listener")
+	}
+	if _, err := l.DialConn(context.Background()); err == nil {
+		t.Errorf("expected error dialing closed listener")
+	}
+}
+
+func TestHarness(t *testing.T) {
+	h := commstest.NewHarness(t, comms.MessageHandlerFunc(echoHandler))
+	c1 := h.Connect()
+	c2 := h.Connect()
+
+	if c1.ID() == "" || c1.ID() == c2.ID() {
+		t.Fatalf("unexpected session IDs: %#v, %#v", c1.ID(), c2.ID())
+	}
+	if want, have := "greeting", c1.Greeting.Type(); want != have {
+		t.Errorf("unexpected greeting type. want %#v, have %#v", want, have)
+	}
+
+	// Response is only sent to the requesting client.
+	reqID := c1.Request("echo", "hello")
+	resp := c1.ExpectResponseCode(reqID, 200)
+	var data string
+	resp.ReadDataTo(&data)
+	if want, have := "hello", data; want != have {
+		t.Errorf("unexpected response data. want %#v, have %#v", want, have)
+	}
+	c2.ExpectNoMessage(10 * time.Millisecond)
+
+	// Events are broadcasted to all clients.
+	reqID = c2.Request("shout", "hi all")
+	c1.ExpectEvent("shout")
+	c2.ExpectResponseCode(reqID, 200)
+	c2.ExpectEvent("shout") // kept from before the response
+}
+
+func TestHarness_WithClient(t *testing.T) {
+	h := commstest.NewHarness(t, comms.MessageHandlerFunc(echoHandler))
+
+	// The listener can be used as a comms.Dialer.
+	received := make(chan comms.Message, 10)
+	cli := comms.NewClient(h.Listener, comms.MessageHandlerFunc(
+		func(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+			if m.Type() == "signal" {
+				return mw.WriteMessage(comms.NewRequest("1", "echo", "from client"))
+			}
+			received <- m
+			return nil
+		},
+	))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cli.Run(ctx)
+
+	select {
+	case m := <-received:
+		if want, have := "1", m.(comms.Response).RequestID(); want != have {
+			t.Errorf("unexpected request ID. want %#v, have %#v", want, have)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for response")
+	}
+}
@@ -0,0 +1,258 @@
+package commstest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+)
+
+// DefaultTimeout is the default time for a FakeClient to wait for
+// an expected message.
+const DefaultTimeout = time.Second
+
+// Harness runs a MessageHandler behind a SimpleMessageQueue and a
+// SimpleMessageBroker, served with an in-memory Listener.
+type Harness struct {
+	Listener *Listener
+	Sessions comms.SessionCollection
+	Queue    *comms.SimpleMessageQueue
+	Broker   *comms.SimpleMessageBroker
+
+	t       testing.TB
+	lock    *sync.Mutex
+	clients []*FakeClient
+}
+
+// NewHarness starts serving the message handler in-memory. If the
+// message handler is also a comms.EventProjector, events are projected
+// for each session like in rooms.
+//
+// The harness is closed automatically when the test ends.
+func NewHarness(t testing.TB, mh comms.MessageHandler) *Harness {
+	t.Helper()
+
+	sc := comms.NewSessionCollection()
+	h := &Harness{
+		Listener: NewListener(),
+		Sessions: sc,
+		Queue:    comms.NewSimpleMessageQueue(sc, 0),
+		Broker:   comms.NewSimpleMessageBroker(sc),
+
+		t:       t,
+		lock:    &sync.Mutex{},
+		clients: make([]*FakeClient, 0),
+	}
+	if p, ok := mh.(comms.EventProjector); ok {
+		h.Broker.Project(p)
+	}
+	h.Queue.Start(mh, h.Broker)
+	go comms.StartServer(h.Listener, h.Queue)
+	t.Cleanup(h.Close)
+	return h
+}
+
+// Connect connects a new FakeClient to the harness. Returns after the
+// greeting is received and the session is added to the session collection.
+func (h *Harness) Connect() *FakeClient {
+	h.t.Helper()
+
+	conn, err := h.Listener.DialConn(context.Background())
+	if err != nil {
+		h.t.Fatalf("error connecting to harness: %s", err)
+	}
+	sess, greeting, err := comms.NewSessionFromConn(conn)
+	if err != nil {
+		h.t.Fatalf("error reading greeting: %s", err)
+	}
+
+	c := newFakeClient(h.t, sess, greeting)
+	h.lock.Lock()
+	h.clients = append(h.clients, c)
+	h.lock.Unlock()
+
+	// Wait until the server is ready to read from the session.
+	deadline := time.Now().Add(c.Timeout)
+	for !h.Sessions.Has(sess.ID()) {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timeout waiting for session %s to be added", sess.ID())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return c
+}
+
+// Close stops the server and closes all client connections.
+func (h *Harness) Close() {
+	h.Listener.Close()
+
+	h.lock.Lock()
+	clients := h.clients
+	h.clients = nil
+	h.lock.Unlock()
+	for _, c := range clients {
+		c.Close()
+	}
+
+	h.Queue.Stop()
+}
+
+// FakeClient is a scripted client session connected to a Harness.
+type FakeClient struct {
+	Session  *comms.Session
+	Greeting comms.Message
+
+	// Timeout is the time to wait for an expected message.
+	Timeout time.Duration
+
+	t       testing.TB
+	inbox   chan comms.Message
+	backlog []comms.Message
+	nextID  int
+}
+
+// newFakeClient creates a FakeClient and start reading from the session.
+func newFakeClient(t testing.TB, sess *comms.Session, greeting comms.Message) *FakeClient {
+	c := &FakeClient{
+		Session:  sess,
+		Greeting: greeting,
+		Timeout:  DefaultTimeout,
+
+		t:       t,
+		inbox:   make(chan comms.Message, 1024),
+		backlog: make([]comms.Message, 0),
+	}
+
+	// Keep reading so that the server never blocks on writing.
+	go func() {
+		defer close(c.inbox)
+		for {
+			m, err := sess.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.inbox <- m
+		}
+	}()
+	return c
+}
+
+// ID returns the session ID of the client.
+func (c *FakeClient) ID() string {
+	return c.Session.ID()
+}
+
+// Send sends a message to the server.
+func (c *FakeClient) Send(m comms.Message) {
+	c.t.Helper()
+	if err := c.Session.WriteMessage(m); err != nil {
+		c.t.Fatalf("[%s] error sending message: %s", c.ID(), err)
+	}
+}
+
+// Request sends a request with an auto-generated request ID to the
+// server. Returns the request ID.
+func (c *FakeClient) Request(requestType string, data interface{}) string {
+	c.t.Helper()
+	c.nextID++
+	requestID := fmt.Sprintf("%s-%d", c.ID(), c.nextID)
+	c.Send(comms.NewRequest(requestID, requestType, data))
+	return requestID
+}
+
+// Expect waits for the first message that matches. Messages that do not
+// match are kept for later expectations. Fails the test on timeout.
+func (c *FakeClient) Expect(desc string, match func(comms.Message) bool) comms.Message {
+	c.t.Helper()
+
+	// Look into previously received messages first.
+	for i, m := range c.backlog {
+		if match(m) {
+			c.backlog = append(c.backlog[:i], c.backlog[i+1:]...)
+			return m
+		}
+	}
+
+	timeout := time.After(c.Timeout)
+	for {
+		select {
+		case m, ok := <-c.inbox:
+			if !ok {
+				c.t.Fatalf("[%s] connection closed while expecting %s", c.ID(), desc)
+				return nil
+			}
+			if match(m) {
+				return m
+			}
+			c.backlog = append(c.backlog, m)
+		case <-timeout:
+			c.t.Fatalf("[%s] timeout expecting %s", c.ID(), desc)
+			return nil
+		}
+	}
+}
+
+// Next waits for the next message of any kind.
+func (c *FakeClient) Next() comms.Message {
+	c.t.Helper()
+	return c.Expect("any message", func(m comms.Message) bool {
+		return true
+	})
+}
+
+// ExpectResponse waits for the response to the request.
+func (c *FakeClient) ExpectResponse(requestID string) comms.Response {
+	c.t.Helper()
+	m := c.Expect(fmt.Sprintf("response to request %#v", requestID), func(m comms.Message) bool {
+		resp, ok := m.(comms.Response)
+		return ok && m.Type() == "response" && resp.RequestID() == requestID
+	})
+	return m.(comms.Response)
+}
+
+// ExpectResponseCode waits for the response to the request and checks
+// the response code.
+func (c *FakeClient) ExpectResponseCode(requestID string, code int) comms.Response {
+	c.t.Helper()
+	resp := c.ExpectResponse(requestID)
+	if resp.Code() != code {
+		c.t.Errorf("[%s] unexpected response code to request %#v. want %d, have %d (response: %s)",
+			c.ID(), requestID, code, resp.Code(), resp)
+	}
+	return resp
+}
+
+// ExpectEvent waits for an event of the event type.
+func (c *FakeClient) ExpectEvent(eventType string) comms.Event {
+	c.t.Helper()
+	m := c.Expect(fmt.Sprintf("event %#v", eventType), func(m comms.Message) bool {
+		evt, ok := m.(comms.Event)
+		return ok && m.Type() == "event" && evt.EventType() == eventType
+	})
+	return m.(comms.Event)
+}
+
+// ExpectNoMessage checks that no message arrives within the duration.
+func (c *FakeClient) ExpectNoMessage(d time.Duration) {
+	c.t.Helper()
+	if len(c.backlog) > 0 {
+		c.t.Errorf("[%s] unexpected message: %s", c.ID(), c.backlog[0])
+		return
+	}
+	select {
+	case m, ok := <-c.inbox:
+		if ok {
+			c.backlog = append(c.backlog, m)
+			c.t.Errorf("[%s] unexpected message: %s", c.ID(), m)
+		}
+	case <-time.After(d):
+	}
+}
+
+// Close closes the client connection.
+func (c *FakeClient) Close() {
+	c.Session.Close()
+}
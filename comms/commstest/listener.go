@@ -0,0 +1,91 @@
+// Package commstest provides utilities for testing comms based
+// game servers without opening real sockets.
+package commstest
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+)
+
+// pipeAddr is the net.Addr of in-memory connections.
+type pipeAddr struct{}
+
+// Network returns the name of the network.
+func (pipeAddr) Network() string {
+	return "pipe"
+}
+
+// String returns the string form of the address.
+func (pipeAddr) String() string {
+	return "pipe"
+}
+
+// Listener is an in-memory net.Listener. Connections are created
+// with net.Pipe by dialing the listener.
+//
+// Implements both net.Listener and comms.Dialer interfaces.
+type Listener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   *sync.Once
+}
+
+// NewListener creates a new in-memory Listener.
+func NewListener() *Listener {
+	return &Listener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+		once:   &sync.Once{},
+	}
+}
+
+// Accept waits for and returns the next connection to the listener.
+//
+// Returns *net.OpError after the listener is closed, which
+// comms.StartServer treats as a normal shutdown.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, &net.OpError{Op: "accept", Net: "pipe", Addr: pipeAddr{}, Err: net.ErrClosed}
+	}
+}
+
+// Close closes the listener.
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+// Addr returns the listener's network address.
+func (l *Listener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// DialConn creates a new in-memory connection to the listener and
+// returns the client end of it. Blocks until the connection is accepted.
+func (l *Listener) DialConn(ctx context.Context) (net.Conn, error) {
+	var err error
+	serverConn, clientConn := net.Pipe()
+	select {
+	case l.conns <- serverConn:
+		return clientConn, nil
+	case <-l.closed:
+		err = &net.OpError{Op: "dial", Net: "pipe", Addr: pipeAddr{}, Err: net.ErrClosed}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	serverConn.Close()
+	clientConn.Close()
+	return nil, err
+}
+
+// Dial implements comms.Dialer interface.
+func (l *Listener) Dial(ctx context.Context) (io.ReadWriteCloser, error) {
+	return l.DialConn(ctx)
+}
@@ -11,6 +11,7 @@ const (
 	sessionIDKey contextKey = iota
 	sessionCollectionKey
 	loggerKey
+	identityKey
 )
 
 // WithSessionID returns a new context with the session ID.
@@ -54,3 +55,19 @@ func GetLogger(ctx context.Context) slog.Logger {
 	}
 	return v.(slog.Logger)
 }
+
+// WithIdentity returns a new context with the authenticated identity
+// of the session.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
+}
+
+// GetIdentity returns the authenticated identity from the context, or
+// empty string if the session is not authenticated.
+func GetIdentity(ctx context.Context) string {
+	v := ctx.Value(identityKey)
+	if v == nil {
+		return ""
+	}
+	return v.(string)
+}
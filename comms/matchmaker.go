@@ -0,0 +1,421 @@
+package comms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultMatchRating is the rating of a matchmake request that does
+// not specify one.
+const DefaultMatchRating = 1500
+
+// MatchTicket is a session waiting in the matchmaking queue.
+type MatchTicket struct {
+	SessionID string
+	Game      string
+	Rating    float64
+	Since     time.Time
+}
+
+// MatchPolicy decides which waiting sessions are paired.
+type MatchPolicy interface {
+	// Match returns the indexes of 2 tickets to be paired, or ok=false
+	// if no pair should be formed now. The tickets are of the same game,
+	// ordered by the time they joined the queue.
+	Match(tickets []MatchTicket, now time.Time) (i, j int, ok bool)
+}
+
+// MatchPolicyFunc is an adapter to allow the use of ordinary functions as MatchPolicy.
+type MatchPolicyFunc func(tickets []MatchTicket, now time.Time) (i, j int, ok bool)
+
+// Match implements MatchPolicy.
+func (f MatchPolicyFunc) Match(tickets []MatchTicket, now time.Time) (i, j int, ok bool) {
+	return f(tickets, now)
+}
+
+// FIFOPolicy pairs sessions in the order they joined the queue,
+// regardless of rating.
+func FIFOPolicy() MatchPolicy {
+	return MatchPolicyFunc(func(tickets []MatchTicket, now time.Time) (i, j int, ok bool) {
+		if len(tickets) < 2 {
+			return 0, 0, false
+		}
+		return 0, 1, true
+	})
+}
+
+// ClosestRatingPolicy pairs the 2 sessions with the closest ratings.
+// Ties are broken in favour of the sessions waited longer.
+func ClosestRatingPolicy() MatchPolicy {
+	return MatchPolicyFunc(func(tickets []MatchTicket, now time.Time) (i, j int, ok bool) {
+		best := math.Inf(1)
+		for a := range tickets {
+			for b := a + 1; b < len(tickets); b++ {
+				if d := math.Abs(tickets[a].Rating - tickets[b].Rating); d < best {
+					best, i, j, ok = d, a, b, true
+				}
+			}
+		}
+		return
+	})
+}
+
+// WideningWindowPolicy pairs a session with the closest rated session
+// within its rating window. The window starts at initial, and widens by
+// growth every second the session waits, up to maxWindow. Zero maxWindow
+// means the window widens without limit.
+//
+// The sessions waited longer are paired first.
+func WideningWindowPolicy(initial, growth, maxWindow float64) MatchPolicy {
+	return MatchPolicyFunc(func(tickets []MatchTicket, now time.Time) (i, j int, ok bool) {
+		for a := range tickets {
+			window := initial + growth*now.Sub(tickets[a].Since).Seconds()
+			if maxWindow > 0 && window > maxWindow {
+				window = maxWindow
+			}
+			best := math.Inf(1)
+			for b := range tickets {
+				if a == b {
+					continue
+				}
+				d := math.Abs(tickets[a].Rating - tickets[b].Rating)
+				if d <= window && d < best {
+					best, i, j, ok = d, a, b, true
+				}
+			}
+			if ok {
+				return
+			}
+		}
+		return
+	})
+}
+
+// MatchInfo is the data of a "match:found" event.
+type MatchInfo struct {
+	Room    string   `json:"room"`
+	Game    string   `json:"game"`
+	Players []string `json:"players"`
+}
+
+// MatchError is the data of a "match:error" event.
+type MatchError struct {
+	Game  string `json:"game"`
+	Error string `json:"error"`
+}
+
+// Matchmaker pairs waiting sessions and moves them into a new room of
+// the RoomManager. Sessions join and leave the queue with requests:
+//
+//   - "matchmake": wait for a match. Data: {"game": "...", "rating": 1500}
+//     The rating of an authenticated session is the one resolved by
+//     the function set with RateBy, if any, not the one in data.
+//   - "matchmake:cancel": leave the queue.
+//
+// Both sessions are sent a "match:found" event when paired. If a paired
+// session cannot be moved into the room, it leaves the queue with a
+// "match:error" event, and the other session is put back to the queue.
+// All other messages are handled by the RoomManager.
+//
+// Implements MessageHandler interface.
+type Matchmaker struct {
+	rm     *RoomManager
+	policy MatchPolicy
+	now    func() time.Time
+	rating func(identity string) float64
+
+	tickets  []MatchTicket
+	sessions map[string]*Session
+
+	lock *sync.Mutex
+	stop chan struct{}
+}
+
+// NewMatchmaker creates a new Matchmaker that creates rooms with the
+// RoomManager and pairs sessions with the policy.
+func NewMatchmaker(rm *RoomManager, policy MatchPolicy) *Matchmaker {
+	return &Matchmaker{
+		rm:       rm,
+		policy:   policy,
+		now:      time.Now,
+		tickets:  make([]MatchTicket, 0),
+		sessions: make(map[string]*Session),
+		lock:     &sync.Mutex{},
+	}
+}
+
+// RateBy sets the function to resolve the rating of authenticated
+// sessions from their identity (e.g. the rating in a ladder), so that
+// they cannot claim a rating to pick their opponents.
+func (mm *Matchmaker) RateBy(f func(identity string) float64) *Matchmaker {
+	mm.lock.Lock()
+	mm.rating = f
+	mm.lock.Unlock()
+	return mm
+}
+
+// Start re-evaluates the queue at every interval, for policies that
+// pair differently as time goes by (e.g. WideningWindowPolicy).
+// Without Start, the queue is only evaluated on new matchmake requests.
+func (mm *Matchmaker) Start(interval time.Duration) {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+	if mm.stop != nil {
+		return
+	}
+	mm.stop = make(chan struct{})
+	go func(stop <-chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				mm.match()
+			}
+		}
+	}(mm.stop)
+}
+
+// Stop stops re-evaluating the queue.
+func (mm *Matchmaker) Stop() {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+	if mm.stop != nil {
+		close(mm.stop)
+		mm.stop = nil
+	}
+}
+
+// Waiting returns the tickets in the queue.
+func (mm *Matchmaker) Waiting() []MatchTicket {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+	return append([]MatchTicket{}, mm.tickets...)
+}
+
+// Enqueue adds the session to the matchmaking queue of the game, then
+// tries to pair it. Uses the default game of the RoomManager if game is
+// empty.
+func (mm *Matchmaker) Enqueue(s *Session, game string, rating float64) error {
+	if err := mm.add(s, game, rating); err != nil {
+		return err
+	}
+	mm.match()
+	return nil
+}
+
+// add adds the session to the matchmaking queue without pairing.
+func (mm *Matchmaker) add(s *Session, game string, rating float64) error {
+	game, ok := mm.rm.resolveGame(game)
+	if !ok {
+		return fmt.Errorf("unknown game: %s", game)
+	}
+	if mm.rm.RoomOf(s.ID()) != nil {
+		return fmt.Errorf("session %s already in a room", s.ID())
+	}
+
+	mm.lock.Lock()
+	if _, ok := mm.sessions[s.ID()]; ok {
+		mm.lock.Unlock()
+		return fmt.Errorf("session %s already in queue", s.ID())
+	}
+	mm.tickets = append(mm.tickets, MatchTicket{
+		SessionID: s.ID(),
+		Game:      game,
+		Rating:    rating,
+		Since:     mm.now(),
+	})
+	mm.sessions[s.ID()] = s
+	mm.lock.Unlock()
+
+	s.OnClose(func(s *Session) {
+		mm.Cancel(s.ID())
+	})
+	log.Printf("Matchmaker session %s waiting for %s (rating=%v)", s.ID(), game, rating)
+	return nil
+}
+
+// Cancel removes the session from the matchmaking queue.
+func (mm *Matchmaker) Cancel(sessionID string) error {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+	if _, ok := mm.sessions[sessionID]; !ok {
+		return fmt.Errorf("session %s not in queue", sessionID)
+	}
+	mm.remove(sessionID)
+	return nil
+}
+
+// remove removes the session from the queue. Caller should hold the lock.
+func (mm *Matchmaker) remove(sessionID string) {
+	delete(mm.sessions, sessionID)
+	for i, t := range mm.tickets {
+		if t.SessionID == sessionID {
+			mm.tickets = append(mm.tickets[:i], mm.tickets[i+1:]...)
+			return
+		}
+	}
+}
+
+// match pairs sessions in the queue until the policy finds no more pair.
+func (mm *Matchmaker) match() {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	now := mm.now()
+	for _, game := range mm.games() {
+		for {
+			tickets := make([]MatchTicket, 0, len(mm.tickets))
+			for _, t := range mm.tickets {
+				if t.Game == game {
+					tickets = append(tickets, t)
+				}
+			}
+			i, j, ok := mm.policy.Match(tickets, now)
+			if !ok || i == j || i < 0 || j < 0 || i >= len(tickets) || j >= len(tickets) {
+				break
+			}
+			mm.pair(game, tickets[i], tickets[j])
+		}
+	}
+}
+
+// games returns the games of the tickets in the queue, ordered by the
+// first ticket of each game. Caller should hold the lock.
+func (mm *Matchmaker) games() []string {
+	seen := make(map[string]bool)
+	games := make([]string, 0)
+	for _, t := range mm.tickets {
+		if !seen[t.Game] {
+			seen[t.Game] = true
+			games = append(games, t.Game)
+		}
+	}
+	return games
+}
+
+// pair moves the 2 sessions out of the queue and into a new room.
+// Caller should hold the lock.
+func (mm *Matchmaker) pair(game string, t1, t2 MatchTicket) {
+	tickets := []MatchTicket{t1, t2}
+	sessions := []*Session{mm.sessions[t1.SessionID], mm.sessions[t2.SessionID]}
+	mm.remove(t1.SessionID)
+	mm.remove(t2.SessionID)
+
+	r, err := mm.rm.CreateRoom("", game)
+	if err != nil {
+		log.Printf("Matchmaker error creating room: %s", err)
+		for _, s := range sessions {
+			mm.matchError(s, game, err)
+		}
+		return
+	}
+	joined := make([]int, 0, 2)
+	for i, s := range sessions {
+		if _, err := mm.rm.Join(r.ID(), s); err != nil {
+			log.Printf("Matchmaker error joining room: %s", err)
+			mm.matchError(s, game, err)
+			continue
+		}
+		joined = append(joined, i)
+	}
+	if len(joined) < 2 {
+		// Put the joined session back to the queue, or it will be
+		// left in the room waiting forever. The room is closed when
+		// it leaves, or now if no session joined.
+		if len(joined) == 0 {
+			mm.rm.CloseRoom(r.ID())
+		}
+		for _, i := range joined {
+			mm.rm.Leave(sessions[i].ID())
+			mm.tickets = append([]MatchTicket{tickets[i]}, mm.tickets...)
+			mm.sessions[tickets[i].SessionID] = sessions[i]
+		}
+		return
+	}
+
+	info := MatchInfo{
+		Room:    r.ID(),
+		Game:    game,
+		Players: []string{t1.SessionID, t2.SessionID},
+	}
+	log.Printf("Matchmaker paired %s and %s in room %s", t1.SessionID, t2.SessionID, r.ID())
+	for _, s := range sessions {
+		if err := s.WriteMessage(NewEvent("match:found", info)); err != nil {
+			log.Printf("Matchmaker error sending match to session %s: %s", s.ID(), err)
+		}
+	}
+}
+
+// matchError tells the session that it is out of the queue for the
+// error.
+func (mm *Matchmaker) matchError(s *Session, game string, err error) {
+	if err := s.WriteMessage(NewEvent("match:error", MatchError{Game: game, Error: err.Error()})); err != nil {
+		log.Printf("Matchmaker error sending match error to session %s: %s", s.ID(), err)
+	}
+}
+
+// HandleMessage handles matchmake requests, and sends other messages to
+// the RoomManager.
+//
+// Implements MessageHandler interface.
+func (mm *Matchmaker) HandleMessage(ctx context.Context, m Message, mw MessageWriter) error {
+	if m.Type() != "request" {
+		return mm.rm.HandleMessage(ctx, m, mw)
+	}
+	req := m.(Request)
+	sessionID := GetSessionID(ctx)
+
+	switch req.RequestType() {
+	case "matchmake":
+		data := struct {
+			Game   string   `json:"game"`
+			Rating *float64 `json:"rating"`
+		}{}
+		req.ReadDataTo(&data)
+		rating := float64(DefaultMatchRating)
+		if data.Rating != nil {
+			rating = *data.Rating
+		}
+		mm.lock.Lock()
+		rateBy := mm.rating
+		mm.lock.Unlock()
+		if identity := GetIdentity(ctx); identity != "" && rateBy != nil {
+			rating = rateBy(identity)
+		}
+
+		var s *Session
+		if sc := GetSessionCollection(ctx); sc != nil {
+			s = sc.Get(sessionID)
+		}
+		if s == nil {
+			return mw.WriteMessage(NewErrorResponse(sessionID, req.RequestID(), 404, "error", "session not found"))
+		}
+		if _, ok := mm.rm.resolveGame(data.Game); !ok {
+			return mw.WriteMessage(NewErrorResponse(sessionID, req.RequestID(), 400, "error", "unknown game: "+data.Game))
+		}
+		if err := mm.add(s, data.Game, rating); err != nil {
+			return mw.WriteMessage(NewErrorResponse(sessionID, req.RequestID(), 409, "error", err.Error()))
+		}
+
+		// Respond before pairing, so that the response arrives
+		// before the "match:found" event.
+		err := mw.WriteMessage(NewResponse(sessionID, req.RequestID(), req.RequestType(), 200, "success", "queued"))
+		mm.match()
+		return err
+
+	case "matchmake:cancel":
+		if err := mm.Cancel(sessionID); err != nil {
+			return mw.WriteMessage(NewErrorResponse(sessionID, req.RequestID(), 404, "error", err.Error()))
+		}
+		return mw.WriteMessage(NewResponse(sessionID, req.RequestID(), req.RequestType(), 200, "success", nil))
+	}
+
+	return mm.rm.HandleMessage(ctx, m, mw)
+}
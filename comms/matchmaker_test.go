@@ -0,0 +1,194 @@
+package comms_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+	"github.com/yookoala/botgame-playground/comms/commstest"
+)
+
+// tickets creates tickets of the ratings, which waited for the seconds
+// before now.
+func tickets(now time.Time, ratings []float64, waited []int) []comms.MatchTicket {
+	ts := make([]comms.MatchTicket, len(ratings))
+	for i, r := range ratings {
+		ts[i] = comms.MatchTicket{
+			SessionID: string(rune('a' + i)),
+			Rating:    r,
+			Since:     now.Add(-time.Duration(waited[i]) * time.Second),
+		}
+	}
+	return ts
+}
+
+func TestMatchPolicy(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		desc    string
+		policy  comms.MatchPolicy
+		tickets []comms.MatchTicket
+		ok      bool
+		i, j    int
+	}{
+		{
+			desc:    "fifo: not enough tickets",
+			policy:  comms.FIFOPolicy(),
+			tickets: tickets(now, []float64{1500}, []int{0}),
+		},
+		{
+			desc:    "fifo: first 2 tickets",
+			policy:  comms.FIFOPolicy(),
+			tickets: tickets(now, []float64{1000, 2000, 1000}, []int{3, 2, 1}),
+			ok:      true, i: 0, j: 1,
+		},
+		{
+			desc:    "closest: closest ratings",
+			policy:  comms.ClosestRatingPolicy(),
+			tickets: tickets(now, []float64{1000, 2000, 1100, 1950}, []int{4, 3, 2, 1}),
+			ok:      true, i: 1, j: 3,
+		},
+		{
+			desc:    "widening: out of window",
+			policy:  comms.WideningWindowPolicy(100, 10, 0),
+			tickets: tickets(now, []float64{1000, 1200}, []int{5, 0}),
+		},
+		{
+			desc:    "widening: window widened with time",
+			policy:  comms.WideningWindowPolicy(100, 10, 0),
+			tickets: tickets(now, []float64{1000, 1200}, []int{10, 0}),
+			ok:      true, i: 0, j: 1,
+		},
+		{
+			desc:    "widening: window limited",
+			policy:  comms.WideningWindowPolicy(100, 10, 150),
+			tickets: tickets(now, []float64{1000, 1200}, []int{60, 0}),
+		},
+		{
+			desc:    "widening: longer waited first",
+			policy:  comms.WideningWindowPolicy(100, 0, 0),
+			tickets: tickets(now, []float64{1000, 1500, 1550, 1520}, []int{4, 3, 2, 1}),
+			ok:      true, i: 1, j: 3,
+		},
+	}
+	for _, test := range tests {
+		i, j, ok := test.policy.Match(test.tickets, now)
+		if want, have := test.ok, ok; want != have {
+			t.Errorf("%s: unexpected ok. want %v, have %v", test.desc, want, have)
+			continue
+		}
+		if ok && (i != test.i || j != test.j) {
+			t.Errorf("%s: unexpected pair. want (%d, %d), have (%d, %d)", test.desc, test.i, test.j, i, j)
+		}
+	}
+}
+
+func TestMatchmaker(t *testing.T) {
+	rm := comms.NewRoomManager().Register("echo", 2, roomEchoHandler)
+	mm := comms.NewMatchmaker(rm, comms.ClosestRatingPolicy())
+	h := commstest.NewHarness(t, mm)
+	c1, c2, c3 := h.Connect(), h.Connect(), h.Connect()
+
+	c1.ExpectResponseCode(c1.Request("matchmake", map[string]interface{}{"rating": 1000}), 200)
+	c1.ExpectResponseCode(c1.Request("matchmake", nil), 409)
+	c2.ExpectResponseCode(c2.Request("matchmake", map[string]interface{}{"game": "no-such-game"}), 400)
+	c3.ExpectResponseCode(c3.Request("matchmake", map[string]interface{}{"game": "echo", "rating": 1200}), 200)
+
+	var info comms.MatchInfo
+	c1.ExpectEvent("match:found").ReadDataTo(&info)
+	if want, have := "echo", info.Game; want != have {
+		t.Errorf("unexpected game. want %#v, have %#v", want, have)
+	}
+	if want, have := []string{c1.ID(), c3.ID()}, info.Players; len(have) != 2 || want[0] != have[0] || want[1] != have[1] {
+		t.Errorf("unexpected players. want %#v, have %#v", want, have)
+	}
+	c3.ExpectEvent("match:found")
+	if r := rm.RoomOf(c1.ID()); r == nil || r.ID() != info.Room {
+		t.Errorf("expected session %s in room %s", c1.ID(), info.Room)
+	}
+	if r := rm.RoomOf(c3.ID()); r == nil || r.ID() != info.Room {
+		t.Errorf("expected session %s in room %s", c3.ID(), info.Room)
+	}
+
+	// Room messages are handled after the match.
+	var size int
+	c1.ExpectResponseCode(c1.Request("shout", nil), 200).ReadDataTo(&size)
+	if want, have := 2, size; want != have {
+		t.Errorf("unexpected room size. want %d, have %d", want, have)
+	}
+
+	// Cancel and closed sessions leave the queue.
+	c2.ExpectResponseCode(c2.Request("matchmake:cancel", nil), 404)
+	c2.ExpectResponseCode(c2.Request("matchmake", nil), 200)
+	c2.ExpectResponseCode(c2.Request("matchmake:cancel", nil), 200)
+	c2.ExpectResponseCode(c2.Request("matchmake", nil), 200)
+	c2.Close()
+	deadline := time.Now().Add(time.Second)
+	for len(mm.Waiting()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for closed session to leave the queue")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMatchmaker_CreateRoomError(t *testing.T) {
+	rm := comms.NewRoomManager().Register("broken", 2, func() comms.MessageHandler {
+		return nil
+	})
+	mm := comms.NewMatchmaker(rm, comms.FIFOPolicy())
+	h := commstest.NewHarness(t, mm)
+	c1, c2 := h.Connect(), h.Connect()
+
+	c1.ExpectResponseCode(c1.Request("matchmake", nil), 200)
+	c2.ExpectResponseCode(c2.Request("matchmake", nil), 200)
+
+	// Both sessions are told, instead of waiting forever.
+	for _, c := range []*commstest.FakeClient{c1, c2} {
+		var data comms.MatchError
+		c.ExpectEvent("match:error").ReadDataTo(&data)
+		if want, have := "broken", data.Game; want != have {
+			t.Errorf("unexpected game. want %#v, have %#v", want, have)
+		}
+		if data.Error == "" {
+			t.Errorf("expected error message")
+		}
+	}
+	if want, have := 0, len(mm.Waiting()); want != have {
+		t.Errorf("unexpected sessions waiting. want %d, have %d", want, have)
+	}
+	if want, have := 0, len(rm.Rooms()); want != have {
+		t.Errorf("unexpected rooms. want %d, have %d", want, have)
+	}
+
+	// The sessions may matchmake again.
+	c1.ExpectResponseCode(c1.Request("matchmake", nil), 200)
+}
+
+func TestMatchmaker_RateBy(t *testing.T) {
+	rm := comms.NewRoomManager().Register("echo", 2, roomEchoHandler)
+	never := comms.MatchPolicyFunc(func(tickets []comms.MatchTicket, now time.Time) (i, j int, ok bool) {
+		return 0, 0, false
+	})
+	mm := comms.NewMatchmaker(rm, never).RateBy(func(identity string) float64 {
+		return map[string]float64{"alice": 1800}[identity]
+	})
+	h := commstest.NewHarness(t, comms.NewAuthHandler(comms.TokenAuthenticator{"alice": "secret"}, mm))
+	c1, c2 := h.Connect(), h.Connect()
+
+	// The rating claimed by an authenticated session is ignored.
+	c1.ExpectResponseCode(c1.Request("auth", map[string]string{"token": "secret"}), 200)
+	c1.ExpectResponseCode(c1.Request("matchmake", map[string]interface{}{"rating": 1000}), 200)
+	c2.ExpectResponseCode(c2.Request("matchmake", map[string]interface{}{"rating": 1200}), 200)
+
+	ratings := make(map[string]float64)
+	for _, ticket := range mm.Waiting() {
+		ratings[ticket.SessionID] = ticket.Rating
+	}
+	if want, have := 1800.0, ratings[c1.ID()]; want != have {
+		t.Errorf("unexpected rating of authenticated session. want %v, have %v", want, have)
+	}
+	if want, have := 1200.0, ratings[c2.ID()]; want != have {
+		t.Errorf("unexpected rating of unauthenticated session. want %v, have %v", want, have)
+	}
+}
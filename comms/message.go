@@ -333,3 +333,13 @@ func NewErrorResponse(sessionID, requestID string, code int, response, errorStri
 		messageType: "response",
 	}
 }
+
+// NewErrorResponseWithData creates a new error response with data about
+// the error, e.g. the details for the client to correct the request.
+func NewErrorResponseWithData(sessionID, requestID string, code int, response, errorString string, data interface{}) ErrorResponse {
+	m := NewErrorResponse(sessionID, requestID, code, response, errorString).(*message)
+	if data != nil {
+		m.data, _ = json.Marshal(data)
+	}
+	return m
+}
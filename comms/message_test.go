@@ -148,3 +148,28 @@ func TestNewGreeting(t *testing.T) {
 		t.Errorf("type is not correct. expected %#v, got %#v", expected, actual)
 	}
 }
+
+func TestNewErrorResponseWithData(t *testing.T) {
+	m := comms.NewErrorResponseWithData("123", "req1", 400, "error", "invalid move", map[string]int{"x": 1})
+
+	b, _ := json.Marshal(m)
+	var resp comms.ErrorResponse
+	if msg, err := comms.NewMessageFromJSON(b); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else {
+		resp = msg.(comms.ErrorResponse)
+	}
+	if expected, actual := "invalid move", resp.ErrorString(); expected != actual {
+		t.Errorf("error string is not correct. expected %#v, got %#v", expected, actual)
+	}
+	if expected, actual := 400, resp.Code(); expected != actual {
+		t.Errorf("code is not correct. expected %#v, got %#v", expected, actual)
+	}
+	data := make(map[string]int)
+	if err := resp.ReadDataTo(&data); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected, actual := 1, data["x"]; expected != actual {
+		t.Errorf("data is not correct. expected %#v, got %#v", expected, actual)
+	}
+}
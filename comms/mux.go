@@ -0,0 +1,53 @@
+package comms
+
+import (
+	"context"
+	"sync"
+)
+
+// RequestMux routes requests to message handlers by request type.
+// Other messages, and requests of unregistered types, are sent to the
+// fallback message handler.
+//
+// Implements MessageHandler interface.
+type RequestMux struct {
+	handlers map[string]MessageHandler
+	fallback MessageHandler
+	lock     *sync.RWMutex
+}
+
+// NewRequestMux creates a new RequestMux. The fallback message handler
+// can be nil to ignore unrouted messages.
+func NewRequestMux(fallback MessageHandler) *RequestMux {
+	return &RequestMux{
+		handlers: make(map[string]MessageHandler),
+		fallback: fallback,
+		lock:     &sync.RWMutex{},
+	}
+}
+
+// Handle registers the message handler for the request type.
+func (mux *RequestMux) Handle(requestType string, mh MessageHandler) *RequestMux {
+	mux.lock.Lock()
+	mux.handlers[requestType] = mh
+	mux.lock.Unlock()
+	return mux
+}
+
+// HandleMessage sends the message to the handler of its request type.
+//
+// Implements MessageHandler interface.
+func (mux *RequestMux) HandleMessage(ctx context.Context, m Message, mw MessageWriter) error {
+	mh := mux.fallback
+	if req, ok := m.(Request); ok && m.Type() == "request" {
+		mux.lock.RLock()
+		if h, ok := mux.handlers[req.RequestType()]; ok {
+			mh = h
+		}
+		mux.lock.RUnlock()
+	}
+	if mh == nil {
+		return nil
+	}
+	return mh.HandleMessage(ctx, m, mw)
+}
@@ -0,0 +1,31 @@
+package comms_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yookoala/botgame-playground/comms"
+	"github.com/yookoala/botgame-playground/comms/commstest"
+)
+
+func TestRequestMux(t *testing.T) {
+	handled := func(name string) comms.MessageHandler {
+		return comms.MessageHandlerFunc(func(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+			req := m.(comms.Request)
+			return mw.WriteMessage(comms.NewResponse(comms.GetSessionID(ctx), req.RequestID(), req.RequestType(), 200, "success", name))
+		})
+	}
+	mux := comms.NewRequestMux(handled("fallback")).Handle("foo", handled("foo"))
+	h := commstest.NewHarness(t, mux)
+	c := h.Connect()
+
+	var name string
+	c.ExpectResponseCode(c.Request("foo", nil), 200).ReadDataTo(&name)
+	if want, have := "foo", name; want != have {
+		t.Errorf("unexpected handler. want %#v, have %#v", want, have)
+	}
+	c.ExpectResponseCode(c.Request("bar", nil), 200).ReadDataTo(&name)
+	if want, have := "fallback", name; want != have {
+		t.Errorf("unexpected handler. want %#v, have %#v", want, have)
+	}
+}
@@ -0,0 +1,224 @@
+package comms
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Direction is the direction of a recorded message.
+type Direction string
+
+const (
+	// DirectionInbound is for messages read from a session.
+	DirectionInbound Direction = "in"
+
+	// DirectionOutbound is for messages written to a session.
+	DirectionOutbound Direction = "out"
+)
+
+// TranscriptEntry is a single message recorded in a transcript.
+type TranscriptEntry struct {
+	Time      time.Time
+	Direction Direction
+	SessionID string
+	Message   Message
+}
+
+// jsonTranscriptEntry is the JSON representation of TranscriptEntry
+// for read-write to and from transcript files.
+type jsonTranscriptEntry struct {
+	Time      time.Time       `json:"time"`
+	Direction Direction       `json:"direction"`
+	SessionID string          `json:"sessionID"`
+	Message   json.RawMessage `json:"message"`
+}
+
+// Recorder appends every message passed through it to a JSONL
+// transcript. Each line is a TranscriptEntry.
+type Recorder struct {
+	w    io.Writer
+	lock *sync.Mutex
+	now  func() time.Time
+}
+
+// NewRecorder creates a new Recorder that writes transcript to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		w:    w,
+		lock: &sync.Mutex{},
+		now:  time.Now,
+	}
+}
+
+// OpenRecorder creates a new Recorder that appends transcript to
+// the file. The file is created if not exists.
+func OpenRecorder(filename string) (*Recorder, error) {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f), nil
+}
+
+// Record appends a message to the transcript.
+func (r *Recorder) Record(dir Direction, sessionID string, m Message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error marshalling message: %w", err)
+	}
+	b, err = json.Marshal(&jsonTranscriptEntry{
+		Time:      r.now(),
+		Direction: dir,
+		SessionID: sessionID,
+		Message:   b,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshalling transcript entry: %w", err)
+	}
+
+	// Write the whole line at once so that concurrent
+	// records will not interleave.
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_, err = r.w.Write(append(b, '\n'))
+	return err
+}
+
+// Close closes the underlying writer, if it is an io.Closer.
+func (r *Recorder) Close() error {
+	if cl, ok := r.w.(io.Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
+
+// RecordReader wraps the MessageReader to record every message read
+// as inbound message of the session.
+func (r *Recorder) RecordReader(sessionID string, mr MessageReader) MessageReader {
+	return &recordingReader{rec: r, sessionID: sessionID, mr: mr}
+}
+
+// RecordWriter wraps the MessageWriter to record every message written
+// as outbound message of the session.
+func (r *Recorder) RecordWriter(sessionID string, mw MessageWriter) MessageWriter {
+	return &recordingWriter{rec: r, sessionID: sessionID, mw: mw}
+}
+
+// RecordSession records all messages read from and written to the session.
+func (r *Recorder) RecordSession(s *Session) *Session {
+	return s.Intercept(func(mr MessageReader, mw MessageWriter) (MessageReader, MessageWriter) {
+		return r.RecordReader(s.ID(), mr), r.RecordWriter(s.ID(), mw)
+	})
+}
+
+// SessionHandler wraps the SessionHandler to record all sessions
+// before handing them over.
+//
+// Sessions from StartServer are greeted before handled. The greeting
+// is recorded as the first outbound message of the session.
+func (r *Recorder) SessionHandler(sh SessionHandler) SessionHandler {
+	return SessionHandlerFunc(func(s *Session) error {
+		if err := r.Record(DirectionOutbound, s.ID(), NewGreeting(s.ID())); err != nil {
+			log.Printf("error recording greeting of session %s: %s", s.ID(), err)
+		}
+		return sh.HandleSession(r.RecordSession(s))
+	})
+}
+
+// recordingReader records messages read from a MessageReader.
+type recordingReader struct {
+	rec       *Recorder
+	sessionID string
+	mr        MessageReader
+}
+
+// ReadMessage reads a message from the underlying reader and record it.
+func (rr *recordingReader) ReadMessage() (Message, error) {
+	m, err := rr.mr.ReadMessage()
+	if err != nil {
+		return m, err
+	}
+	if err := rr.rec.Record(DirectionInbound, rr.sessionID, m); err != nil {
+		log.Printf("error recording message of session %s: %s", rr.sessionID, err)
+	}
+	return m, nil
+}
+
+// recordingWriter records messages written to a MessageWriter.
+type recordingWriter struct {
+	rec       *Recorder
+	sessionID string
+	mw        MessageWriter
+}
+
+// WriteMessage writes the message to the underlying writer and record it.
+func (rw *recordingWriter) WriteMessage(m Message) error {
+	if err := rw.mw.WriteMessage(m); err != nil {
+		return err
+	}
+	if err := rw.rec.Record(DirectionOutbound, rw.sessionID, m); err != nil {
+		log.Printf("error recording message of session %s: %s", rw.sessionID, err)
+	}
+	return nil
+}
+
+// TranscriptReader reads a transcript written by Recorder.
+//
+// Implements MessageReader interface.
+type TranscriptReader struct {
+	r *bufio.Reader
+}
+
+// NewTranscriptReader creates a new TranscriptReader.
+func NewTranscriptReader(r io.Reader) *TranscriptReader {
+	return &TranscriptReader{r: bufio.NewReader(r)}
+}
+
+// ReadEntry reads the next entry of the transcript.
+// Returns io.EOF at the end of the transcript.
+func (tr *TranscriptReader) ReadEntry() (entry *TranscriptEntry, err error) {
+	var b []byte
+	for len(b) == 0 {
+		b, err = tr.r.ReadBytes('\n')
+		if err == io.EOF && len(bytes.TrimSpace(b)) > 0 {
+			// Last line without line break.
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		b = bytes.TrimSpace(b)
+	}
+
+	v := jsonTranscriptEntry{}
+	if err = json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("error unmarshalling transcript entry: %s, JSON: %s", err, string(b))
+	}
+	m, err := NewMessageFromJSON(v.Message)
+	if err != nil {
+		return nil, err
+	}
+	return &TranscriptEntry{
+		Time:      v.Time,
+		Direction: v.Direction,
+		SessionID: v.SessionID,
+		Message:   m,
+	}, nil
+}
+
+// ReadMessage reads the message of the next entry of the transcript.
+// Returns io.EOF at the end of the transcript.
+func (tr *TranscriptReader) ReadMessage() (Message, error) {
+	entry, err := tr.ReadEntry()
+	if err != nil {
+		return nil, err
+	}
+	return entry.Message, nil
+}
@@ -0,0 +1,133 @@
+package comms_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yookoala/botgame-playground/comms"
+)
+
+func TestRecorder_RecordSession(t *testing.T) {
+	buf := &bytes.Buffer{}
+	rec := comms.NewRecorder(buf)
+
+	serverSess, clientSess := NewDummySessions("session-1", 1024)
+	rec.RecordSession(serverSess)
+
+	// Outbound message
+	if err := serverSess.WriteMessage(comms.NewEvent("test:event", nil)); err != nil {
+		t.Fatalf("unexpected error writing message: %s", err)
+	}
+	if _, err := clientSess.ReadMessage(); err != nil {
+		t.Fatalf("unexpected error reading message: %s", err)
+	}
+
+	// Inbound message
+	if err := clientSess.WriteMessage(comms.NewRequest("1", "test:request", nil)); err != nil {
+		t.Fatalf("unexpected error writing message: %s", err)
+	}
+	if _, err := serverSess.ReadMessage(); err != nil {
+		t.Fatalf("unexpected error reading message: %s", err)
+	}
+
+	// Read back the transcript.
+	tr := comms.NewTranscriptReader(buf)
+	entry, err := tr.ReadEntry()
+	if err != nil {
+		t.Fatalf("unexpected error reading entry: %s", err)
+	}
+	if want, have := comms.DirectionOutbound, entry.Direction; want != have {
+		t.Errorf("unexpected direction. want %#v, have %#v", want, have)
+	}
+	if want, have := "session-1", entry.SessionID; want != have {
+		t.Errorf("unexpected session ID. want %#v, have %#v", want, have)
+	}
+	if entry.Time.IsZero() {
+		t.Errorf("expected entry time to be set")
+	}
+	if want, have := "test:event", entry.Message.(comms.Event).EventType(); want != have {
+		t.Errorf("unexpected event type. want %#v, have %#v", want, have)
+	}
+
+	entry, err = tr.ReadEntry()
+	if err != nil {
+		t.Fatalf("unexpected error reading entry: %s", err)
+	}
+	if want, have := comms.DirectionInbound, entry.Direction; want != have {
+		t.Errorf("unexpected direction. want %#v, have %#v", want, have)
+	}
+	if want, have := "test:request", entry.Message.(comms.Request).RequestType(); want != have {
+		t.Errorf("unexpected request type. want %#v, have %#v", want, have)
+	}
+
+	if _, err := tr.ReadEntry(); err != io.EOF {
+		t.Errorf("expected io.EOF at the end of transcript, got %#v", err)
+	}
+}
+
+func TestRecorder_Concurrent(t *testing.T) {
+	buf := &bytes.Buffer{}
+	rec := comms.NewRecorder(buf)
+
+	const scale = 50
+	wg := &sync.WaitGroup{}
+	wg.Add(scale)
+	for i := 0; i < scale; i++ {
+		go func() {
+			rec.Record(comms.DirectionOutbound, "session-1", comms.NewEvent("test:event", strings.Repeat("x", 100)))
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	// Every line should be a complete message.
+	tr := comms.NewTranscriptReader(buf)
+	count := 0
+	for {
+		_, err := tr.ReadMessage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error reading message: %s", err)
+		}
+		count++
+	}
+	if want, have := scale, count; want != have {
+		t.Errorf("unexpected number of messages. want %d, have %d", want, have)
+	}
+}
+
+func TestOpenRecorder(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transcript.jsonl")
+
+	// Recorders opened later should append to the transcript.
+	for i := 0; i < 2; i++ {
+		rec, err := comms.OpenRecorder(filename)
+		if err != nil {
+			t.Fatalf("unexpected error opening recorder: %s", err)
+		}
+		rec.Record(comms.DirectionInbound, "session-1", comms.NewRequest("1", "test", nil))
+		rec.Close()
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatalf("unexpected error opening transcript: %s", err)
+	}
+	defer f.Close()
+	tr := comms.NewTranscriptReader(f)
+	for i := 0; i < 2; i++ {
+		if _, err := tr.ReadMessage(); err != nil {
+			t.Fatalf("unexpected error reading message %d: %s", i, err)
+		}
+	}
+	if _, err := tr.ReadMessage(); err != io.EOF {
+		t.Errorf("expected io.EOF at the end of transcript, got %#v", err)
+	}
+}
@@ -0,0 +1,144 @@
+//go:build linux
+
+package comms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// limitsEnv is the environment variable that tells a re-executed
+// server to run as the limits helper of a bot.
+const limitsEnv = "BOTGAME_LIMITS_HELPER"
+
+// limitsHelper is the instructions of the limits helper.
+type limitsHelper struct {
+	// Path is the executable of the bot.
+	Path string `json:"path"`
+
+	// FD is the pipe to report errors before the bot is executed.
+	FD int `json:"fd"`
+
+	// Rlimits are pairs of resource and value of the limits.
+	Rlimits [][2]uint64 `json:"rlimits"`
+}
+
+func init() {
+	if v, ok := os.LookupEnv(limitsEnv); ok {
+		runLimitsHelper(v)
+	}
+}
+
+// runLimitsHelper sets the resource limits of the process, then
+// executes the bot in place of it. Only returns by exiting, with the
+// error written to the pipe, if the bot cannot be executed.
+func runLimitsHelper(v string) {
+	h := limitsHelper{FD: 2}
+	err := json.Unmarshal([]byte(v), &h)
+	if err == nil {
+		syscall.CloseOnExec(h.FD)
+		for _, rl := range h.Rlimits {
+			lim := syscall.Rlimit{Cur: rl[1], Max: rl[1]}
+			if err = syscall.Setrlimit(int(rl[0]), &lim); err != nil {
+				err = fmt.Errorf("setrlimit %s=%d: %w", rlimitName(int(rl[0])), rl[1], err)
+				break
+			}
+		}
+	}
+	if err == nil {
+		env := make([]string, 0, len(os.Environ()))
+		for _, kv := range os.Environ() {
+			if !strings.HasPrefix(kv, limitsEnv+"=") {
+				env = append(env, kv)
+			}
+		}
+		err = syscall.Exec(h.Path, os.Args, env)
+		err = fmt.Errorf("exec %s: %w", h.Path, err)
+	}
+	fmt.Fprint(os.NewFile(uintptr(h.FD), "limits"), err)
+	os.Exit(127)
+}
+
+// rlimitName returns the name of the resource for errors.
+func rlimitName(resource int) string {
+	switch resource {
+	case syscall.RLIMIT_CPU:
+		return "RLIMIT_CPU"
+	case syscall.RLIMIT_AS:
+		return "RLIMIT_AS"
+	case syscall.RLIMIT_NOFILE:
+		return "RLIMIT_NOFILE"
+	}
+	return fmt.Sprintf("resource %d", resource)
+}
+
+// limitCommand makes the command run with the resource limits. The
+// command is started as the server itself (/proc/self/exe) in the
+// limits helper mode, which sets the limits with setrlimit(2), then
+// executes the bot. So the limits apply from the start of the bot,
+// and the process is the one of the bot. The arguments of the command
+// are not changed.
+//
+// The returned function must be called after the command is started,
+// or failed to start. It waits for the bot to be executed, and returns
+// the error if the limits cannot be set.
+func limitCommand(cmd *exec.Cmd, l Limits) (started func() error, err error) {
+	rlimits := make([][2]uint64, 0, 3)
+	if l.CPUTime > 0 {
+		// RLIMIT_CPU is in seconds. Round up to not be stricter than asked.
+		secs := uint64((l.CPUTime + 999999999) / 1000000000)
+		rlimits = append(rlimits, [2]uint64{syscall.RLIMIT_CPU, secs})
+	}
+	if l.Memory > 0 {
+		rlimits = append(rlimits, [2]uint64{syscall.RLIMIT_AS, l.Memory})
+	}
+	if l.OpenFiles > 0 {
+		rlimits = append(rlimits, [2]uint64{syscall.RLIMIT_NOFILE, l.OpenFiles})
+	}
+	if len(rlimits) == 0 {
+		return func() error { return nil }, nil
+	}
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, w)
+	b, _ := json.Marshal(limitsHelper{
+		Path:    cmd.Path,
+		FD:      2 + len(cmd.ExtraFiles),
+		Rlimits: rlimits,
+	})
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, limitsEnv+"="+string(b))
+	cmd.Path = "/proc/self/exe"
+
+	return func() error {
+		// The pipe is closed on exec, or after the helper wrote the
+		// error. Reads nothing if the process was not started.
+		w.Close()
+		defer r.Close()
+		if cmd.Process == nil {
+			return nil
+		}
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if len(msg) > 0 {
+			return errors.New(string(msg))
+		}
+		return nil
+	}, nil
+}
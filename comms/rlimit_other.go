@@ -0,0 +1,16 @@
+//go:build !linux
+
+package comms
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// limitCommand is only supported on linux.
+func limitCommand(cmd *exec.Cmd, l Limits) (started func() error, err error) {
+	if l != (Limits{}) {
+		return nil, fmt.Errorf("resource limits are only supported on linux")
+	}
+	return func() error { return nil }, nil
+}
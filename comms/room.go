@@ -0,0 +1,641 @@
+package comms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// roomQueueSize is the buffer size of the message queue of each room.
+const roomQueueSize = 16
+
+// MessageHandlerFactory creates a new MessageHandler, e.g. a new game
+// for every room. Returns nil if the message handler cannot be created,
+// which fails the creation of the room.
+type MessageHandlerFactory func() MessageHandler
+
+// RoomInfo is the public information of a room.
+type RoomInfo struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name,omitempty"`
+	Game     string   `json:"game"`
+	Sessions []string `json:"sessions"`
+	Paused   bool     `json:"paused,omitempty"`
+}
+
+// Pauser is a MessageHandler with timers (e.g. game clocks) to be
+// stopped while its room is paused.
+type Pauser interface {
+	Pause()
+	Resume()
+}
+
+// Leaver is a MessageHandler to be told when a session leaves its room,
+// e.g. to forfeit the game of a player who disconnected. Leave is called
+// after the session is removed from the room.
+type Leaver interface {
+	Leave(sessionID string, mw MessageWriter)
+}
+
+// Room is a subset of sessions with its own message queue, message
+// broker and message handler (e.g. a game).
+type Room struct {
+	id   string
+	name string
+	game string
+
+	sessions SessionCollection
+	queue    *SimpleMessageQueue
+	broker   *SimpleMessageBroker
+	handler  MessageHandler
+	writer   MessageWriter
+
+	// handlerLock serializes the message handler with Control.
+	handlerLock *sync.Mutex
+
+	// identities are of the sessions ever joined, kept after they left.
+	identities map[string]string
+
+	// resuming is true while Resume sends the held messages.
+	paused   bool
+	resuming bool
+	held     []ContextMessage
+	lock     *sync.Mutex
+}
+
+// newRoom creates a new room and starts dispatching messages in its
+// queue to the message handler. Events written by the message handler
+// are passed to onEvent before sent to the sessions. If the message
+// handler is also an EventProjector, events are projected for each
+// session in the room.
+func newRoom(id, name, game string, mh MessageHandler, onEvent func(*Room, Event)) *Room {
+	sc := NewSessionCollection()
+	r := &Room{
+		id:   id,
+		name: name,
+		game: game,
+
+		sessions: sc,
+		queue:    NewSimpleMessageQueue(sc, roomQueueSize),
+		broker:   NewSimpleMessageBroker(sc),
+		handler:  mh,
+
+		handlerLock: &sync.Mutex{},
+		identities:  make(map[string]string),
+		lock:        &sync.Mutex{},
+	}
+	if p, ok := mh.(EventProjector); ok {
+		r.broker.Project(p)
+	}
+	r.writer = &roomWriter{room: r, mw: r.broker, onEvent: onEvent}
+	r.queue.Dispatch(MessageHandlerFunc(func(ctx context.Context, m Message, mw MessageWriter) error {
+		r.handlerLock.Lock()
+		defer r.handlerLock.Unlock()
+		return r.handler.HandleMessage(ctx, m, mw)
+	}), r.writer)
+	return r
+}
+
+// roomWriter passes events to the onEvent callback of the room manager.
+type roomWriter struct {
+	room    *Room
+	mw      MessageWriter
+	onEvent func(*Room, Event)
+}
+
+// WriteMessage writes the message to the sessions in the room.
+func (w *roomWriter) WriteMessage(m Message) error {
+	if evt, ok := m.(Event); ok && m.Type() == "event" && w.onEvent != nil {
+		w.onEvent(w.room, evt)
+	}
+	return w.mw.WriteMessage(m)
+}
+
+// ID returns the room ID.
+func (r *Room) ID() string {
+	return r.id
+}
+
+// Name returns the room name.
+func (r *Room) Name() string {
+	return r.name
+}
+
+// Game returns the game type of the room.
+func (r *Room) Game() string {
+	return r.game
+}
+
+// Sessions returns the sessions in the room.
+func (r *Room) Sessions() SessionCollection {
+	return r.sessions
+}
+
+// Handler returns the message handler of the room.
+func (r *Room) Handler() MessageHandler {
+	return r.handler
+}
+
+// Broker returns the message broker of the room. Messages written
+// to the broker are sent to the sessions in the room.
+func (r *Room) Broker() *SimpleMessageBroker {
+	return r.broker
+}
+
+// Identity returns the identity the session had when it joined the
+// room, or empty string if it was not authenticated. The identity is
+// kept after the session left or closed, e.g. to rate a game forfeited
+// by a player who disconnected.
+func (r *Room) Identity(sessionID string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.identities[sessionID]
+}
+
+// Info returns the public information of the room.
+func (r *Room) Info() RoomInfo {
+	sessions := make([]string, 0, r.sessions.Len())
+	lock := &sync.Mutex{}
+	r.sessions.Map(func(s *Session) {
+		lock.Lock()
+		sessions = append(sessions, s.ID())
+		lock.Unlock()
+	})
+	sort.Strings(sessions)
+	return RoomInfo{
+		ID:       r.id,
+		Name:     r.name,
+		Game:     r.game,
+		Sessions: sessions,
+		Paused:   r.Paused(),
+	}
+}
+
+// Enqueue sends a message of the session to the message handler of
+// the room. The message handler will find the room's session collection
+// in the context. Messages are held while the room is paused.
+func (r *Room) Enqueue(ctx context.Context, sessionID string, m Message) error {
+	ctx = WithSessionCollection(ctx, r.sessions)
+	ctx = WithSessionID(ctx, sessionID)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.paused {
+		r.held = append(r.held, ContextMessage{Context: ctx, Message: m})
+		return nil
+	}
+	return r.queue.Enqueue(ctx, m)
+}
+
+// Control runs the function with the message handler of the room, and
+// the message writer to the sessions in the room. No message is handled
+// by the message handler while the function runs.
+func (r *Room) Control(f func(mh MessageHandler, mw MessageWriter) error) error {
+	r.handlerLock.Lock()
+	defer r.handlerLock.Unlock()
+	return f(r.handler, r.writer)
+}
+
+// Paused reports if the room is paused.
+func (r *Room) Paused() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.paused
+}
+
+// Pause holds messages from the sessions until Resume is called. The
+// message handler is paused if it is a Pauser. The sessions in the room
+// are sent a "game:pause" event.
+func (r *Room) Pause() error {
+	r.lock.Lock()
+	if r.paused {
+		r.lock.Unlock()
+		return fmt.Errorf("room %s already paused", r.id)
+	}
+	r.paused = true
+	r.lock.Unlock()
+
+	return r.Control(func(mh MessageHandler, mw MessageWriter) error {
+		if p, ok := mh.(Pauser); ok {
+			p.Pause()
+		}
+		return mw.WriteMessage(NewEvent("game:pause", nil))
+	})
+}
+
+// Resume sends the messages held since Pause to the message handler,
+// and resumes it if it is a Pauser. The sessions in the room are sent a
+// "game:resume" event.
+//
+// The room stays paused until all held messages are sent, so messages
+// arriving meanwhile are held and sent after them, in order.
+func (r *Room) Resume() error {
+	r.lock.Lock()
+	if !r.paused || r.resuming {
+		r.lock.Unlock()
+		return fmt.Errorf("room %s not paused", r.id)
+	}
+	r.resuming = true
+	r.lock.Unlock()
+
+	err := r.Control(func(mh MessageHandler, mw MessageWriter) error {
+		if p, ok := mh.(Pauser); ok {
+			p.Resume()
+		}
+		return mw.WriteMessage(NewEvent("game:resume", nil))
+	})
+	for {
+		// Enqueue without the lock, as the queue may be full.
+		r.lock.Lock()
+		held := r.held
+		r.held = nil
+		if len(held) == 0 {
+			r.paused, r.resuming = false, false
+			r.lock.Unlock()
+			return err
+		}
+		r.lock.Unlock()
+		for _, cm := range held {
+			if err := r.queue.Enqueue(cm.Context, cm.Message); err != nil {
+				r.lock.Lock()
+				r.paused, r.resuming, r.held = false, false, nil
+				r.lock.Unlock()
+				return err
+			}
+		}
+	}
+}
+
+// roomGame is a game type registered to RoomManager.
+type roomGame struct {
+	capacity int
+	factory  MessageHandlerFactory
+}
+
+// RoomManager hosts many rooms on one server. Sessions can create,
+// list, join and leave rooms with requests:
+//
+//   - "room:create": create a room and join it. Data: {"name": "...", "game": "..."}
+//   - "room:list": list all rooms.
+//   - "room:join": join the room. Data: {"room": "<room ID>"}. Without a room ID,
+//     join the oldest room of the game ({"game": "..."}) that is not full, or
+//     create one if there is none.
+//   - "room:leave": leave the current room.
+//
+// All other messages of a session are sent to the room of the session.
+// A room is closed when all sessions left.
+//
+// Implements MessageHandler interface.
+type RoomManager struct {
+	games       map[string]roomGame
+	defaultGame string
+	onEvent     []func(*Room, Event)
+	identity    func(sessionID string) string
+
+	rooms   map[string]*Room
+	members map[string]*Room
+	lastID  int
+
+	lock *sync.RWMutex
+}
+
+// NewRoomManager creates a new RoomManager.
+func NewRoomManager() *RoomManager {
+	return &RoomManager{
+		games:   make(map[string]roomGame),
+		rooms:   make(map[string]*Room),
+		members: make(map[string]*Room),
+		lock:    &sync.RWMutex{},
+	}
+}
+
+// Register registers a game type with the factory to create the message
+// handler for every room of the game. The first registered game is the
+// default game for requests that do not specify one.
+//
+// Rooms with less sessions than capacity are open for quick join.
+// Explicitly joining with room ID is always allowed.
+func (rm *RoomManager) Register(game string, capacity int, factory MessageHandlerFactory) *RoomManager {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	if rm.defaultGame == "" {
+		rm.defaultGame = game
+	}
+	rm.games[game] = roomGame{capacity: capacity, factory: factory}
+	return rm
+}
+
+// OnEvent adds a callback function to be called with every event
+// written by the message handlers of the rooms (e.g. to record game
+// results). Callbacks are called before the event is sent to sessions.
+func (rm *RoomManager) OnEvent(f func(r *Room, evt Event)) *RoomManager {
+	rm.lock.Lock()
+	rm.onEvent = append(rm.onEvent, f)
+	rm.lock.Unlock()
+	return rm
+}
+
+// Identify sets the function to resolve the identity of sessions (e.g.
+// AuthHandler.Identity) as they join rooms. See Room.Identity.
+func (rm *RoomManager) Identify(f func(sessionID string) string) *RoomManager {
+	rm.lock.Lock()
+	rm.identity = f
+	rm.lock.Unlock()
+	return rm
+}
+
+// handleRoomEvent calls the OnEvent callbacks.
+func (rm *RoomManager) handleRoomEvent(r *Room, evt Event) {
+	rm.lock.RLock()
+	callbacks := rm.onEvent
+	rm.lock.RUnlock()
+	for _, f := range callbacks {
+		f(r, evt)
+	}
+}
+
+// resolveGame returns the game, or the default game if empty. Reports
+// if the game is registered.
+func (rm *RoomManager) resolveGame(game string) (string, bool) {
+	rm.lock.RLock()
+	defer rm.lock.RUnlock()
+	if game == "" {
+		game = rm.defaultGame
+	}
+	_, ok := rm.games[game]
+	return game, ok
+}
+
+// CreateRoom creates a new room of the game. Uses the default game if
+// game is empty.
+func (rm *RoomManager) CreateRoom(name, game string) (*Room, error) {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	return rm.createRoom(name, game)
+}
+
+// createRoom creates a new room. Caller should hold the lock.
+func (rm *RoomManager) createRoom(name, game string) (*Room, error) {
+	if game == "" {
+		game = rm.defaultGame
+	}
+	g, ok := rm.games[game]
+	if !ok {
+		return nil, fmt.Errorf("unknown game: %s", game)
+	}
+
+	mh := g.factory()
+	if mh == nil {
+		return nil, fmt.Errorf("error creating game: %s", game)
+	}
+	rm.lastID++
+	r := newRoom("room-"+strconv.Itoa(rm.lastID), name, game, mh, rm.handleRoomEvent)
+	r.sessions.OnRemove(func(s *Session) {
+		// Session closed.
+		rm.Leave(s.ID())
+	})
+	rm.rooms[r.id] = r
+	log.Printf("RoomManager created room %s (game=%s)", r.id, r.game)
+	return r, nil
+}
+
+// Room returns the room of the room ID, or nil if not found.
+func (rm *RoomManager) Room(id string) *Room {
+	rm.lock.RLock()
+	defer rm.lock.RUnlock()
+	return rm.rooms[id]
+}
+
+// Rooms returns all rooms, ordered by creation.
+func (rm *RoomManager) Rooms() []*Room {
+	rm.lock.RLock()
+	defer rm.lock.RUnlock()
+	return rm.sortedRooms()
+}
+
+// sortedRooms returns all rooms ordered by creation.
+// Caller should hold the lock.
+func (rm *RoomManager) sortedRooms() []*Room {
+	rooms := make([]*Room, 0, len(rm.rooms))
+	for _, r := range rm.rooms {
+		rooms = append(rooms, r)
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		a, _ := strconv.Atoi(rooms[i].id[len("room-"):])
+		b, _ := strconv.Atoi(rooms[j].id[len("room-"):])
+		return a < b
+	})
+	return rooms
+}
+
+// RoomOf returns the room the session is in, or nil if not in any room.
+func (rm *RoomManager) RoomOf(sessionID string) *Room {
+	rm.lock.RLock()
+	defer rm.lock.RUnlock()
+	return rm.members[sessionID]
+}
+
+// Join adds the session to the room.
+func (rm *RoomManager) Join(roomID string, s *Session) (*Room, error) {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	r, ok := rm.rooms[roomID]
+	if !ok {
+		return nil, fmt.Errorf("room not found: %s", roomID)
+	}
+	return r, rm.join(r, s)
+}
+
+// QuickJoin adds the session to the oldest room of the game that is not
+// full. A new room is created if there is none.
+func (rm *RoomManager) QuickJoin(game string, s *Session) (*Room, error) {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	if game == "" {
+		game = rm.defaultGame
+	}
+	g, ok := rm.games[game]
+	if !ok {
+		return nil, fmt.Errorf("unknown game: %s", game)
+	}
+	for _, r := range rm.sortedRooms() {
+		if r.game == game && (g.capacity <= 0 || r.sessions.Len() < g.capacity) {
+			return r, rm.join(r, s)
+		}
+	}
+	r, err := rm.createRoom("", game)
+	if err != nil {
+		return nil, err
+	}
+	return r, rm.join(r, s)
+}
+
+// join adds the session to the room. Caller should hold the lock.
+func (rm *RoomManager) join(r *Room, s *Session) error {
+	if _, ok := rm.members[s.ID()]; ok {
+		return fmt.Errorf("session %s already in a room", s.ID())
+	}
+	if err := r.sessions.Add(s); err != nil {
+		return err
+	}
+	rm.members[s.ID()] = r
+	if rm.identity != nil {
+		if identity := rm.identity(s.ID()); identity != "" {
+			r.lock.Lock()
+			r.identities[s.ID()] = identity
+			r.lock.Unlock()
+		}
+	}
+	log.Printf("RoomManager session %s joined room %s", s.ID(), r.id)
+	return nil
+}
+
+// Leave removes the session from its room. The room is closed if it
+// becomes empty. The message handler of the room is told if it is a
+// Leaver.
+func (rm *RoomManager) Leave(sessionID string) error {
+	rm.lock.Lock()
+	r, ok := rm.members[sessionID]
+	if !ok {
+		rm.lock.Unlock()
+		return fmt.Errorf("session %s not in any room", sessionID)
+	}
+	delete(rm.members, sessionID)
+	r.sessions.Remove(sessionID)
+	log.Printf("RoomManager session %s left room %s", sessionID, r.id)
+	if r.sessions.Len() == 0 {
+		rm.closeRoom(r)
+	}
+	rm.lock.Unlock()
+
+	// Tell the message handler without the lock, as it may write to
+	// the sessions.
+	return r.Control(func(mh MessageHandler, mw MessageWriter) error {
+		if l, ok := mh.(Leaver); ok {
+			l.Leave(sessionID, mw)
+		}
+		return nil
+	})
+}
+
+// CloseRoom removes all sessions from the room and stops its queue.
+// Sessions are not closed.
+func (rm *RoomManager) CloseRoom(id string) {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	if r, ok := rm.rooms[id]; ok {
+		rm.closeRoom(r)
+	}
+}
+
+// closeRoom closes the room. Caller should hold the lock.
+func (rm *RoomManager) closeRoom(r *Room) {
+	for id, member := range rm.members {
+		if member == r {
+			delete(rm.members, id)
+			r.sessions.Remove(id)
+		}
+	}
+	delete(rm.rooms, r.id)
+	r.queue.Stop()
+	log.Printf("RoomManager closed room %s", r.id)
+}
+
+// HandleMessage handles room requests, and sends other messages to the
+// room of the session.
+//
+// Implements MessageHandler interface.
+func (rm *RoomManager) HandleMessage(ctx context.Context, m Message, mw MessageWriter) error {
+	sessionID := GetSessionID(ctx)
+
+	if m.Type() == "request" {
+		req := m.(Request)
+		switch req.RequestType() {
+		case "room:create", "room:list", "room:join", "room:leave":
+			return mw.WriteMessage(rm.handleRoomRequest(ctx, req))
+		}
+	}
+
+	r := rm.RoomOf(sessionID)
+	if r == nil {
+		if m.Type() == "request" {
+			return mw.WriteMessage(NewErrorResponse(
+				sessionID,
+				m.(Request).RequestID(),
+				404,
+				"error",
+				"not in a room",
+			))
+		}
+		return nil
+	}
+	return r.Enqueue(ctx, sessionID, m)
+}
+
+// handleRoomRequest handles a room request and returns the response.
+func (rm *RoomManager) handleRoomRequest(ctx context.Context, req Request) Response {
+	sessionID := GetSessionID(ctx)
+	errorResponse := func(code int, err error) Response {
+		return NewErrorResponse(sessionID, req.RequestID(), code, "error", err.Error())
+	}
+
+	data := struct {
+		Room string `json:"room"`
+		Name string `json:"name"`
+		Game string `json:"game"`
+	}{}
+	req.ReadDataTo(&data)
+
+	if req.RequestType() == "room:list" {
+		rooms := rm.Rooms()
+		infos := make([]RoomInfo, len(rooms))
+		for i, r := range rooms {
+			infos[i] = r.Info()
+		}
+		return NewResponse(sessionID, req.RequestID(), req.RequestType(), 200, "success", infos)
+	}
+
+	if req.RequestType() == "room:leave" {
+		if err := rm.Leave(sessionID); err != nil {
+			return errorResponse(404, err)
+		}
+		return NewResponse(sessionID, req.RequestID(), req.RequestType(), 200, "success", nil)
+	}
+
+	// Find the session to join a room.
+	var s *Session
+	if sc := GetSessionCollection(ctx); sc != nil {
+		s = sc.Get(sessionID)
+	}
+	if s == nil {
+		return errorResponse(404, fmt.Errorf("session not found: %s", sessionID))
+	}
+	if rm.RoomOf(sessionID) != nil {
+		return errorResponse(409, fmt.Errorf("already in a room"))
+	}
+
+	var r *Room
+	var err error
+	switch {
+	case req.RequestType() == "room:create":
+		if r, err = rm.CreateRoom(data.Name, data.Game); err != nil {
+			return errorResponse(400, err)
+		}
+		if _, err = rm.Join(r.ID(), s); err != nil {
+			rm.CloseRoom(r.ID())
+			return errorResponse(409, err)
+		}
+	case data.Room != "":
+		if r, err = rm.Join(data.Room, s); err != nil {
+			return errorResponse(404, err)
+		}
+	default:
+		if r, err = rm.QuickJoin(data.Game, s); err != nil {
+			return errorResponse(400, err)
+		}
+	}
+	return NewResponse(sessionID, req.RequestID(), req.RequestType(), 200, "success", r.Info())
+}
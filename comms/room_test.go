@@ -0,0 +1,259 @@
+package comms_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+	"github.com/yookoala/botgame-playground/comms/commstest"
+)
+
+// roomEchoHandler responds to every request with the number of sessions
+// in the room. Request of type "shout" is also broadcasted as an event.
+func roomEchoHandler() comms.MessageHandler {
+	return comms.MessageHandlerFunc(func(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+		req, ok := m.(comms.Request)
+		if !ok || m.Type() != "request" {
+			return nil
+		}
+		if req.RequestType() == "shout" {
+			mw.WriteMessage(comms.NewEvent("shout", comms.GetSessionID(ctx)))
+		}
+		return mw.WriteMessage(comms.NewResponse(
+			comms.GetSessionID(ctx),
+			req.RequestID(),
+			req.RequestType(),
+			200,
+			"success",
+			comms.GetSessionCollection(ctx).Len(),
+		))
+	})
+}
+
+// readRoomInfo reads the room info in the response.
+func readRoomInfo(t *testing.T, resp comms.Response) (info comms.RoomInfo) {
+	t.Helper()
+	if err := resp.ReadDataTo(&info); err != nil {
+		t.Fatalf("unexpected error reading room info: %s", err)
+	}
+	return
+}
+
+func TestRoomManager_CreateJoinLeave(t *testing.T) {
+	rm := comms.NewRoomManager().Register("echo", 2, roomEchoHandler)
+	h := commstest.NewHarness(t, rm)
+	c1, c2, c3 := h.Connect(), h.Connect(), h.Connect()
+
+	// Not in a room yet.
+	c1.ExpectResponseCode(c1.Request("shout", nil), 404)
+
+	info := readRoomInfo(t, c1.ExpectResponseCode(c1.Request("room:create", map[string]string{"name": "foo"}), 200))
+	if want, have := "foo", info.Name; want != have {
+		t.Errorf("unexpected room name. want %#v, have %#v", want, have)
+	}
+	if want, have := "echo", info.Game; want != have {
+		t.Errorf("unexpected room game. want %#v, have %#v", want, have)
+	}
+
+	// Already in a room.
+	c1.ExpectResponseCode(c1.Request("room:create", nil), 409)
+
+	c2.ExpectResponseCode(c2.Request("room:join", map[string]string{"room": info.ID}), 200)
+	c3.ExpectResponseCode(c3.Request("room:join", map[string]string{"room": "no-such-room"}), 404)
+
+	// Room messages are only broadcasted to sessions in the room.
+	var size int
+	c1.ExpectResponseCode(c1.Request("shout", nil), 200).ReadDataTo(&size)
+	if want, have := 2, size; want != have {
+		t.Errorf("unexpected room size. want %d, have %d", want, have)
+	}
+	c1.ExpectEvent("shout")
+	c2.ExpectEvent("shout")
+	c3.ExpectNoMessage(50 * time.Millisecond)
+
+	c2.ExpectResponseCode(c2.Request("room:leave", nil), 200)
+	c2.ExpectResponseCode(c2.Request("room:leave", nil), 404)
+	c2.ExpectResponseCode(c2.Request("shout", nil), 404)
+
+	// Room is closed after the last session left.
+	c1.Close()
+	deadline := time.Now().Add(time.Second)
+	for rm.Room(info.ID) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for room to close")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRoomManager_QuickJoin(t *testing.T) {
+	rm := comms.NewRoomManager().
+		Register("echo", 2, roomEchoHandler).
+		Register("other", 2, roomEchoHandler)
+	h := commstest.NewHarness(t, rm)
+	c1, c2, c3, c4 := h.Connect(), h.Connect(), h.Connect(), h.Connect()
+
+	// Default game is the first registered.
+	room1 := readRoomInfo(t, c1.ExpectResponseCode(c1.Request("room:join", nil), 200))
+	if want, have := "echo", room1.Game; want != have {
+		t.Errorf("unexpected room game. want %#v, have %#v", want, have)
+	}
+	room2 := readRoomInfo(t, c2.ExpectResponseCode(c2.Request("room:join", nil), 200))
+	if want, have := room1.ID, room2.ID; want != have {
+		t.Errorf("expected to join the same room. want %#v, have %#v", want, have)
+	}
+
+	// The first room is full.
+	room3 := readRoomInfo(t, c3.ExpectResponseCode(c3.Request("room:join", nil), 200))
+	if room3.ID == room1.ID {
+		t.Errorf("expected to join a new room, joined full room %#v", room1.ID)
+	}
+
+	room4 := readRoomInfo(t, c4.ExpectResponseCode(c4.Request("room:join", map[string]string{"game": "other"}), 200))
+	if want, have := "other", room4.Game; want != have {
+		t.Errorf("unexpected room game. want %#v, have %#v", want, have)
+	}
+
+	var rooms []comms.RoomInfo
+	c1.ExpectResponseCode(c1.Request("room:list", nil), 200).ReadDataTo(&rooms)
+	if want, have := 3, len(rooms); want != have {
+		t.Fatalf("unexpected number of rooms. want %d, have %d", want, have)
+	}
+	if want, have := []string{c1.ID(), c2.ID()}, rooms[0].Sessions; len(want) != len(have) {
+		t.Errorf("unexpected sessions in room. want %#v, have %#v", want, have)
+	}
+
+	c5 := h.Connect()
+	c5.ExpectResponseCode(c5.Request("room:join", map[string]string{"game": "no-such-game"}), 400)
+}
+
+func TestRoomManager_OnEvent(t *testing.T) {
+	events := make(chan string, 10)
+	rm := comms.NewRoomManager().
+		Register("echo", 2, roomEchoHandler).
+		OnEvent(func(r *comms.Room, evt comms.Event) {
+			events <- r.ID() + " " + evt.EventType()
+		})
+	h := commstest.NewHarness(t, rm)
+	c := h.Connect()
+
+	info := readRoomInfo(t, c.ExpectResponseCode(c.Request("room:join", nil), 200))
+	c.ExpectResponseCode(c.Request("shout", nil), 200)
+	c.ExpectEvent("shout")
+	select {
+	case have := <-events:
+		if want := info.ID + " shout"; want != have {
+			t.Errorf("unexpected event. want %#v, have %#v", want, have)
+		}
+	default:
+		t.Errorf("expected event callback before the event is sent")
+	}
+}
+
+func TestRoom_ResumeFullQueue(t *testing.T) {
+	// More messages than the queue of a room can buffer.
+	const n = 50
+	release := make(chan struct{})
+	handled := make(chan string, n+1)
+	rm := comms.NewRoomManager().Register("slow", 2, func() comms.MessageHandler {
+		return comms.MessageHandlerFunc(func(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+			<-release
+			handled <- m.(comms.Request).RequestID()
+			return nil
+		})
+	})
+	r, err := rm.CreateRoom("", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := r.Pause(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i := 0; i < n; i++ {
+		r.Enqueue(context.Background(), "session", comms.NewRequest(strconv.Itoa(i), "ping", nil))
+	}
+	resumed := make(chan error, 1)
+	go func() {
+		resumed <- r.Resume()
+	}()
+
+	// The room is not locked while the held messages wait for the
+	// message handler.
+	time.Sleep(10 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		r.Info()
+		r.Enqueue(context.Background(), "session", comms.NewRequest(strconv.Itoa(n), "ping", nil))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("room locked while resuming")
+	}
+
+	close(release)
+	if err := <-resumed; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	for i := 0; i <= n; i++ {
+		if want, have := strconv.Itoa(i), <-handled; want != have {
+			t.Fatalf("unexpected message order. want %s, have %s", want, have)
+		}
+	}
+	if r.Paused() {
+		t.Errorf("expected room to be resumed")
+	}
+}
+
+// forfeitHandler is a game that ends with a "game:result" event when a
+// player leaves, won by the other player.
+type forfeitHandler struct {
+	comms.MessageHandler
+}
+
+// Leave implements comms.Leaver.
+func (h forfeitHandler) Leave(sessionID string, mw comms.MessageWriter) {
+	mw.WriteMessage(comms.NewEvent("game:result", map[string]string{"loser": sessionID}))
+}
+
+func TestRoomManager_IdentityAfterDisconnect(t *testing.T) {
+	identities := make(chan string, 1)
+	rm := comms.NewRoomManager().
+		Register("forfeit", 2, func() comms.MessageHandler {
+			return forfeitHandler{roomEchoHandler()}
+		}).
+		OnEvent(func(r *comms.Room, evt comms.Event) {
+			var data struct {
+				Loser string `json:"loser"`
+			}
+			evt.ReadDataTo(&data)
+			identities <- r.Identity(data.Loser)
+		})
+	ah := comms.NewAuthHandler(comms.TokenAuthenticator{"alice": "secret-a", "bob": "secret-b"}, rm)
+	rm.Identify(ah.Identity)
+	h := commstest.NewHarness(t, ah)
+	c1, c2 := h.Connect(), h.Connect()
+	c1.ExpectResponseCode(c1.Request("auth", map[string]string{"token": "secret-a"}), 200)
+	c2.ExpectResponseCode(c2.Request("auth", map[string]string{"token": "secret-b"}), 200)
+	c1.ExpectResponseCode(c1.Request("room:join", nil), 200)
+	c2.ExpectResponseCode(c2.Request("room:join", nil), 200)
+
+	// The result of a forfeit by disconnect is of the identity of the
+	// player, which session is already closed.
+	c1.Close()
+	select {
+	case have := <-identities:
+		if want := "alice"; want != have {
+			t.Errorf("unexpected identity of the loser. want %#v, have %#v", want, have)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for the game result")
+	}
+	if want, have := "", ah.Identity(c1.ID()); want != have {
+		t.Errorf("unexpected identity of closed session. want %#v, have %#v", want, have)
+	}
+}
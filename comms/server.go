@@ -9,25 +9,30 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// getNewSessionIDs allocate a new session ID for use.
-func getNewSessionIDs() <-chan string {
-	ch := make(chan string)
-	go func() {
-		maxInt := int(^uint(0) >> 1)
-		for id := 1; true; id++ {
-			hash := sha1.New()
-			hash.Write([]byte(fmt.Sprintf("%d.%d", id, time.Now().UnixMicro())))
-			hashId := hash.Sum(nil)
-			ch <- fmt.Sprintf("%x", hashId)[0:12]
-			if id == maxInt {
-				id = 0
-			}
-		}
-	}()
-	return ch
+// sessionIDSeq is the sequence number for generating session IDs.
+var sessionIDSeq uint64
+
+// newSessionID allocates a new session ID for use.
+func newSessionID() string {
+	id := atomic.AddUint64(&sessionIDSeq, 1)
+	hash := sha1.New()
+	hash.Write([]byte(fmt.Sprintf("%d.%d", id, time.Now().UnixMicro())))
+	return fmt.Sprintf("%x", hash.Sum(nil))[0:12]
+}
+
+// handleNewSession greets the new session with its session ID,
+// then hand it to the session handler.
+func handleNewSession(sess *Session, sh SessionHandler) {
+	if err := sess.WriteMessage(NewGreeting(sess.ID())); err != nil {
+		log.Printf("error sending greeting to session %s: %s", sess.ID(), err)
+		sess.Close()
+		return
+	}
+	sh.HandleSession(sess)
 }
 
 // StartServer creates a new server loop and start listening to the listener.
@@ -35,9 +40,7 @@ func StartServer(listener net.Listener, sh SessionHandler) (err error) {
 	defer listener.Close()
 
 	log.Printf("start listening on %s", listener.Addr().String())
-	newSessionIDs := getNewSessionIDs()
 	for {
-		sessionID := <-newSessionIDs
 		conn, err := listener.Accept()
 		if err != nil {
 			switch err.(type) {
@@ -50,12 +53,25 @@ func StartServer(listener net.Listener, sh SessionHandler) (err error) {
 			}
 		}
 
-		sess := NewSession(sessionID, conn)
+		sess := NewSession(newSessionID(), conn)
 		log.Printf("received new session to handle: %s", sess.ID())
-		go sh.HandleSession(sess)
+		go handleNewSession(sess, sh)
 	}
 }
 
+// ServeConn serves the connection as a new session. Like connections
+// from StartServer, the peer is greeted with its session ID, then the
+// session is handed to the session handler.
+//
+// For connections that are not accepted from a listener (e.g. the server
+// dials a bot listening on an address).
+func ServeConn(conn io.ReadWriteCloser, sh SessionHandler) *Session {
+	sess := NewSession(newSessionID(), conn)
+	log.Printf("serving connection as session: %s", sess.ID())
+	go handleNewSession(sess, sh)
+	return sess
+}
+
 // MessageWriter represents a writer that can write a message.
 type MessageHandler interface {
 	HandleMessage(ctx context.Context, m Message, out MessageWriter) error
@@ -136,6 +152,16 @@ func (smq *SimpleMessageQueue) Start(mh MessageHandler, mw MessageWriter) {
 	//       arrive before the queue is ready. In that case, message
 	//       will be lost.
 
+	smq.Dispatch(mh, mw)
+}
+
+// Dispatch starts sending messages in the queue to the message handler,
+// without reading from the sessions in the collection. Messages are to be
+// sent to the queue with Enqueue.
+//
+// For queues fed by another message handler (e.g. rooms fed by the
+// RoomManager).
+func (smq *SimpleMessageQueue) Dispatch(mh MessageHandler, mw MessageWriter) {
 	go func(smq *SimpleMessageQueue, mh MessageHandler, mw MessageWriter) {
 		for {
 			ctx, m, err := smq.Dequeue()
@@ -233,7 +259,25 @@ func NewSimpleMessageQueue(sc SessionCollection, bufferSize int) *SimpleMessageQ
 // SimpleMessageBroker helps route / multicast Message to different
 // sessions. Implements MessageWriter interface.
 type SimpleMessageBroker struct {
-	sessions SessionCollection
+	sessions  SessionCollection
+	projector EventProjector
+}
+
+// EventProjector turns an event into the view of each recipient, for
+// games with hidden information (e.g. a player sees its own ships, but
+// not the ships of the opponent).
+type EventProjector interface {
+	// ProjectEvent returns the event to be sent to the session, or nil
+	// if the session should not receive the event.
+	ProjectEvent(evt Event, sessionID string) Message
+}
+
+// EventProjectorFunc is an adapter to allow the use of ordinary functions as EventProjector.
+type EventProjectorFunc func(evt Event, sessionID string) Message
+
+// ProjectEvent calls f(evt, sessionID)
+func (f EventProjectorFunc) ProjectEvent(evt Event, sessionID string) Message {
+	return f(evt, sessionID)
 }
 
 // NewSimpleMessageBroker creates a new SimpleMessageRouter
@@ -246,11 +290,18 @@ func NewSimpleMessageBroker(sessions SessionCollection) *SimpleMessageBroker {
 	}
 }
 
+// Project sets the event projector to turn every event into the view
+// of each session before it is sent.
+func (r *SimpleMessageBroker) Project(p EventProjector) *SimpleMessageBroker {
+	r.projector = p
+	return r
+}
+
 // WriteMessage handles the message by writing it to the appropriate session based
 // on the message type.
 //
 // Response are sent to the specified session id. Events are broadcasted to all
-// sessions.
+// sessions, projected by the event projector if set.
 func (r *SimpleMessageBroker) WriteMessage(m Message) error {
 	//log.Printf("SimpleMessageBroker prepare to broke message: %s", m)
 	if m.Type() == "response" {
@@ -269,6 +320,14 @@ func (r *SimpleMessageBroker) WriteMessage(m Message) error {
 		log.Printf("SimpleMessageBroker will broadcast event to all sessions (len=%d), message: %s", r.sessions.Len(), m)
 		errs := NewRouterErrorCollection()
 		r.sessions.Map(func(sess *Session) {
+			m := m
+			if r.projector != nil {
+				evt := r.projector.ProjectEvent(m.(Event), sess.ID())
+				if evt == nil {
+					return
+				}
+				m = evt
+			}
 			log.Printf("SimpleMessageBroker: send to session %s, message: %s", sess.ID(), m)
 			err := sess.WriteMessage(m)
 			if err != nil {
@@ -3,10 +3,13 @@ package comms_test
 import (
 	"context"
 	"io"
+	"net"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/yookoala/botgame-playground/comms"
+	"github.com/yookoala/botgame-playground/comms/commstest"
 )
 
 type dummyConn struct {
@@ -289,3 +292,59 @@ func TestSimpleMessageBroker(t *testing.T) {
 	// Note: events are not session specific.
 	//       it should either have a session ID of "" or nil.
 }
+
+func TestServeConn(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	sessions := make(chan *comms.Session, 1)
+	sess := comms.ServeConn(serverConn, comms.SessionHandlerFunc(func(s *comms.Session) error {
+		sessions <- s
+		return nil
+	}))
+
+	client, _, err := comms.NewSessionFromConn(clientConn)
+	if err != nil {
+		t.Fatalf("unexpected error reading greeting: %s", err)
+	}
+	if want, have := sess.ID(), client.ID(); want != have {
+		t.Errorf("unexpected session ID in greeting. want %#v, have %#v", want, have)
+	}
+	if s := <-sessions; s != sess {
+		t.Errorf("unexpected session handed to session handler")
+	}
+}
+
+// projectingHandler broadcasts an event on every request, which is
+// projected to show each session its own ID. Sessions that sent a "mute"
+// request receive no event.
+type projectingHandler struct {
+	muted map[string]bool
+}
+
+func (h *projectingHandler) HandleMessage(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+	if req, ok := m.(comms.Request); ok && req.RequestType() == "mute" {
+		h.muted[comms.GetSessionID(ctx)] = true
+	}
+	return mw.WriteMessage(comms.NewEvent("hello", "everyone"))
+}
+
+func (h *projectingHandler) ProjectEvent(evt comms.Event, sessionID string) comms.Message {
+	if h.muted[sessionID] {
+		return nil
+	}
+	return comms.NewEvent(evt.EventType(), sessionID)
+}
+
+func TestSimpleMessageBroker_Project(t *testing.T) {
+	h := commstest.NewHarness(t, &projectingHandler{muted: make(map[string]bool)})
+	c1, c2 := h.Connect(), h.Connect()
+
+	c2.Request("mute", nil)
+	var data string
+	c1.ExpectEvent("hello").ReadDataTo(&data)
+	if want, have := c1.ID(), data; want != have {
+		t.Errorf("unexpected projected event data. want %#v, have %#v", want, have)
+	}
+	c2.ExpectNoMessage(50 * time.Millisecond)
+}
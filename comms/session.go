@@ -61,7 +61,8 @@ type Session struct {
 	mr MessageReader
 	mw MessageWriter
 
-	onClose func(*Session)
+	onClose []func(*Session)
+	lock    *sync.Mutex
 }
 
 // NewSession creates a new Session
@@ -71,6 +72,7 @@ func NewSession(id string, conn io.ReadWriteCloser) *Session {
 		conn: conn,
 		mr:   NewMessageReader(conn),
 		mw:   NewMessageWriter(conn),
+		lock: &sync.Mutex{},
 	}
 }
 
@@ -78,11 +80,14 @@ func NewSession(id string, conn io.ReadWriteCloser) *Session {
 // dailed connection and to obtain the session ID from the
 // greeting message.
 func NewSessionFromConn(conn io.ReadWriteCloser) (sess *Session, greeting Message, err error) {
-	greeting, err = NewMessageReader(conn).ReadMessage()
+	// Read the greeting with the session's own reader so that messages
+	// buffered after the greeting are not lost.
+	sess = NewSession("", conn)
+	greeting, err = sess.ReadMessage()
 	if err != nil {
-		return
+		return nil, nil, err
 	}
-	sess = NewSession(greeting.SessionID(), conn)
+	sess.id = greeting.SessionID()
 	return
 }
 
@@ -101,23 +106,43 @@ func (s *Session) WriteMessage(m Message) error {
 	return s.mw.WriteMessage(m)
 }
 
-// OnClose sets a callback function to be called when the session is closed.
+// Intercept replaces the message reader and writer of the session with
+// the ones returned by f. For wrapping the session IO with middlewares
+// like Recorder.
+func (s *Session) Intercept(f func(mr MessageReader, mw MessageWriter) (MessageReader, MessageWriter)) *Session {
+	s.mr, s.mw = f(s.mr, s.mw)
+	return s
+}
+
+// OnClose adds a callback function to be called when the session is closed.
+//
+// Callbacks are called in the order they are added.
 func (s *Session) OnClose(f func(*Session)) *Session {
-	s.onClose = f
+	s.lock.Lock()
+	s.onClose = append(s.onClose, f)
+	s.lock.Unlock()
 	return s
 }
 
 // Close closes the session
+//
+// Close is safe to be called concurrently. The connection is closed
+// and the onClose callbacks are run only once.
 func (s *Session) Close() (err error) {
-	if s.conn != nil {
-		err = s.conn.Close()
-		s.conn = nil
+	// Take the connection and callbacks (for gc) so that
+	// concurrent calls will not close again.
+	s.lock.Lock()
+	conn, onClose := s.conn, s.onClose
+	s.conn, s.onClose = nil, nil
+	s.lock.Unlock()
+
+	if conn != nil {
+		err = conn.Close()
 	}
-	if s.onClose != nil {
-		// Run the onClose callback.
-		s.onClose(s)
+	for _, f := range onClose {
+		// Run the onClose callbacks.
+		f(s)
 	}
-	s.onClose = nil // remove reference to callback for gc
 	return
 }
 
@@ -216,6 +241,10 @@ func (sc *sessionCollection) Add(s *Session) error {
 }
 
 func (sc *sessionCollection) onSessionClose(s *Session) {
+	// Session might be removed from the collection before close.
+	if sc.Get(s.ID()) != s {
+		return
+	}
 	sc.Remove(s.ID())
 	sc.callbackLock.Lock()
 	defer sc.callbackLock.Unlock()
@@ -246,6 +275,8 @@ func (sc *sessionCollection) OnRemove(f func(*Session)) {
 
 // Len returns the size of the collection.
 func (sc *sessionCollection) Len() (l int) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
 	l = len(sc.sessions)
 	return l
 }
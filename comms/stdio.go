@@ -0,0 +1,192 @@
+package comms
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProcessCloseTimeout is the time for a child process to exit by itself
+// after its standard input is closed. The process is killed afterwards.
+var ProcessCloseTimeout = 3 * time.Second
+
+// stdioConn joins a reader and a writer into a single connection.
+type stdioConn struct {
+	r io.ReadCloser
+	w io.WriteCloser
+}
+
+// NewStdioConn joins the reader and the writer into a connection
+// for NewSession.
+func NewStdioConn(r io.ReadCloser, w io.WriteCloser) io.ReadWriteCloser {
+	return &stdioConn{r: r, w: w}
+}
+
+// Read reads from the reader.
+func (c *stdioConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// Write writes to the writer.
+func (c *stdioConn) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+// Close closes both the reader and the writer.
+func (c *stdioConn) Close() error {
+	werr := c.w.Close()
+	rerr := c.r.Close()
+	if werr != nil {
+		return werr
+	}
+	return rerr
+}
+
+// StdioDialer returns a Dialer for bots running as child process of
+// the server. The connection reads from standard input and writes to
+// standard output.
+func StdioDialer() Dialer {
+	return DialerFunc(func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return NewStdioConn(os.Stdin, os.Stdout), nil
+	})
+}
+
+// ProcessConn is a connection to a child process over its standard
+// input and output.
+type ProcessConn struct {
+	cmd    *exec.Cmd
+	stdin  *os.File
+	stdout *os.File
+
+	done chan struct{}
+	err  error
+
+	closeOnce *sync.Once
+	closing   *atomic.Bool
+
+	// killing is true if Close kills the process.
+	killing *atomic.Bool
+
+	// exitedOnClose is true if the process exited after Close is called,
+	// either cleanly or killed by Close. A process that crashed is not,
+	// even if its session is closed when its output ends.
+	exitedOnClose bool
+}
+
+// StartProcess starts the command and connects to its standard input
+// and output. The Stdin and Stdout of cmd must not be set.
+func StartProcess(cmd *exec.Cmd) (p *ProcessConn, err error) {
+	if cmd.Stdin != nil || cmd.Stdout != nil {
+		return nil, fmt.Errorf("stdin or stdout of the command is already set")
+	}
+
+	// Use os.Pipe instead of cmd.StdinPipe and cmd.StdoutPipe so that
+	// cmd.Wait will not close the pipes before all output is read.
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		return nil, err
+	}
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+
+	err = cmd.Start()
+
+	// The child ends are not used by this process anymore.
+	stdinR.Close()
+	stdoutW.Close()
+	if err != nil {
+		stdinW.Close()
+		stdoutR.Close()
+		return nil, err
+	}
+
+	p = &ProcessConn{
+		cmd:    cmd,
+		stdin:  stdinW,
+		stdout: stdoutR,
+
+		done: make(chan struct{}),
+
+		closeOnce: &sync.Once{},
+		closing:   &atomic.Bool{},
+		killing:   &atomic.Bool{},
+	}
+	go func() {
+		p.err = cmd.Wait()
+		p.exitedOnClose = p.closing.Load() && (p.err == nil || p.killing.Load())
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// Cmd returns the command of the process.
+func (p *ProcessConn) Cmd() *exec.Cmd {
+	return p.cmd
+}
+
+// Read reads from the standard output of the process.
+func (p *ProcessConn) Read(b []byte) (int, error) {
+	return p.stdout.Read(b)
+}
+
+// Write writes to the standard input of the process.
+func (p *ProcessConn) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+// Done returns a channel that is closed when the process exits.
+func (p *ProcessConn) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait waits for the process to exit and returns its exit error.
+func (p *ProcessConn) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Close closes the standard input of the process and waits for it
+// to exit. The process is killed if it does not exit within
+// ProcessCloseTimeout.
+func (p *ProcessConn) Close() error {
+	p.closeOnce.Do(func() {
+		p.closing.Store(true)
+		p.stdin.Close()
+		select {
+		case <-p.done:
+		case <-time.After(ProcessCloseTimeout):
+			log.Printf("process %d did not exit in time. kill", p.cmd.Process.Pid)
+			p.killing.Store(true)
+			p.cmd.Process.Kill()
+			<-p.done
+		}
+		p.stdout.Close()
+	})
+	return nil
+}
+
+// LaunchProcess starts the command as a bot talking over standard input
+// and output. Like connections from StartServer, the bot is greeted with
+// its session ID, then the session is handed to the session handler.
+func LaunchProcess(cmd *exec.Cmd, sh SessionHandler) (*Session, error) {
+	conn, err := StartProcess(cmd)
+	if err != nil {
+		return nil, err
+	}
+	sess := NewSession(newSessionID(), conn)
+	log.Printf("launched process %d as session: %s", cmd.Process.Pid, sess.ID())
+	go handleNewSession(sess, sh)
+	return sess, nil
+}
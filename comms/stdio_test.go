@@ -0,0 +1,153 @@
+package comms_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+)
+
+// helperBotCommand returns a command that runs TestHelperBotProcess
+// as a bot talking over standard input and output.
+func helperBotCommand() *exec.Cmd {
+	cmd := exec.Command(helperBotArgs()[0], helperBotArgs()[1:]...)
+	cmd.Env = append(os.Environ(), helperBotEnv("")...)
+	return cmd
+}
+
+// helperBotArgs returns the command line arguments to run
+// TestHelperBotProcess.
+func helperBotArgs() []string {
+	return []string{os.Args[0], "-test.run=^TestHelperBotProcess$"}
+}
+
+// helperBotEnv returns the environment variables to run
+// TestHelperBotProcess in the mode.
+func helperBotEnv(mode string) []string {
+	return []string{"GO_WANT_HELPER_BOT=1", "GO_HELPER_BOT_MODE=" + mode}
+}
+
+// TestHelperBotProcess is not a real test. It is a bot process
+// for other tests to launch.
+//
+// The bot sends a "hello" request on init, and replies every event
+// with a "bye" request. It exits when the server closes the connection.
+//
+// Behaviour is changed by GO_HELPER_BOT_MODE:
+//   - "silent": never replies to events.
+//   - "crash": writes to stderr and exits with error after init.
+//   - "join-crash": joins a room instead of "hello", then crashes like
+//     "crash" after joined.
+func TestHelperBotProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_BOT") != "1" {
+		return
+	}
+	mode := os.Getenv("GO_HELPER_BOT_MODE")
+	err := comms.NewClient(comms.StdioDialer(), comms.MessageHandlerFunc(
+		func(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+			switch m.Type() {
+			case "signal":
+				if mode == "join-crash" {
+					return mw.WriteMessage(comms.NewRequest("1", "room:join", nil))
+				}
+				err := mw.WriteMessage(comms.NewRequest("1", "hello", comms.GetSessionID(ctx)))
+				if mode == "crash" {
+					fmt.Fprintln(os.Stderr, "helper bot crash")
+					os.Exit(3)
+				}
+				return err
+			case "response":
+				if mode == "join-crash" {
+					fmt.Fprintln(os.Stderr, "helper bot crash")
+					os.Exit(3)
+				}
+			case "event":
+				if mode == "silent" {
+					return nil
+				}
+				return mw.WriteMessage(comms.NewRequest("2", "bye", nil))
+			}
+			return nil
+		},
+	)).Run(context.Background())
+	if err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestLaunchProcess(t *testing.T) {
+	sessions := make(chan *comms.Session, 1)
+	sess, err := comms.LaunchProcess(helperBotCommand(), comms.SessionHandlerFunc(func(s *comms.Session) error {
+		sessions <- s
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error launching process: %s", err)
+	}
+
+	select {
+	case s := <-sessions:
+		if s != sess {
+			t.Fatalf("unexpected session handed to session handler")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for session to be handled")
+	}
+
+	// The bot should know its session ID from greeting.
+	m, err := sess.ReadMessage()
+	if err != nil {
+		t.Fatalf("unexpected error reading message: %s", err)
+	}
+	if want, have := "hello", m.(comms.Request).RequestType(); want != have {
+		t.Errorf("unexpected request type. want %#v, have %#v", want, have)
+	}
+	var sessionID string
+	m.ReadDataTo(&sessionID)
+	if want, have := sess.ID(), sessionID; want != have {
+		t.Errorf("unexpected session ID known by bot. want %#v, have %#v", want, have)
+	}
+
+	// Round trip.
+	if err := sess.WriteMessage(comms.NewEvent("test:event", nil)); err != nil {
+		t.Fatalf("unexpected error writing message: %s", err)
+	}
+	m, err = sess.ReadMessage()
+	if err != nil {
+		t.Fatalf("unexpected error reading message: %s", err)
+	}
+	if want, have := "bye", m.(comms.Request).RequestType(); want != have {
+		t.Errorf("unexpected request type. want %#v, have %#v", want, have)
+	}
+
+	// Closing the session should end the process gracefully.
+	sess.Close()
+	m, err = sess.ReadMessage()
+	if err == nil {
+		t.Errorf("expected error reading from closed session, got message: %s", m)
+	}
+}
+
+func TestStartProcess_Wait(t *testing.T) {
+	p, err := comms.StartProcess(helperBotCommand())
+	if err != nil {
+		t.Fatalf("unexpected error starting process: %s", err)
+	}
+
+	// Without a greeting, the bot will fail on handshake once
+	// its standard input is closed.
+	p.Close()
+	select {
+	case <-p.Done():
+	default:
+		t.Errorf("expected process to be done after close")
+	}
+	if err := p.Wait(); err == nil {
+		t.Errorf("expected exit error from the process")
+	}
+}
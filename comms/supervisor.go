@@ -0,0 +1,299 @@
+package comms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrMoveTimeout is the forfeit reason of a bot that fails to
+// respond to a move within the move budget.
+var ErrMoveTimeout = errors.New("move time budget exceeded")
+
+// Limits are the resource limits of a bot process. Zero value of
+// a field means unlimited.
+//
+// Limits are only supported on linux. They are applied before the bot
+// command is executed, so they cover the whole run of the bot: the
+// server re-executes itself as a helper that sets the limits with
+// setrlimit(2), then executes the bot in the same process. A limit
+// that cannot be set (e.g. above the hard limit of the server) fails
+// the start of the bot.
+type Limits struct {
+	// CPUTime is the CPU time limit (RLIMIT_CPU), in whole seconds.
+	CPUTime time.Duration
+
+	// Memory is the address space limit in bytes (RLIMIT_AS).
+	Memory uint64
+
+	// OpenFiles is the limit of open file descriptors (RLIMIT_NOFILE).
+	OpenFiles uint64
+}
+
+// BotSpec specifies a bot process to be supervised.
+type BotSpec struct {
+	// Name identifies the bot. The stderr of the bot is logged to
+	// "<Name>.stderr.log" in the log directory.
+	Name string
+
+	// Command is the executable and arguments of the bot.
+	Command []string
+
+	// Env is the extra environment variables of the bot.
+	Env []string
+
+	// Limits is the resource limits of the bot process.
+	Limits Limits
+
+	// MaxRestarts is the number of times a crashed bot is restarted
+	// before it forfeits.
+	MaxRestarts int
+
+	// MoveBudget is the wall-clock time for the bot to send a request
+	// after a move is issued to it. Zero means no limit.
+	MoveBudget time.Duration
+
+	// IsMove reports if a message written to the bot issues a move.
+	// Required if MoveBudget is set.
+	IsMove func(m Message) bool
+}
+
+// Supervisor launches bots as child processes, then keeps them under
+// control. Sessions of the bots are handed to the session handler.
+//
+// A restarted bot runs in a new session. The session of the crashed bot
+// is closed first, so it leaves its room, and its game is forfeited if
+// the game is a Leaver.
+type Supervisor struct {
+	sh        SessionHandler
+	logDir    string
+	onForfeit func(bot string, sess *Session, reason error)
+	wg        *sync.WaitGroup
+}
+
+// NewSupervisor creates a new Supervisor.
+//
+// The stderr of bots are logged to files in logDir. If logDir is empty,
+// stderr of bots are written to the stderr of the supervisor.
+func NewSupervisor(sh SessionHandler, logDir string) *Supervisor {
+	return &Supervisor{
+		sh:     sh,
+		logDir: logDir,
+		wg:     &sync.WaitGroup{},
+	}
+}
+
+// OnForfeit sets a callback function to be called when a bot forfeits,
+// either by exceeding the move budget or crashing too many times. The
+// session is the last session of the bot.
+func (s *Supervisor) OnForfeit(f func(bot string, sess *Session, reason error)) *Supervisor {
+	s.onForfeit = f
+	return s
+}
+
+// forfeit closes the session of the bot and reports the forfeit.
+func (s *Supervisor) forfeit(spec BotSpec, sess *Session, reason error) {
+	log.Printf("bot %s forfeits: %s", spec.Name, reason)
+	sess.Close()
+	if s.onForfeit != nil {
+		s.onForfeit(spec.Name, sess, reason)
+	}
+}
+
+// Launch starts the bot and supervises it in background until either
+// the context is cancelled, the bot session is closed by the server, or
+// the bot forfeits.
+//
+// Returns error if the bot cannot be started.
+func (s *Supervisor) Launch(ctx context.Context, spec BotSpec) error {
+	if spec.Name == "" || len(spec.Command) == 0 {
+		return fmt.Errorf("bot name and command are required")
+	}
+	if spec.MoveBudget > 0 && spec.IsMove == nil {
+		return fmt.Errorf("bot %s: IsMove is required for move budget", spec.Name)
+	}
+
+	var stderr io.Writer = os.Stderr
+	closeLog := func() {}
+	if s.logDir != "" {
+		f, err := os.OpenFile(filepath.Join(s.logDir, spec.Name+".stderr.log"),
+			os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("bot %s: error opening log file: %w", spec.Name, err)
+		}
+		stderr = f
+		closeLog = func() { f.Close() }
+	}
+
+	bot, err := s.start(spec, stderr)
+	if err != nil {
+		closeLog()
+		return err
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer closeLog()
+		s.supervise(ctx, spec, stderr, bot)
+	}()
+	return nil
+}
+
+// Wait waits for all bots to stop being supervised.
+func (s *Supervisor) Wait() {
+	s.wg.Wait()
+}
+
+// start starts a new process of the bot and hand its session
+// to the session handler.
+func (s *Supervisor) start(spec BotSpec, stderr io.Writer) (*supervisedBot, error) {
+	cmd := exec.Command(spec.Command[0], spec.Command[1:]...)
+	cmd.Env = append(os.Environ(), spec.Env...)
+	cmd.Stderr = stderr
+	started, err := limitCommand(cmd, spec.Limits)
+	if err != nil {
+		return nil, fmt.Errorf("bot %s: error setting resource limits: %w", spec.Name, err)
+	}
+	fmt.Fprintf(stderr, "%s supervisor: starting %s\n",
+		time.Now().Format(time.RFC3339), strings.Join(spec.Command, " "))
+
+	conn, err := StartProcess(cmd)
+	if limitErr := started(); err == nil && limitErr != nil {
+		conn.Close()
+		return nil, fmt.Errorf("bot %s: error setting resource limits: %w", spec.Name, limitErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bot %s: error starting process: %w", spec.Name, err)
+	}
+
+	bot := &supervisedBot{
+		conn:     conn,
+		sess:     NewSession(newSessionID(), conn),
+		lock:     &sync.Mutex{},
+		timedOut: &atomic.Bool{},
+	}
+	if spec.MoveBudget > 0 {
+		bot.sess.Intercept(func(mr MessageReader, mw MessageWriter) (MessageReader, MessageWriter) {
+			return &moveEndReader{bot: bot, mr: mr}, &moveStartWriter{bot: bot, spec: spec, mw: mw}
+		})
+	}
+	log.Printf("supervisor started bot %s (pid %d) as session: %s", spec.Name, cmd.Process.Pid, bot.sess.ID())
+	go handleNewSession(bot.sess, s.sh)
+	return bot, nil
+}
+
+// supervise waits for the bot process to exit, then restarts or
+// forfeits the bot as needed.
+func (s *Supervisor) supervise(ctx context.Context, spec BotSpec, stderr io.Writer, bot *supervisedBot) {
+	for restarts := 0; ; restarts++ {
+		select {
+		case <-ctx.Done():
+			bot.sess.Close()
+			return
+		case <-bot.conn.Done():
+		}
+		bot.endMove()
+
+		if bot.timedOut.Load() {
+			s.forfeit(spec, bot.sess, ErrMoveTimeout)
+			return
+		}
+		if bot.conn.exitedOnClose {
+			// Session closed by the server. Not a crash.
+			log.Printf("bot %s exited", spec.Name)
+			return
+		}
+
+		reason := fmt.Errorf("bot crashed: %v", bot.conn.Wait())
+		if restarts >= spec.MaxRestarts {
+			s.forfeit(spec, bot.sess, reason)
+			return
+		}
+		log.Printf("restarting bot %s (%d/%d): %s", spec.Name, restarts+1, spec.MaxRestarts, reason)
+		bot.sess.Close()
+
+		next, err := s.start(spec, stderr)
+		if err != nil {
+			s.forfeit(spec, bot.sess, err)
+			return
+		}
+		bot = next
+	}
+}
+
+// supervisedBot is a running process of a supervised bot.
+type supervisedBot struct {
+	conn *ProcessConn
+	sess *Session
+
+	lock     *sync.Mutex
+	timer    *time.Timer
+	timedOut *atomic.Bool
+}
+
+// startMove starts the move timer, if not already started. The bot is
+// killed if it does not end the move within the budget.
+func (b *supervisedBot) startMove(budget time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.timer != nil {
+		return
+	}
+	b.timer = time.AfterFunc(budget, func() {
+		b.timedOut.Store(true)
+		b.conn.Cmd().Process.Kill()
+	})
+}
+
+// endMove stops the move timer.
+func (b *supervisedBot) endMove() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+}
+
+// moveStartWriter starts the move timer when a move is issued to the bot.
+type moveStartWriter struct {
+	bot  *supervisedBot
+	spec BotSpec
+	mw   MessageWriter
+}
+
+// WriteMessage writes the message to the bot.
+func (w *moveStartWriter) WriteMessage(m Message) error {
+	if err := w.mw.WriteMessage(m); err != nil {
+		return err
+	}
+	if w.spec.IsMove(m) {
+		w.bot.startMove(w.spec.MoveBudget)
+	}
+	return nil
+}
+
+// moveEndReader ends the move timer when the bot sends a request.
+type moveEndReader struct {
+	bot *supervisedBot
+	mr  MessageReader
+}
+
+// ReadMessage reads a message from the bot.
+func (r *moveEndReader) ReadMessage() (Message, error) {
+	m, err := r.mr.ReadMessage()
+	if err == nil && m.Type() == "request" {
+		r.bot.endMove()
+	}
+	return m, err
+}
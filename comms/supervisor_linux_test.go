@@ -0,0 +1,112 @@
+//go:build linux
+
+package comms_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+)
+
+// processLimits is the resource limits reported by the helper process.
+type processLimits struct {
+	CPU    uint64 `json:"cpu"`
+	AS     uint64 `json:"as"`
+	NoFile uint64 `json:"nofile"`
+}
+
+// TestHelperLimitsProcess is not a real test. It is a bot process
+// that reports its own resource limits at start in the "limits" request
+// on init.
+func TestHelperLimitsProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_BOT") != "1" {
+		return
+	}
+	var cpu, as, nofile syscall.Rlimit
+	syscall.Getrlimit(syscall.RLIMIT_CPU, &cpu)
+	syscall.Getrlimit(syscall.RLIMIT_AS, &as)
+	syscall.Getrlimit(syscall.RLIMIT_NOFILE, &nofile)
+	comms.NewClient(comms.StdioDialer(), comms.MessageHandlerFunc(
+		func(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+			if m.Type() != "signal" {
+				return nil
+			}
+			return mw.WriteMessage(comms.NewRequest("1", "limits", processLimits{
+				CPU:    cpu.Cur,
+				AS:     as.Cur,
+				NoFile: nofile.Cur,
+			}))
+		},
+	)).Run(context.Background())
+	os.Exit(0)
+}
+
+func TestSupervisor_Limits(t *testing.T) {
+	s, sessions, _ := newTestSupervisor("")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := s.Launch(ctx, comms.BotSpec{
+		Name:    "limits",
+		Command: []string{os.Args[0], "-test.run=^TestHelperLimitsProcess$"},
+		Env:     helperBotEnv(""),
+		Limits: comms.Limits{
+			CPUTime:   1500 * time.Millisecond,
+			Memory:    8 << 30,
+			OpenFiles: 64,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error launching bot: %s", err)
+	}
+
+	// Limits are applied before the bot is executed, so the bot sees
+	// them right at start.
+	sess := expectSession(t, sessions)
+	m, err := sess.ReadMessage()
+	if err != nil {
+		t.Fatalf("unexpected error reading limits: %s", err)
+	}
+	v := processLimits{}
+	m.ReadDataTo(&v)
+	if want, have := uint64(2), v.CPU; want != have {
+		t.Errorf("unexpected CPU limit. want %d, have %d", want, have)
+	}
+	if want, have := uint64(8<<30), v.AS; want != have {
+		t.Errorf("unexpected address space limit. want %d, have %d", want, have)
+	}
+	if want, have := uint64(64), v.NoFile; want != have {
+		t.Errorf("unexpected open files limit. want %d, have %d", want, have)
+	}
+
+	cancel()
+	s.Wait()
+}
+
+func TestSupervisor_LimitsRejected(t *testing.T) {
+	s, sessions, _ := newTestSupervisor("")
+
+	// RLIMIT_NOFILE is capped by fs.nr_open, even for root.
+	err := s.Launch(context.Background(), comms.BotSpec{
+		Name:    "limits",
+		Command: []string{os.Args[0], "-test.run=^TestHelperLimitsProcess$"},
+		Env:     helperBotEnv(""),
+		Limits:  comms.Limits{OpenFiles: 1 << 40},
+	})
+	if err == nil {
+		t.Fatalf("expected error but got nil")
+	}
+	if want, have := "RLIMIT_NOFILE", err.Error(); !strings.Contains(have, want) {
+		t.Errorf("unexpected error. want %#v in %#v", want, have)
+	}
+	select {
+	case sess := <-sessions:
+		t.Errorf("unexpected session of the bot: %s", sess.ID())
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.Wait()
+}
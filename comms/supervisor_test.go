@@ -0,0 +1,259 @@
+package comms_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+)
+
+// forfeitRecord is the arguments of a forfeit callback.
+type forfeitRecord struct {
+	bot    string
+	sess   *comms.Session
+	reason error
+}
+
+// newTestSupervisor creates a supervisor that sends all handled
+// sessions and forfeits to the returned channels.
+func newTestSupervisor(logDir string) (*comms.Supervisor, <-chan *comms.Session, <-chan forfeitRecord) {
+	sessions := make(chan *comms.Session, 10)
+	forfeits := make(chan forfeitRecord, 10)
+	s := comms.NewSupervisor(comms.SessionHandlerFunc(func(s *comms.Session) error {
+		sessions <- s
+		return nil
+	}), logDir).OnForfeit(func(bot string, sess *comms.Session, reason error) {
+		forfeits <- forfeitRecord{bot: bot, sess: sess, reason: reason}
+	})
+	return s, sessions, forfeits
+}
+
+// isMoveEvent issues a move with "move" event.
+func isMoveEvent(m comms.Message) bool {
+	evt, ok := m.(comms.Event)
+	return ok && m.Type() == "event" && evt.EventType() == "move"
+}
+
+// expectSession waits for a session to be handled.
+func expectSession(t *testing.T, sessions <-chan *comms.Session) *comms.Session {
+	t.Helper()
+	select {
+	case sess := <-sessions:
+		return sess
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for session")
+		return nil
+	}
+}
+
+func TestSupervisor_MoveBudget(t *testing.T) {
+	s, sessions, forfeits := newTestSupervisor("")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := s.Launch(ctx, comms.BotSpec{
+		Name:       "silent",
+		Command:    helperBotArgs(),
+		Env:        helperBotEnv("silent"),
+		MoveBudget: 100 * time.Millisecond,
+		IsMove:     isMoveEvent,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error launching bot: %s", err)
+	}
+
+	sess := expectSession(t, sessions)
+	if _, err := sess.ReadMessage(); err != nil {
+		t.Fatalf("unexpected error reading hello: %s", err)
+	}
+
+	// Non-move message should not start the timer.
+	sess.WriteMessage(comms.NewEvent("notice", nil))
+	select {
+	case f := <-forfeits:
+		t.Fatalf("unexpected forfeit: %s", f.reason)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// The silent bot never replies to the move.
+	sess.WriteMessage(comms.NewEvent("move", nil))
+	select {
+	case f := <-forfeits:
+		if want, have := "silent", f.bot; want != have {
+			t.Errorf("unexpected bot. want %#v, have %#v", want, have)
+		}
+		if f.sess != sess {
+			t.Errorf("unexpected session in forfeit")
+		}
+		if !errors.Is(f.reason, comms.ErrMoveTimeout) {
+			t.Errorf("unexpected reason: %s", f.reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for forfeit")
+	}
+	s.Wait()
+}
+
+func TestSupervisor_MoveBudget_InTime(t *testing.T) {
+	s, sessions, forfeits := newTestSupervisor("")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := s.Launch(ctx, comms.BotSpec{
+		Name:       "echo",
+		Command:    helperBotArgs(),
+		Env:        helperBotEnv(""),
+		MoveBudget: time.Second,
+		IsMove:     isMoveEvent,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error launching bot: %s", err)
+	}
+
+	sess := expectSession(t, sessions)
+	sess.ReadMessage()
+	for i := 0; i < 3; i++ {
+		sess.WriteMessage(comms.NewEvent("move", nil))
+		m, err := sess.ReadMessage()
+		if err != nil {
+			t.Fatalf("unexpected error reading reply: %s", err)
+		}
+		if want, have := "bye", m.(comms.Request).RequestType(); want != have {
+			t.Errorf("unexpected request type. want %#v, have %#v", want, have)
+		}
+	}
+
+	// Stopping the supervisor is not a forfeit.
+	cancel()
+	s.Wait()
+	select {
+	case f := <-forfeits:
+		t.Errorf("unexpected forfeit: %s", f.reason)
+	default:
+	}
+}
+
+func TestSupervisor_Restart(t *testing.T) {
+	logDir := t.TempDir()
+	s, sessions, forfeits := newTestSupervisor(logDir)
+
+	err := s.Launch(context.Background(), comms.BotSpec{
+		Name:        "crashy",
+		Command:     helperBotArgs(),
+		Env:         helperBotEnv("crash"),
+		MaxRestarts: 2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error launching bot: %s", err)
+	}
+
+	// Started once, then restarted twice.
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		seen[expectSession(t, sessions).ID()] = true
+	}
+	if want, have := 3, len(seen); want != have {
+		t.Errorf("unexpected number of distinct sessions. want %d, have %d", want, have)
+	}
+
+	select {
+	case f := <-forfeits:
+		if !strings.Contains(f.reason.Error(), "crashed") {
+			t.Errorf("unexpected reason: %s", f.reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for forfeit")
+	}
+	s.Wait()
+
+	select {
+	case sess := <-sessions:
+		t.Errorf("unexpected extra session: %s", sess.ID())
+	default:
+	}
+
+	// Stderr of all runs are captured in the log file.
+	b, err := os.ReadFile(filepath.Join(logDir, "crashy.stderr.log"))
+	if err != nil {
+		t.Fatalf("unexpected error reading log: %s", err)
+	}
+	if want, have := 3, strings.Count(string(b), "helper bot crash"); want != have {
+		t.Errorf("unexpected number of crash logs. want %d, have %d\nlog: %s", want, have, b)
+	}
+}
+
+// leaveRecorder is a game that records the sessions left.
+type leaveRecorder chan string
+
+func (l leaveRecorder) HandleMessage(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+	return nil
+}
+
+func (l leaveRecorder) Leave(sessionID string, mw comms.MessageWriter) {
+	l <- sessionID
+}
+
+func TestSupervisor_RestartLeavesRoom(t *testing.T) {
+	left := make(leaveRecorder, 10)
+	rm := comms.NewRoomManager().Register("game", 2, func() comms.MessageHandler {
+		return left
+	})
+	sc := comms.NewSessionCollection()
+	mq := comms.NewSimpleMessageQueue(sc, 0)
+	mq.Start(rm, comms.NewSimpleMessageBroker(sc))
+	defer mq.Stop()
+
+	sessions := make(chan string, 10)
+	s := comms.NewSupervisor(comms.SessionHandlerFunc(func(sess *comms.Session) error {
+		sessions <- sess.ID()
+		return mq.HandleSession(sess)
+	}), t.TempDir())
+	err := s.Launch(context.Background(), comms.BotSpec{
+		Name:        "crashy",
+		Command:     helperBotArgs(),
+		Env:         helperBotEnv("join-crash"),
+		MaxRestarts: 1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error launching bot: %s", err)
+	}
+
+	// The game is told that the session of each run left, so it can
+	// forfeit the crashed bot.
+	for i := 0; i < 2; i++ {
+		var want string
+		select {
+		case want = <-sessions:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for session %d", i+1)
+		}
+		select {
+		case have := <-left:
+			if want != have {
+				t.Errorf("unexpected session left. want %s, have %s", want, have)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for session %s to leave", want)
+		}
+	}
+	s.Wait()
+}
+
+func TestSupervisor_Launch_Invalid(t *testing.T) {
+	s, _, _ := newTestSupervisor("")
+	if err := s.Launch(context.Background(), comms.BotSpec{Name: "no-command"}); err == nil {
+		t.Errorf("expected error launching bot without command")
+	}
+	err := s.Launch(context.Background(), comms.BotSpec{
+		Name:       "no-is-move",
+		Command:    helperBotArgs(),
+		MoveBudget: time.Second,
+	})
+	if err == nil {
+		t.Errorf("expected error launching bot with move budget but no IsMove")
+	}
+}
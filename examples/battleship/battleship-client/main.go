@@ -2,91 +2,104 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
 	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
 
 	"github.com/yookoala/botgame-playground/comms"
-	"github.com/yookoala/botgame-playground/examples/battleship/game"
+	"github.com/yookoala/botgame-playground/examples/battleship/bot"
 )
 
-type gameClient struct {
-	stage game.GameStage
-}
-
-func (c *gameClient) HandleMessage(ctx context.Context, m comms.Message, mw comms.MessageWriter) (err error) {
-
-	// Handle stage change event first.
-	if m.Type() == "event" {
-		evt := m.(comms.Event)
-		if evt.EventType() == "stage:change" {
-			log.Printf("received stage change message: %s", m)
-			evt.ReadDataTo(&c.stage)
-			log.Printf("stage changed to %s", c.stage)
-		}
+func main() {
+	// Connect to ./echo.sock, or talk over stdio if launched by the server.
+	// Listen to single-line JSON messages from the server.
+	// Handle the messages with the game client until interrupted.
+	stdio := flag.Bool("stdio", false, "talk to the server over standard input and output")
+	listen := flag.String("listen", "", "listen on \"<network>:<address>\" (e.g. unix:./bot.sock) for servers to connect, and play a game on every connection")
+	matchmake := flag.Bool("matchmake", false, "wait for an opponent with the matchmaker instead of joining any open room")
+	rating := flag.Float64("rating", comms.DefaultMatchRating, "rating for the matchmaker")
+	token := flag.String("token", "", "token to authenticate with the server, for the bot to be rated")
+	seed := flag.Int64("seed", 0, "seed to place ships and shoot at random reproducibly. A random seed if 0")
+	strategyName := flag.String("strategy", "hunt", "strategy of the bot: "+strings.Join(bot.StrategyNames, ", "))
+	flag.Parse()
+	if _, err := bot.NewStrategy(*strategyName, nil); err != nil {
+		log.Fatal(err)
 	}
 
-	switch c.stage {
-	case game.GameStageWaiting:
-		if m.Type() != "signal" {
-			return fmt.Errorf("invalid message type: %v", m.Type())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	newGameClient := func() comms.MessageHandler {
+		src := rand.NewSource(time.Now().UnixNano())
+		if *seed != 0 {
+			src = rand.NewSource(*seed)
 		}
-		sig := m.(comms.Signal)
-		if sig.Signal() != "client:init" {
-			return fmt.Errorf("invalid signal type: %v", sig.Signal())
+		s, _ := bot.NewStrategy(*strategyName, rand.New(src))
+		c := bot.NewClient(s).Token(*token)
+		if *matchmake {
+			c.Matchmake(*rating)
 		}
+		return c
+	}
 
-		// Annonce join game
-		err = mw.WriteMessage(comms.NewRequest("", "join", nil))
-		if err != nil {
+	if *listen != "" {
+		if err := serve(ctx, *listen, newGameClient); err != nil {
 			log.Fatal(err)
 		}
 		return
-	case game.GameStageSetup:
-		// send the ship allocations to game server then wait.
-		ships := make([]*game.ShipPlacement, 5)
-		ships[0], _ = game.NewShipPlacement(game.ShipIDCarrier, [2]int{0, 0}, game.ShipDirectionToRight)
-		ships[1], _ = game.NewShipPlacement(game.ShipIDBattleship, [2]int{0, 1}, game.ShipDirectionToRight)
-		ships[2], _ = game.NewShipPlacement(game.ShipIDCruiser, [2]int{0, 2}, game.ShipDirectionToRight)
-		ships[3], _ = game.NewShipPlacement(game.ShipIDSubmarine, [2]int{0, 3}, game.ShipDirectionToRight)
-		ships[4], _ = game.NewShipPlacement(game.ShipIDDestroyer, [2]int{0, 4}, game.ShipDirectionToRight)
-		err = mw.WriteMessage(comms.NewRequest("", "setup", ships))
-		return
-	case game.GameStagePlaying:
-		if m.Type() == "event" {
-			evt := m.(comms.Event)
-			log.Printf("playing stage. Event: %s", evt.EventType())
-			if evt.EventType() == "frame:update" {
-				// It's our turn, send a shot
-				log.Printf("frame update in playing stage")
-				err = mw.WriteMessage(comms.NewRequest("", "shot", [2]int{0, 0}))
-				return
-			}
-		}
 	}
 
-	return nil
-}
+	dialer := comms.NetDialer("unix", "./echo.sock")
+	if *stdio {
+		dialer = comms.StdioDialer()
+	}
 
-func NewGameClient() *gameClient {
-	return &gameClient{}
+	// Create a game client
+	cli := comms.NewClient(dialer, newGameClient())
+	if err := cli.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func main() {
-	// Connect to ./echo.sock
-	// Listen to single-line JSON messages from the server.
-	// Send a single-line JSON message with a greeting message.
-	// Close the connection
-
-	conn, err := net.Dial("unix", "./echo.sock")
+// serve listens on the address, and plays a game with a new game client
+// on every connection from servers until the context is cancelled.
+func serve(ctx context.Context, address string, newGameClient func() comms.MessageHandler) error {
+	network, address, ok := strings.Cut(address, ":")
+	if !ok {
+		return fmt.Errorf("invalid listen address: %s", address)
+	}
+	l, err := net.Listen(network, address)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
 
-	// Listen to OS signals
-	//comms.CloseOnSignal(conn, os.Interrupt)
-
-	// Create a game client
-	cli := NewGameClient()
-	comms.StartClient(cli, conn)
+	log.Printf("listening on %s", l.Addr())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		dialer := comms.DialerFunc(func(ctx context.Context) (io.ReadWriteCloser, error) {
+			return conn, nil
+		})
+		go func() {
+			if err := comms.NewClient(dialer, newGameClient()).Run(ctx); err != nil {
+				log.Printf("game client error: %s", err)
+			}
+		}()
+	}
 }
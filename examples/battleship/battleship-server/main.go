@@ -2,275 +2,25 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"os"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/yookoala/botgame-playground/comms"
 	"github.com/yookoala/botgame-playground/examples/battleship/game"
+	"github.com/yookoala/botgame-playground/examples/battleship/server"
+	"github.com/yookoala/botgame-playground/gameclock"
+	"github.com/yookoala/botgame-playground/ratings"
 )
 
-type dummyGame struct {
-	stage game.GameStage
-
-	player1 *comms.Session
-	player2 *comms.Session
-
-	playerState map[*comms.Session]game.PlayerState
-
-	lock *sync.Mutex
-
-	frameRequests map[string]comms.Request
-}
-
-func NewDummyGame() *dummyGame {
-	return &dummyGame{
-		lock: &sync.Mutex{},
-
-		playerState: make(map[*comms.Session]game.PlayerState),
-
-		frameRequests: make(map[string]comms.Request),
-	}
-}
-
-func (g *dummyGame) IsPlayerSession(sessionID string) bool {
-	return g.GetPlayerSession(sessionID) != nil
-}
-
-func (g *dummyGame) GetPlayerSession(sessionID string) *comms.Session {
-	if g.player1 != nil && g.player1.ID() == sessionID {
-		return g.player1
-	}
-	if g.player2 != nil && g.player2.ID() == sessionID {
-		return g.player2
-	}
-	return nil
-}
-
-func (g *dummyGame) HandleMessage(ctx context.Context, min comms.Message, mw comms.MessageWriter) error {
-
-	if min.Type() != "request" {
-		return fmt.Errorf("invalid request type: %v", min.Type())
-	}
-	// log.Printf("received message: %s, game stage: %s", min, g.stage)
-
-	// Resolve context variables.
-	sc := comms.GetSessionCollection(ctx)
-	sessionID := comms.GetSessionID(ctx)
-
-	if min.Type() == "signal" {
-		// Ignore signal for now.
-		return nil
-	}
-
-	switch g.stage {
-	case game.GameStageWaiting:
-
-		req := min.(comms.Request)
-		switch req.RequestType() {
-		case "join":
-			// TODO: more sophisticated player joinning request / response.
-			if g.player1 == nil && sc.Has(sessionID) {
-				if g.player2 != nil && g.player2.ID() == sessionID {
-					// player 1 cannot join again.
-					// ignore for now.
-					return nil
-				}
-
-				log.Printf("adding session as player 1: %s", sessionID)
-				g.lock.Lock()
-				g.player1 = sc.Get(sessionID)
-				g.lock.Unlock()
-
-				resp := comms.NewResponse(
-					sessionID,
-					req.RequestID(),
-					req.RequestType(),
-					200,
-					"success",
-					"player1",
-				)
-
-				err := mw.WriteMessage(resp)
-				if err != nil {
-					log.Printf("error sending response message: %s", err)
-					g.lock.Lock()
-					g.player1 = nil // unset player1
-					g.lock.Unlock()
-					return err
-				}
-
-				log.Printf("response send to player 1: %s", resp)
-			} else if g.player2 == nil && sc.Has(sessionID) {
-				if g.player1 != nil && g.player1.ID() == sessionID {
-					// player 1 cannot join again.
-					// ignore for now.
-					return nil
-				}
-				log.Printf("adding session as player 2: %s", sessionID)
-				g.lock.Lock()
-				g.player2 = sc.Get(sessionID)
-				g.lock.Unlock()
-
-				resp := comms.NewResponse(
-					sessionID,
-					req.RequestID(),
-					req.RequestType(),
-					200,
-					"success",
-					"player2",
-				)
-
-				err := mw.WriteMessage(resp)
-				if err != nil {
-					log.Printf("error sending response message: %s", err)
-					g.lock.Lock()
-					g.player2 = nil // unset player1
-					g.lock.Unlock()
-					return err
-				}
-
-				log.Printf("response send to player 2: %s", resp)
-			}
-
-			// After both player has joinned and all setup done
-			// start accepting game setup request.
-			if g.player1 != nil && g.player2 != nil {
-				log.Print("move on to setup stage")
-				g.lock.Lock()
-				g.stage = game.GameStageSetup
-				g.lock.Unlock()
-				mw.WriteMessage(comms.NewEvent("stage:change", game.GameStageSetup))
-			}
-
-		case "subscribe":
-			resp := comms.NewResponse(
-				sessionID,
-				req.RequestID(),
-				req.RequestType(),
-				200,
-				"success",
-				"subscribed",
-			)
-			err := mw.WriteMessage(resp)
-			if err != nil {
-				log.Printf("error sending response message: %s", err)
-				g.lock.Lock()
-				g.player2 = nil // unset player1
-				g.lock.Unlock()
-				return err
-			}
-
-		}
-
-	case game.GameStageSetup:
-		req := min.(comms.Request)
-		if req.RequestType() != "setup" {
-			return fmt.Errorf("invalid request type: %v", req.RequestType())
-		}
-
-		ships := make([]game.ShipPlacement, 5)
-		req.ReadDataTo(&ships)
-
-		// Only allow player to setup their own ships.
-		s := g.GetPlayerSession(comms.GetSessionID(ctx))
-		if s == nil {
-			mw.WriteMessage(comms.NewErrorResponse(
-				sessionID,
-				req.RequestID(),
-				403,
-				"error",
-				"forbidden",
-			))
-			return nil
-		}
-
-		// Each player can only setup once.
-		if _, ok := g.playerState[s]; ok {
-			mw.WriteMessage(comms.NewErrorResponse(
-				sessionID,
-				req.RequestID(),
-				400,
-				"error",
-				"state already set",
-			))
-			return nil
-		}
-
-		// Validate the ship placements.
-		shipStates := make(game.ShipStates, len(ships))
-		for i, sp := range ships {
-			ss, err := sp.ToShipState()
-			if err != nil {
-				mw.WriteMessage(comms.NewErrorResponse(
-					sessionID,
-					req.RequestID(),
-					400,
-					"error",
-					err.Error(),
-				))
-				return nil
-			}
-			shipStates[i] = *ss
-		}
-
-		if err := shipStates.Validate(); err != nil {
-			mw.WriteMessage(comms.NewErrorResponse(
-				sessionID,
-				req.RequestID(),
-				400,
-				"error",
-				err.Error(),
-			))
-			return nil
-		}
-
-		log.Printf("accepted setup: %v", shipStates)
-		g.playerState[s] = game.PlayerState{
-			Ready: true,
-			Ships: shipStates,
-		}
-
-		if len(g.playerState) == 2 {
-
-			// Announce stage change
-			mw.WriteMessage(comms.NewEvent(
-				"stage:change",
-				game.GameStagePlaying,
-			))
-
-			// Resolve initial frame (frame 0)
-			mw.WriteMessage(comms.NewEvent(
-				"frame:update",
-				nil,
-			))
-
-			// Change the game stage to playing
-			g.lock.Lock()
-			g.stage = game.GameStagePlaying
-			g.lock.Unlock()
-		}
-
-	case game.GameStagePlaying:
-		req := min.(comms.Request)
-		switch req.RequestType() {
-		case "shot":
-			g.lock.Lock()
-			if _, ok := g.frameRequests[sessionID]; !ok {
-				// Only accept the first shot request.
-				g.frameRequests[sessionID] = req
-			}
-			if len(g.frameRequests) == 2 {
-				// Both players has submitted their shot.
-				// Resolve the frame.
-				log.Printf("here!")
-			}
-			g.lock.Unlock()
-		}
-	}
-	return nil
+// isMove reports if the message issues a move to the player.
+func isMove(m comms.Message) bool {
+	evt, ok := m.(comms.Event)
+	return ok && m.Type() == "event" && evt.EventType() == "frame:update"
 }
 
 func main() {
@@ -287,6 +37,39 @@ func main() {
 	// When a connection is received, handle the connection in a goroutine.
 	// When the server is stopped, close the socket.
 
+	record := flag.String("record", "", "append all session traffic to the JSONL transcript file")
+	bots := make([]string, 0)
+	flag.Func("bot", "command of a bot to launch as child process talking over stdio (repeatable)", func(s string) error {
+		if strings.TrimSpace(s) == "" {
+			return fmt.Errorf("empty bot command")
+		}
+		bots = append(bots, s)
+		return nil
+	})
+	botLogs := flag.String("bot-logs", "", "directory to log stderr of bots. Logs to stderr of server if empty")
+	moveBudget := flag.Duration("move-budget", 0, "wall-clock time for a bot to make a move. 0 for no limit")
+	maxRestarts := flag.Int("max-restarts", 0, "times to restart a crashed bot before it forfeits")
+	botCPU := flag.Duration("bot-cpu", 0, "CPU time limit of each bot. 0 for no limit")
+	botMemory := flag.Uint64("bot-memory", 0, "address space limit of each bot in bytes. 0 for no limit")
+	botFiles := flag.Uint64("bot-files", 0, "open files limit of each bot. 0 for no limit")
+	tokens := flag.String("tokens", "", "file of bot identities and tokens for authentication, one \"<identity> <token>\" per line")
+	ratingsFile := flag.String("ratings", "", "JSON file to keep ratings of authenticated bots. Ratings are disabled if empty")
+	ratingSystem := flag.String("rating-system", "elo", "rating system: elo or glicko2")
+	adminTokens := flag.String("admin-tokens", "", "file of administrator identities and tokens, one \"<identity> <token>\" per line. Admin requests are disabled if empty")
+	moveTime := flag.Duration("move-time", 0, "game clock time limit of each shot. 0 for no limit")
+	timeBank := flag.Duration("time-bank", 0, "game clock time bank of each player for all shots of a game. 0 for no bank")
+	timeIncrement := flag.Duration("time-increment", 0, "time added to the time bank after each shot in time")
+	timeoutAction := flag.String("timeout-action", "forfeit", "action for players out of time: forfeit, random or skip")
+	turnMode := flag.String("turn-mode", "simultaneous", "how players take turns to shoot: simultaneous or alternating")
+	extraShot := flag.Bool("extra-shot", false, "grant another shot to a player who hits a ship, in alternating turn mode")
+	variant := flag.String("variant", "classic", "rule variant: classic, or salvo for one shot per ship afloat each frame")
+	board := flag.String("board", fmt.Sprintf("%dx%d", game.BoardSize, game.BoardSize), "board size as <width>x<height>")
+	fleet := flag.String("fleet", "", "fleet as comma separated <name>:<size>[x<count>], e.g. \"Carrier:5,Destroyer:2x2\". The classic fleet if empty")
+	noTouch := flag.Bool("no-touch", false, "forbid ships to be placed next to each other, even diagonally")
+	noReveal := flag.Bool("no-reveal", false, "keep ships sunk secret from the opponent, telling a shot that sinks a ship as a hit")
+	matchPolicy := flag.String("match-policy", "fifo", "policy to pair players in matchmaking: fifo, closest or widening")
+	flag.Parse()
+
 	// Create a socket
 	l, err := net.Listen("unix", "./echo.sock")
 	if err != nil {
@@ -308,11 +91,154 @@ func main() {
 	mq := comms.NewSimpleMessageQueue(sc, 0) // Fan-in session messages
 	mw := comms.NewSimpleMessageBroker(sc)   // Broke messages to sessions
 
-	// Compose the game with the input and output ends.
-	mq.Start(NewDummyGame(), mw)
+	// Host a new game in every room of 2 players.
+	action, err := gameclock.ParseAction(*timeoutAction)
+	if err != nil {
+		log.Fatal(err)
+	}
+	timeControl := gameclock.Config{
+		MoveTime:  *moveTime,
+		Bank:      *timeBank,
+		Increment: *timeIncrement,
+		Timeout:   action,
+	}
+	turns, err := game.ParseTurnMode(*turnMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	v, err := game.ParseVariant(*variant)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rules := game.DefaultRules()
+	if _, err := fmt.Sscanf(*board, "%dx%d", &rules.Width, &rules.Height); err != nil {
+		log.Fatalf("invalid board size %q: %s", *board, err)
+	}
+	if *fleet != "" {
+		if rules.Fleet, err = game.ParseFleet(*fleet); err != nil {
+			log.Fatal(err)
+		}
+	}
+	rules.NoTouch, rules.NoReveal = *noTouch, *noReveal
+	if err := rules.Validate(); err != nil {
+		log.Fatalf("invalid rules: %s", err)
+	}
+	rm := comms.NewRoomManager().Register("battleship", 2, func() comms.MessageHandler {
+		return server.NewGame().
+			TimeControl(gameclock.SystemClock(), timeControl).
+			Turns(turns, *extraShot).
+			Variant(v).
+			Rules(rules)
+	})
+
+	// Authenticate bots with tokens, if specified.
+	authn := comms.TokenAuthenticator{}
+	if *tokens != "" {
+		if authn, err = comms.LoadTokenFile(*tokens); err != nil {
+			log.Fatalf("error loading tokens: %s", err)
+		}
+	}
+
+	// Pair waiting players into new rooms.
+	var policy comms.MatchPolicy
+	switch *matchPolicy {
+	case "fifo":
+		policy = comms.FIFOPolicy()
+	case "closest":
+		policy = comms.ClosestRatingPolicy()
+	case "widening":
+		policy = comms.WideningWindowPolicy(100, 50, 0)
+	default:
+		log.Fatalf("unknown match policy: %s", *matchPolicy)
+	}
+	mm := comms.NewMatchmaker(rm, policy)
+	mm.Start(time.Second)
+	defer mm.Stop()
+
+	// Rate authenticated bots with the game results, if specified.
+	mux := comms.NewRequestMux(mm)
+	ah := comms.NewAuthHandler(authn, mux)
+	rm.Identify(ah.Identity)
+	if *ratingsFile != "" {
+		var system ratings.System
+		switch *ratingSystem {
+		case "elo":
+			system = ratings.NewElo(32)
+		case "glicko2":
+			system = ratings.NewGlicko2(0.5)
+		default:
+			log.Fatalf("unknown rating system: %s", *ratingSystem)
+		}
+		ladder, err := ratings.NewLadder(system, ratings.NewFileStore(*ratingsFile))
+		if err != nil {
+			log.Fatal(err)
+		}
+		mux.Handle("leaderboard", ladder)
+		mm.RateBy(func(identity string) float64 {
+			return ladder.Get(identity).Value
+		})
+		rm.OnEvent(func(r *comms.Room, evt comms.Event) {
+			if evt.EventType() != "game:result" {
+				return
+			}
+			var res ratings.GameResult
+			evt.ReadDataTo(&res)
+			// Identities of the room are kept for players who
+			// forfeited by disconnecting.
+			if err := ladder.RecordResult(res, r.Identity); err != nil {
+				log.Printf("room %s: %s", r.ID(), err)
+			}
+		})
+	}
+
+	// Let administrators control the games, if specified.
+	adminAuthn := comms.TokenAuthenticator{}
+	if *adminTokens != "" {
+		if adminAuthn, err = comms.LoadTokenFile(*adminTokens); err != nil {
+			log.Fatalf("error loading admin tokens: %s", err)
+		}
+	}
+	admin := comms.NewAdminHandler(adminAuthn, rm, ah)
+
+	// Compose the lobby with the input and output ends.
+	mq.Start(admin, mw)
+
+	// Record the traffic of all sessions, if specified.
+	var sh comms.SessionHandler = mq
+	if *record != "" {
+		rec, err := comms.OpenRecorder(*record)
+		if err != nil {
+			log.Fatalf("error opening transcript: %s", err)
+		}
+		defer rec.Close()
+		sh = rec.SessionHandler(mq)
+	}
+
+	// Launch bots as supervised child processes, if specified.
+	supervisor := comms.NewSupervisor(sh, *botLogs).
+		OnForfeit(func(bot string, sess *comms.Session, reason error) {
+			log.Printf("bot %s (session %s) forfeits: %s", bot, sess.ID(), reason)
+		})
+	for i, bot := range bots {
+		err := supervisor.Launch(context.Background(), comms.BotSpec{
+			Name:    fmt.Sprintf("bot%d", i+1),
+			Command: strings.Fields(bot),
+			Limits: comms.Limits{
+				CPUTime:   *botCPU,
+				Memory:    *botMemory,
+				OpenFiles: *botFiles,
+			},
+			MaxRestarts: *maxRestarts,
+			MoveBudget:  *moveBudget,
+			IsMove:      isMove,
+		})
+		if err != nil {
+			log.Fatalf("error launching bot %#v: %s", bot, err)
+		}
+	}
 
 	// Start passing socket request to the message queue.
-	err = comms.StartServer(l, mq)
+	err = comms.StartServer(l, sh)
 	if err != nil {
 		log.Printf("Server ended with error: %s (%#v)", err, err)
 	}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/yookoala/botgame-playground/comms"
+)
+
+// bot is a participant of the tournament.
+type bot struct {
+	// Name identifies the bot in results.
+	Name string
+
+	// Command is the executable and arguments of a bot that talks
+	// over standard input and output. Empty for bots at an address.
+	Command []string
+
+	// Network and Address of a bot that listens for the server
+	// to connect (e.g. "unix", "./bot.sock").
+	Network string
+	Address string
+}
+
+// parseBot parses a bot from command line argument, in the form of
+// "[name=]<command>" or "[name=]<network>:<address>". Supported
+// networks are "unix" and "tcp". The name defaults to the argument.
+func parseBot(arg string) (b bot, err error) {
+	spec := arg
+	if name, rest, ok := strings.Cut(arg, "="); ok && !strings.ContainsAny(name, " :/") {
+		b.Name, spec = name, rest
+	}
+	if b.Name == "" {
+		b.Name = spec
+	}
+
+	if network, address, ok := strings.Cut(spec, ":"); ok && (network == "unix" || network == "tcp") {
+		b.Network, b.Address = network, address
+		return b, nil
+	}
+	b.Command = strings.Fields(spec)
+	if len(b.Command) == 0 {
+		return b, fmt.Errorf("empty bot: %#v", arg)
+	}
+	return b, nil
+}
+
+// connect starts or dials the bot, and hands its session to the session
+// handler. The stderr of executable bots are appended to a log file in
+// logDir, or discarded if logDir is empty.
+func (b bot) connect(sh comms.SessionHandler, logDir string) (*comms.Session, error) {
+	if b.Network != "" {
+		conn, err := net.Dial(b.Network, b.Address)
+		if err != nil {
+			return nil, fmt.Errorf("bot %s: %w", b.Name, err)
+		}
+		return comms.ServeConn(conn, sh), nil
+	}
+
+	cmd := exec.Command(b.Command[0], b.Command[1:]...)
+	var stderr io.Closer
+	if logDir != "" {
+		f, err := os.OpenFile(filepath.Join(logDir, logName(b.Name)+".stderr.log"),
+			os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("bot %s: %w", b.Name, err)
+		}
+		cmd.Stderr, stderr = f, f
+	}
+	sess, err := comms.LaunchProcess(cmd, sh)
+	if err != nil {
+		if stderr != nil {
+			stderr.Close()
+		}
+		return nil, fmt.Errorf("bot %s: %w", b.Name, err)
+	}
+	if stderr != nil {
+		sess.OnClose(func(*comms.Session) {
+			stderr.Close()
+		})
+	}
+	return sess, nil
+}
+
+// logName returns the bot name safe to be used as file name.
+func logName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == ' ' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Tournament formats.
+const (
+	formatRoundRobin = "roundrobin"
+	formatSwiss      = "swiss"
+	formatKnockout   = "knockout"
+)
+
+// pairing is a match of 2 bots in a round, by index of the bots. B is -1
+// for a bye of A.
+type pairing struct {
+	Round int
+	A, B  int
+}
+
+// matchPlayer plays a series between 2 bots, e.g. the referee.
+type matchPlayer interface {
+	playMatch(ctx context.Context, round int, a, b bot) matchResult
+}
+
+// tournament runs the matches of a tournament format.
+type tournament struct {
+	bots        []bot
+	referee     matchPlayer
+	concurrency int
+}
+
+// run runs the tournament of the format. Swiss tournaments are played
+// in the given number of rounds, or enough rounds to find a winner if
+// rounds is not positive.
+func (t *tournament) run(ctx context.Context, format string, rounds int) ([]matchResult, error) {
+	switch format {
+	case formatRoundRobin:
+		return t.playRound(ctx, roundRobinPairings(len(t.bots))), nil
+	case formatSwiss:
+		if rounds <= 0 {
+			rounds = int(math.Ceil(math.Log2(float64(len(t.bots)))))
+		}
+		return t.runSwiss(ctx, rounds), nil
+	case formatKnockout:
+		return t.runKnockout(ctx), nil
+	}
+	return nil, fmt.Errorf("unknown format: %s", format)
+}
+
+// playRound plays the matches concurrently, and returns the results in
+// the order of the pairings.
+func (t *tournament) playRound(ctx context.Context, pairings []pairing) []matchResult {
+	results := make([]matchResult, len(pairings))
+	sem := make(chan struct{}, t.concurrency)
+	wg := &sync.WaitGroup{}
+	for i, p := range pairings {
+		if p.B < 0 {
+			results[i] = matchResult{Round: p.Round, A: t.bots[p.A].Name, Bye: true, Winner: t.bots[p.A].Name}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, p pairing) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = t.referee.playMatch(ctx, p.Round, t.bots[p.A], t.bots[p.B])
+		}(i, p)
+	}
+	wg.Wait()
+	return results
+}
+
+// roundRobinPairings pairs every bot with every other bot once, by the
+// circle method so no bot plays twice in a round. Bots with no opponent
+// in a round (odd number of bots) sit out without a bye.
+func roundRobinPairings(n int) []pairing {
+	circle := make([]int, n)
+	for i := range circle {
+		circle[i] = i
+	}
+	if n%2 == 1 {
+		circle = append(circle, -1)
+	}
+
+	pairings := make([]pairing, 0, n*(n-1)/2)
+	size := len(circle)
+	for round := 1; round < size; round++ {
+		for i := 0; i < size/2; i++ {
+			a, b := circle[i], circle[size-1-i]
+			if a >= 0 && b >= 0 {
+				pairings = append(pairings, pairing{Round: round, A: a, B: b})
+			}
+		}
+		// Rotate all but the first.
+		last := circle[size-1]
+		copy(circle[2:], circle[1:size-1])
+		circle[1] = last
+	}
+	return pairings
+}
+
+// runSwiss plays the rounds of a Swiss tournament. In each round, bots
+// of similar points are paired, avoiding rematches when possible.
+func (t *tournament) runSwiss(ctx context.Context, rounds int) []matchResult {
+	results := make([]matchResult, 0)
+	for round := 1; round <= rounds && ctx.Err() == nil; round++ {
+		standings := computeStandings(t.bots, results, false)
+		order := make([]int, len(standings))
+		for i, s := range standings {
+			order[i] = s.seed
+		}
+		results = append(results, t.playRound(ctx, swissPairings(round, order, results, t.bots))...)
+	}
+	return results
+}
+
+// swissPairings pairs the bots in the order of standings. The lowest
+// ranked bot without a bye gets a bye if there are odd number of bots.
+func swissPairings(round int, order []int, played []matchResult, bots []bot) []pairing {
+	met := make(map[[2]string]bool)
+	hadBye := make(map[string]bool)
+	for _, m := range played {
+		if m.Bye {
+			hadBye[m.A] = true
+			continue
+		}
+		met[[2]string{m.A, m.B}], met[[2]string{m.B, m.A}] = true, true
+	}
+
+	pairings := make([]pairing, 0, len(order)/2+1)
+	remaining := append([]int{}, order...)
+	if len(remaining)%2 == 1 {
+		bye := len(remaining) - 1
+		for i := len(remaining) - 1; i >= 0; i-- {
+			if !hadBye[bots[remaining[i]].Name] {
+				bye = i
+				break
+			}
+		}
+		pairings = append(pairings, pairing{Round: round, A: remaining[bye], B: -1})
+		remaining = append(remaining[:bye], remaining[bye+1:]...)
+	}
+
+	for len(remaining) > 0 {
+		a := remaining[0]
+		opponent := 1
+		for i := 1; i < len(remaining); i++ {
+			if !met[[2]string{bots[a].Name, bots[remaining[i]].Name}] {
+				opponent = i
+				break
+			}
+		}
+		pairings = append(pairings, pairing{Round: round, A: a, B: remaining[opponent]})
+		remaining = append(remaining[1:opponent], remaining[opponent+1:]...)
+	}
+	return pairings
+}
+
+// runKnockout plays a single-elimination tournament, seeded by the order
+// of the bots. Top seeds get byes in the first round to fill the bracket.
+// A drawn series is recorded as a draw, and the higher seed advances.
+func (t *tournament) runKnockout(ctx context.Context) []matchResult {
+	results := make([]matchResult, 0)
+	alive := make([]int, len(t.bots))
+	for i := range alive {
+		alive[i] = i
+	}
+
+	for round := 1; len(alive) > 1 && ctx.Err() == nil; round++ {
+		pairings := knockoutPairings(round, alive)
+		played := t.playRound(ctx, pairings)
+		next := make([]int, 0, len(alive)/2+1)
+		for i, m := range played {
+			advanced := pairings[i].A
+			switch {
+			case m.Bye:
+			case m.Winner == "":
+				// Higher seed advances.
+				played[i].Tiebreak = true
+			case m.Winner != t.bots[advanced].Name:
+				advanced = pairings[i].B
+			}
+			played[i].Advanced = t.bots[advanced].Name
+			next = append(next, advanced)
+		}
+		results = append(results, played...)
+		sort.Ints(next)
+		alive = next
+	}
+	return results
+}
+
+// knockoutPairings pairs the highest seed with the lowest seed. In a round
+// with a number of bots that is not a power of 2, the top seeds get byes
+// so the next round is.
+func knockoutPairings(round int, seeds []int) []pairing {
+	size := 1
+	for size < len(seeds) {
+		size *= 2
+	}
+	byes := size - len(seeds)
+
+	pairings := make([]pairing, 0, size/2)
+	for _, s := range seeds[:byes] {
+		pairings = append(pairings, pairing{Round: round, A: s, B: -1})
+	}
+	rest := seeds[byes:]
+	for i := 0; i < len(rest)/2; i++ {
+		pairings = append(pairings, pairing{Round: round, A: rest[i], B: rest[len(rest)-1-i]})
+	}
+	return pairings
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// testBots returns n bots named by seed, e.g. "bot0".
+func testBots(n int) []bot {
+	bots := make([]bot, n)
+	for i := range bots {
+		bots[i] = bot{Name: fmt.Sprintf("bot%d", i)}
+	}
+	return bots
+}
+
+// matchFunc plays a series by a function of the round and the bots.
+type matchFunc func(round int, a, b bot) matchResult
+
+func (f matchFunc) playMatch(ctx context.Context, round int, a, b bot) matchResult {
+	return f(round, a, b)
+}
+
+// seedWins is a matchFunc where bot A, the higher seed, wins 2-0.
+func seedWins(round int, a, b bot) matchResult {
+	return matchResult{Round: round, A: a.Name, B: b.Name, WinsA: 2, Winner: a.Name}
+}
+
+func TestRoundRobinPairings(t *testing.T) {
+	for n := 2; n <= 7; n++ {
+		pairings := roundRobinPairings(n)
+		if want, have := n*(n-1)/2, len(pairings); want != have {
+			t.Errorf("n=%d: unexpected number of pairings. want %d, have %d", n, want, have)
+		}
+
+		met := make(map[[2]int]bool)
+		played := make(map[[2]int]bool)
+		rounds := 0
+		for _, p := range pairings {
+			if p.A == p.B || p.A < 0 || p.B < 0 || p.A >= n || p.B >= n {
+				t.Fatalf("n=%d: invalid pairing %#v", n, p)
+			}
+			if met[[2]int{p.A, p.B}] || met[[2]int{p.B, p.A}] {
+				t.Errorf("n=%d: bots %d and %d met twice", n, p.A, p.B)
+			}
+			met[[2]int{p.A, p.B}] = true
+			for _, i := range []int{p.A, p.B} {
+				if played[[2]int{p.Round, i}] {
+					t.Errorf("n=%d: bot %d played twice in round %d", n, i, p.Round)
+				}
+				played[[2]int{p.Round, i}] = true
+			}
+			rounds = max(rounds, p.Round)
+		}
+		if want, have := n-1+n%2, rounds; want != have {
+			t.Errorf("n=%d: unexpected number of rounds. want %d, have %d", n, want, have)
+		}
+	}
+}
+
+func TestSwissPairings(t *testing.T) {
+	bots := testBots(5)
+	tests := []struct {
+		name   string
+		order  []int
+		played []matchResult
+		want   []pairing
+	}{
+		{
+			name:  "first round",
+			order: []int{0, 1, 2, 3},
+			want:  []pairing{{1, 0, 1}, {1, 2, 3}},
+		},
+		{
+			name:   "avoid rematch",
+			order:  []int{0, 1, 2, 3},
+			played: []matchResult{{A: "bot1", B: "bot0"}, {A: "bot2", B: "bot3"}},
+			want:   []pairing{{1, 0, 2}, {1, 1, 3}},
+		},
+		{
+			name:   "rematch if all met",
+			order:  []int{1, 0},
+			played: []matchResult{{A: "bot0", B: "bot1"}},
+			want:   []pairing{{1, 1, 0}},
+		},
+		{
+			name:  "bye to the lowest ranked",
+			order: []int{2, 0, 1},
+			want:  []pairing{{1, 1, -1}, {1, 2, 0}},
+		},
+		{
+			name:   "one bye per bot",
+			order:  []int{0, 1, 2, 3, 4},
+			played: []matchResult{{A: "bot4", Bye: true}, {A: "bot3", Bye: true}},
+			want:   []pairing{{1, 2, -1}, {1, 0, 1}, {1, 3, 4}},
+		},
+		{
+			name:   "bye again if all had one",
+			order:  []int{0, 1, 2},
+			played: []matchResult{{A: "bot0", Bye: true}, {A: "bot1", Bye: true}, {A: "bot2", Bye: true}},
+			want:   []pairing{{1, 2, -1}, {1, 0, 1}},
+		},
+	}
+	for _, test := range tests {
+		have := swissPairings(1, test.order, test.played, bots)
+		if fmt.Sprint(test.want) != fmt.Sprint(have) {
+			t.Errorf("%s: unexpected pairings. want %v, have %v", test.name, test.want, have)
+		}
+	}
+}
+
+func TestKnockoutPairings(t *testing.T) {
+	tests := []struct {
+		seeds []int
+		want  []pairing
+	}{
+		{[]int{0, 1}, []pairing{{1, 0, 1}}},
+		{[]int{0, 1, 2}, []pairing{{1, 0, -1}, {1, 1, 2}}},
+		{[]int{0, 1, 2, 3}, []pairing{{1, 0, 3}, {1, 1, 2}}},
+		{[]int{0, 1, 2, 3, 4}, []pairing{{1, 0, -1}, {1, 1, -1}, {1, 2, -1}, {1, 3, 4}}},
+		{[]int{0, 1, 2, 3, 4, 5}, []pairing{{1, 0, -1}, {1, 1, -1}, {1, 2, 5}, {1, 3, 4}}},
+		{[]int{1, 2, 4, 6}, []pairing{{1, 1, 6}, {1, 2, 4}}},
+	}
+	for _, test := range tests {
+		if have := knockoutPairings(1, test.seeds); fmt.Sprint(test.want) != fmt.Sprint(have) {
+			t.Errorf("seeds %v: unexpected pairings. want %v, have %v", test.seeds, test.want, have)
+		}
+	}
+}
+
+func TestRunKnockout(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		play   matchFunc
+		want   []string
+		winner string
+	}{
+		{
+			name: "higher seeds win",
+			n:    5,
+			play: seedWins,
+			want: []string{
+				"1 bot0 bye", "1 bot1 bye", "1 bot2 bye", "1 bot3-bot4 bot3",
+				"2 bot0-bot3 bot0", "2 bot1-bot2 bot1",
+				"3 bot0-bot1 bot0",
+			},
+			winner: "bot0",
+		},
+		{
+			name: "upsets and draws",
+			n:    4,
+			play: func(round int, a, b bot) matchResult {
+				m := matchResult{Round: round, A: a.Name, B: b.Name, Draws: 2}
+				if a.Name == "bot0" {
+					// The top seed loses.
+					m.Draws, m.WinsB, m.Winner = 0, 2, b.Name
+				}
+				return m
+			},
+			want: []string{
+				"1 bot0-bot3 bot3", "1 bot1-bot2 bot1 tiebreak",
+				"2 bot1-bot3 bot1 tiebreak",
+			},
+			winner: "bot1",
+		},
+		{
+			name: "single bot",
+			n:    1,
+			play: seedWins,
+		},
+	}
+	for _, test := range tests {
+		tm := &tournament{bots: testBots(test.n), referee: test.play, concurrency: 2}
+		results := tm.runKnockout(context.Background())
+		have := make([]string, len(results))
+		for i, m := range results {
+			if m.Bye {
+				have[i] = fmt.Sprintf("%d %s bye", m.Round, m.A)
+				continue
+			}
+			have[i] = fmt.Sprintf("%d %s-%s %s", m.Round, m.A, m.B, m.Advanced)
+			if m.Tiebreak {
+				// A draw is kept as the result of the series.
+				if m.Winner != "" {
+					t.Errorf("%s: unexpected winner of drawn series %s-%s: %s", test.name, m.A, m.B, m.Winner)
+				}
+				have[i] += " tiebreak"
+			}
+		}
+		if fmt.Sprint(test.want) != fmt.Sprint(have) {
+			t.Errorf("%s: unexpected matches.\nwant %q\nhave %q", test.name, test.want, have)
+		}
+		if test.winner == "" {
+			continue
+		}
+		if want, have := test.winner, computeStandings(tm.bots, results, true)[0].Name; want != have {
+			t.Errorf("%s: unexpected winner. want %s, have %s", test.name, want, have)
+		}
+	}
+}
+
+func TestRunSwiss(t *testing.T) {
+	tm := &tournament{bots: testBots(4), referee: matchFunc(seedWins), concurrency: 2}
+	results := tm.runSwiss(context.Background(), 3)
+	if want, have := 6, len(results); want != have {
+		t.Fatalf("unexpected number of matches. want %d, have %d", want, have)
+	}
+
+	// 3 rounds of 4 bots are a round robin without rematches.
+	met := make(map[[2]string]bool)
+	for _, m := range results {
+		if met[[2]string{m.A, m.B}] || met[[2]string{m.B, m.A}] {
+			t.Errorf("unexpected rematch of %s and %s in round %d", m.A, m.B, m.Round)
+		}
+		met[[2]string{m.A, m.B}] = true
+	}
+	standings := computeStandings(tm.bots, results, false)
+	for i, s := range standings {
+		if want, have := fmt.Sprintf("bot%d", i), s.Name; want != have {
+			t.Errorf("unexpected rank %d. want %s, have %s", i+1, want, have)
+		}
+	}
+}
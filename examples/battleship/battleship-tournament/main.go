@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// report is the JSON output of the tournament.
+type report struct {
+	Format    string        `json:"format"`
+	BestOf    int           `json:"bestOf"`
+	Bots      []string      `json:"bots"`
+	Standings []standing    `json:"standings"`
+	Matches   []matchResult `json:"matches"`
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [options] <bot> <bot> [<bot> ...]
+
+Run a battleship tournament between bots. Each bot is either:
+  [name=]<command>          executable talking over stdio, e.g. "bot1=./bs-client -stdio"
+  [name=]<network>:<addr>   bot listening for connections, e.g. "unix:./bot.sock"
+Bots are seeded in the given order.
+
+Options:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	format := flag.String("format", formatRoundRobin, "tournament format: roundrobin, swiss or knockout")
+	bestOf := flag.Int("best-of", 1, "number of games in a series. The series ends once a bot wins the majority")
+	rounds := flag.Int("rounds", 0, "number of rounds in a swiss tournament. 0 for log2 of the number of bots")
+	concurrency := flag.Int("concurrency", 1, "number of matches to play at the same time")
+	timeout := flag.Duration("game-timeout", time.Minute, "time limit of a game. The game is a draw if no result in time")
+	out := flag.String("out", "tournament.json", "file to write the standings and match results as JSON. \"-\" for stdout")
+	logDir := flag.String("bot-logs", "", "directory to log stderr of executable bots. Discarded if empty")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *bestOf < 1 || *concurrency < 1 {
+		log.Fatal("best-of and concurrency must be positive")
+	}
+	bots := make([]bot, flag.NArg())
+	names := make(map[string]bool)
+	for i, arg := range flag.Args() {
+		b, err := parseBot(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if names[b.Name] {
+			log.Fatalf("duplicated bot name: %s", b.Name)
+		}
+		names[b.Name] = true
+		bots[i] = b
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	t := &tournament{
+		bots: bots,
+		referee: &referee{
+			bestOf:  *bestOf,
+			timeout: *timeout,
+			logDir:  *logDir,
+		},
+		concurrency: *concurrency,
+	}
+	results, err := t.run(ctx, *format, *rounds)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := report{
+		Format:    *format,
+		BestOf:    *bestOf,
+		Bots:      make([]string, len(bots)),
+		Standings: computeStandings(bots, results, *format == formatKnockout),
+		Matches:   results,
+	}
+	for i, b := range bots {
+		r.Bots[i] = b.Name
+	}
+	printStandings(os.Stdout, r.Standings)
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *out == "-" {
+		fmt.Println(string(b))
+		return
+	}
+	if err := os.WriteFile(*out, append(b, '\n'), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
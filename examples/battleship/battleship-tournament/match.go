@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+	"github.com/yookoala/botgame-playground/examples/battleship/server"
+	"github.com/yookoala/botgame-playground/ratings"
+)
+
+// Reasons a game ends.
+const (
+	reasonResult  = "result"
+	reasonForfeit = "forfeit"
+	reasonTimeout = "timeout"
+	reasonError   = "error"
+)
+
+// gameResult is the result of a single game.
+type gameResult struct {
+	// First is the bot connected first, i.e. player 1.
+	First string `json:"first"`
+
+	// Winner is the name of the winner. Empty for a draw.
+	Winner string `json:"winner,omitempty"`
+
+	Reason   string  `json:"reason"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"durationSec"`
+}
+
+// matchResult is the result of a best-of-N series between 2 bots, or
+// a bye of bot A.
+type matchResult struct {
+	Round int    `json:"round"`
+	A     string `json:"a"`
+	B     string `json:"b,omitempty"`
+	Bye   bool   `json:"bye,omitempty"`
+
+	Games []gameResult `json:"games,omitempty"`
+	WinsA int          `json:"winsA"`
+	WinsB int          `json:"winsB"`
+	Draws int          `json:"draws"`
+
+	// Winner is the name of the winner of the series. Empty for a draw.
+	Winner string `json:"winner,omitempty"`
+
+	// Advanced is the name of the bot advancing to the next round of a
+	// knockout tournament. Tiebreak is true if the series is drawn, and
+	// the higher seed advances.
+	Advanced string `json:"advanced,omitempty"`
+	Tiebreak bool   `json:"tiebreak,omitempty"`
+}
+
+// referee runs games between bots.
+type referee struct {
+	bestOf  int
+	timeout time.Duration
+	logDir  string
+}
+
+// playMatch plays a best-of-N series between the bots. The bots take
+// turns to be player 1. The series ends once a bot has won the majority.
+func (ref *referee) playMatch(ctx context.Context, round int, a, b bot) matchResult {
+	m := matchResult{Round: round, A: a.Name, B: b.Name}
+	for i := 0; i < ref.bestOf; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		first, second := a, b
+		if i%2 == 1 {
+			first, second = b, a
+		}
+		g := ref.playGame(ctx, first, second)
+		m.Games = append(m.Games, g)
+		switch g.Winner {
+		case a.Name:
+			m.WinsA++
+		case b.Name:
+			m.WinsB++
+		default:
+			m.Draws++
+		}
+		if m.WinsA*2 > ref.bestOf || m.WinsB*2 > ref.bestOf {
+			break
+		}
+	}
+	if m.WinsA > m.WinsB {
+		m.Winner = a.Name
+	} else if m.WinsB > m.WinsA {
+		m.Winner = b.Name
+	}
+	return m
+}
+
+// playGame hosts a new battleship game for the bots, and waits for the
+// "game:result" event of the game. A bot that disconnects before the
+// result forfeits. The game is a draw if there is no result in time.
+func (ref *referee) playGame(ctx context.Context, first, second bot) (g gameResult) {
+	start := time.Now()
+	g.First = first.Name
+	defer func() {
+		g.Duration = time.Since(start).Seconds()
+	}()
+
+	// Host the game like battleship-server does, so the bots can
+	// join the room as usual.
+	results := make(chan ratings.GameResult, 1)
+	rm := comms.NewRoomManager().
+		Register("battleship", 2, func() comms.MessageHandler {
+			return server.NewGame()
+		}).
+		OnEvent(func(r *comms.Room, evt comms.Event) {
+			if evt.EventType() != "game:result" {
+				return
+			}
+			var res ratings.GameResult
+			evt.ReadDataTo(&res)
+			select {
+			case results <- res:
+			default:
+			}
+		})
+	sc := comms.NewSessionCollection()
+	mq := comms.NewSimpleMessageQueue(sc, 0)
+	mq.Start(comms.NewMatchmaker(rm, comms.FIFOPolicy()), comms.NewSimpleMessageBroker(sc))
+	defer mq.Stop()
+
+	// Connect the bots. Player 1 joins first.
+	names := make(map[string]string)
+	closed := make(chan string, 2)
+	for i, b := range []bot{first, second} {
+		sess, err := b.connect(mq, ref.logDir)
+		if err != nil {
+			// The bot cannot be started or reached. It forfeits.
+			g.Reason, g.Error = reasonForfeit, err.Error()
+			g.Winner = second.Name
+			if i == 1 {
+				g.Winner = first.Name
+			}
+			return
+		}
+		defer sess.Close()
+		names[sess.ID()] = b.Name
+		sess.OnClose(func(s *comms.Session) {
+			closed <- s.ID()
+		})
+		if i == 0 {
+			// Wait for player 1 to join the room first.
+			waitForRoom(ctx, rm, sess.ID(), ref.timeout)
+		}
+	}
+
+	select {
+	case res := <-results:
+		g.Winner, g.Reason = names[res.Winner], reasonResult
+	case id := <-closed:
+		g.Reason = reasonForfeit
+		for _, name := range names {
+			if name != names[id] {
+				g.Winner = name
+			}
+		}
+	case <-time.After(ref.timeout):
+		g.Reason = reasonTimeout
+	case <-ctx.Done():
+		g.Reason, g.Error = reasonError, ctx.Err().Error()
+	}
+	return
+}
+
+// waitForRoom waits until the session joined a room, or until timeout.
+func waitForRoom(ctx context.Context, rm *comms.RoomManager, sessionID string, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for rm.RoomOf(sessionID) == nil && time.Now().Before(deadline) && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// standing is the standing of a bot in the tournament. A series won,
+// drawn or lost scores 1, 0.5 or 0 points. A bye scores 1 point.
+type standing struct {
+	Rank   int     `json:"rank"`
+	Name   string  `json:"name"`
+	Points float64 `json:"points"`
+
+	Won   int `json:"won"`
+	Drawn int `json:"drawn"`
+	Lost  int `json:"lost"`
+	Byes  int `json:"byes"`
+
+	GamesWon   int `json:"gamesWon"`
+	GamesDrawn int `json:"gamesDrawn"`
+	GamesLost  int `json:"gamesLost"`
+
+	// Reached is the last round the bot played in a knockout tournament.
+	Reached int `json:"reached,omitempty"`
+
+	seed       int
+	eliminated bool
+}
+
+// computeStandings computes the standings from the match results. Bots
+// are ranked by points, then by the game difference, then by seed. In a
+// knockout tournament, bots are ranked by the round they reached first,
+// then the bot still in the tournament above the one eliminated.
+func computeStandings(bots []bot, results []matchResult, knockout bool) []standing {
+	standings := make([]standing, len(bots))
+	index := make(map[string]int, len(bots))
+	for i, b := range bots {
+		standings[i] = standing{Name: b.Name, seed: i}
+		index[b.Name] = i
+	}
+
+	for _, m := range results {
+		a := &standings[index[m.A]]
+		if m.Bye {
+			a.Points++
+			a.Byes++
+			a.Reached = max(a.Reached, m.Round)
+			continue
+		}
+		b := &standings[index[m.B]]
+		a.Reached, b.Reached = max(a.Reached, m.Round), max(b.Reached, m.Round)
+		a.GamesWon, a.GamesLost, a.GamesDrawn = a.GamesWon+m.WinsA, a.GamesLost+m.WinsB, a.GamesDrawn+m.Draws
+		b.GamesWon, b.GamesLost, b.GamesDrawn = b.GamesWon+m.WinsB, b.GamesLost+m.WinsA, b.GamesDrawn+m.Draws
+		switch m.Advanced {
+		case m.A:
+			b.eliminated = true
+		case m.B:
+			a.eliminated = true
+		}
+		switch m.Winner {
+		case m.A:
+			a.Points++
+			a.Won++
+			b.Lost++
+		case m.B:
+			b.Points++
+			b.Won++
+			a.Lost++
+		default:
+			a.Points += 0.5
+			b.Points += 0.5
+			a.Drawn++
+			b.Drawn++
+		}
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if knockout && a.Reached != b.Reached {
+			return a.Reached > b.Reached
+		}
+		if knockout && a.eliminated != b.eliminated {
+			return !a.eliminated
+		}
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if da, db := a.GamesWon-a.GamesLost, b.GamesWon-b.GamesLost; da != db {
+			return da > db
+		}
+		return a.seed < b.seed
+	})
+	for i := range standings {
+		standings[i].Rank = i + 1
+	}
+	return standings
+}
+
+// printStandings prints the standings as a table.
+func printStandings(w io.Writer, standings []standing) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANK\tBOT\tPOINTS\tW-D-L\tGAMES W-D-L")
+	for _, s := range standings {
+		fmt.Fprintf(tw, "%d\t%s\t%.1f\t%d-%d-%d\t%d-%d-%d\n",
+			s.Rank, s.Name, s.Points,
+			s.Won, s.Drawn, s.Lost,
+			s.GamesWon, s.GamesDrawn, s.GamesLost)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestComputeStandings(t *testing.T) {
+	bots := testBots(4)
+	tests := []struct {
+		name     string
+		results  []matchResult
+		knockout bool
+		want     []string
+	}{
+		{
+			name: "no results by seed",
+			want: []string{"bot0 0.0", "bot1 0.0", "bot2 0.0", "bot3 0.0"},
+		},
+		{
+			name: "points",
+			results: []matchResult{
+				{A: "bot0", B: "bot3", WinsB: 2, Winner: "bot3"},
+				{A: "bot1", B: "bot2", WinsA: 1, Draws: 1, Winner: "bot1"},
+				{A: "bot3", Bye: true},
+			},
+			want: []string{"bot3 2.0", "bot1 1.0", "bot2 0.0", "bot0 0.0"},
+		},
+		{
+			name: "draws",
+			results: []matchResult{
+				{A: "bot0", B: "bot1", WinsA: 1, WinsB: 1, Draws: 1},
+				{A: "bot2", B: "bot3", Draws: 3},
+			},
+			want: []string{"bot0 0.5", "bot1 0.5", "bot2 0.5", "bot3 0.5"},
+		},
+		{
+			name: "game difference",
+			results: []matchResult{
+				{A: "bot0", B: "bot1", WinsA: 2, WinsB: 1, Winner: "bot0"},
+				{A: "bot2", B: "bot3", WinsA: 3, Winner: "bot2"},
+			},
+			want: []string{"bot2 1.0", "bot0 1.0", "bot1 0.0", "bot3 0.0"},
+		},
+		{
+			name: "knockout by round reached",
+			results: []matchResult{
+				{Round: 1, A: "bot0", Bye: true},
+				{Round: 1, A: "bot1", B: "bot2", WinsB: 2, Winner: "bot2"},
+				{Round: 1, A: "bot3", Bye: true},
+				{Round: 2, A: "bot0", B: "bot2", WinsB: 2, Winner: "bot2"},
+				{Round: 2, A: "bot3", Bye: true},
+				{Round: 3, A: "bot2", B: "bot3", WinsA: 2, Winner: "bot2"},
+			},
+			knockout: true,
+			want:     []string{"bot2 3.0", "bot3 2.0", "bot0 1.0", "bot1 0.0"},
+		},
+		{
+			name: "knockout drawn final",
+			results: []matchResult{
+				{Round: 1, A: "bot0", Bye: true, Winner: "bot0", Advanced: "bot0"},
+				{Round: 1, A: "bot1", B: "bot2", WinsB: 2, Winner: "bot2", Advanced: "bot2"},
+				{Round: 1, A: "bot3", Bye: true, Winner: "bot3", Advanced: "bot3"},
+				{Round: 2, A: "bot0", B: "bot3", WinsB: 3, Winner: "bot3", Advanced: "bot3"},
+				{Round: 2, A: "bot2", Bye: true, Winner: "bot2", Advanced: "bot2"},
+				{Round: 3, A: "bot2", B: "bot3", Draws: 2, Advanced: "bot2", Tiebreak: true},
+			},
+			knockout: true,
+			want:     []string{"bot2 2.5", "bot3 2.5", "bot0 1.0", "bot1 0.0"},
+		},
+	}
+	for _, test := range tests {
+		standings := computeStandings(bots, test.results, test.knockout)
+		have := make([]string, len(standings))
+		for i, s := range standings {
+			have[i] = fmt.Sprintf("%s %.1f", s.Name, s.Points)
+			if want := i + 1; want != s.Rank {
+				t.Errorf("%s: unexpected rank of %s. want %d, have %d", test.name, s.Name, want, s.Rank)
+			}
+		}
+		if fmt.Sprint(test.want) != fmt.Sprint(have) {
+			t.Errorf("%s: unexpected standings. want %q, have %q", test.name, test.want, have)
+		}
+	}
+}
+
+func TestComputeStandings_Counts(t *testing.T) {
+	results := []matchResult{
+		{A: "bot0", B: "bot1", WinsA: 2, WinsB: 1, Draws: 1, Winner: "bot0"},
+		{A: "bot1", B: "bot0", WinsA: 1, WinsB: 1},
+		{A: "bot0", Bye: true},
+	}
+	standings := computeStandings(testBots(2), results, false)
+	want := []standing{
+		{Rank: 1, Name: "bot0", Points: 2.5, Won: 1, Drawn: 1, Byes: 1, GamesWon: 3, GamesDrawn: 1, GamesLost: 2, seed: 0},
+		{Rank: 2, Name: "bot1", Points: 0.5, Drawn: 1, Lost: 1, GamesWon: 2, GamesDrawn: 1, GamesLost: 3, seed: 1},
+	}
+	for i := range want {
+		if want[i] != standings[i] {
+			t.Errorf("unexpected standing.\nwant %+v\nhave %+v", want[i], standings[i])
+		}
+	}
+}
@@ -0,0 +1,525 @@
+// Package bot runs battleship bots. A bot is a Strategy that decides
+// where to place the ships and where to shoot. The Client runs the
+// strategy in games on the server, and handles all messages.
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/yookoala/botgame-playground/comms"
+	"github.com/yookoala/botgame-playground/examples/battleship/game"
+)
+
+// Strategy decides the moves of a bot.
+type Strategy interface {
+	// Place returns the placement of the fleet of the rules. Returns
+	// nil to have the ships placed at random by the server.
+	Place(rules game.Rules) []game.ShipPlacement
+
+	// NextShot returns a cell to shoot at. The cell should be unknown
+	// in the view. In the Salvo variant, it is called once for each
+	// shot of the salvo, with the cells chosen before as pending.
+	NextShot(view *View) [2]int
+
+	// Observe is called with the result of every shot of the bot.
+	Observe(result game.ShotResult)
+}
+
+// View is what a bot knows of the game. It is kept by the Client from
+// the results of the shots and the frames, and must not be modified by
+// the strategy.
+type View struct {
+	Rules game.Rules
+	Frame int
+
+	// Salvo is true in the Salvo variant.
+	Salvo bool
+
+	// Board is the results of the shots at the opponent. Cells of the
+	// ships sunk are marked sunk.
+	Board game.Board
+
+	// Ships are the ships of the bot.
+	Ships game.ShipStates
+
+	// Sunk are the ships of the opponent sunk.
+	Sunk game.ShipStates
+
+	// Pending are the cells chosen for the salvo being made.
+	Pending [][2]int
+}
+
+// NewView creates the view of a new game of the rules.
+func NewView(rules game.Rules) *View {
+	return &View{
+		Rules: rules,
+		Board: rules.NewBoard(),
+	}
+}
+
+// Unknown reports if the cell is on the board, not shot at and not
+// pending.
+func (v *View) Unknown(cell [2]int) bool {
+	if !v.Board.InBounds(cell[0], cell[1]) || v.Board[cell[0]][cell[1]] != game.BoardCellStateUnknown {
+		return false
+	}
+	for _, p := range v.Pending {
+		if p == cell {
+			return false
+		}
+	}
+	return true
+}
+
+// UnknownCells returns all the unknown cells, column by column.
+func (v *View) UnknownCells() [][2]int {
+	cells := make([][2]int, 0, v.Rules.Width*v.Rules.Height)
+	for x := range v.Board {
+		for y := range v.Board[x] {
+			if cell := [2]int{x, y}; v.Unknown(cell) {
+				cells = append(cells, cell)
+			}
+		}
+	}
+	return cells
+}
+
+// Afloat returns the sizes of the ships of the opponent not sunk.
+func (v *View) Afloat() []int {
+	sunk := make(map[game.ShipID]int, len(v.Sunk))
+	for _, ship := range v.Sunk {
+		sunk[ship.ID]++
+	}
+	sizes := make([]int, 0, v.Rules.FleetSize())
+	for _, st := range v.Rules.Fleet {
+		for i := sunk[st.ID]; i < st.Count; i++ {
+			sizes = append(sizes, st.Size)
+		}
+	}
+	return sizes
+}
+
+// Hits returns the cells hit of the ships not sunk.
+func (v *View) Hits() [][2]int {
+	cells := make([][2]int, 0)
+	for x := range v.Board {
+		for y := range v.Board[x] {
+			if v.Board[x][y] == game.BoardCellStateHit {
+				cells = append(cells, [2]int{x, y})
+			}
+		}
+	}
+	return cells
+}
+
+// GameOver reports if the fleet of either player is sunk, i.e. all the
+// ships of the bot are sunk, or as many cells of the opponent are hit as
+// there are in its fleet. It works when the ships sunk are not revealed.
+func (v *View) GameOver() bool {
+	if len(v.Ships) > 0 {
+		sunk := true
+		for _, ship := range v.Ships {
+			sunk = sunk && ship.HP == 0
+		}
+		if sunk {
+			return true
+		}
+	}
+	cells := 0
+	for _, st := range v.Rules.Fleet {
+		cells += st.Size * st.Count
+	}
+	for x := range v.Board {
+		for _, state := range v.Board[x] {
+			if state == game.BoardCellStateHit || state == game.BoardCellStateSunk {
+				cells--
+			}
+		}
+	}
+	return cells <= 0
+}
+
+// Record records the result of a shot on the board, and the ship sunk
+// by the shot if told. If the rules keep the ships sunk secret, the ships
+// sunk are inferred from the hits instead.
+func (v *View) Record(result game.ShotResult) {
+	x, y := result.Coordinate[0], result.Coordinate[1]
+	if v.Board.InBounds(x, y) && v.Board[x][y] != game.BoardCellStateSunk {
+		v.Board[x][y] = result.State
+	}
+	if result.Ship != game.ShipUndefined {
+		v.RecordSunk(game.ShipState{ID: result.Ship, Coordinates: result.ShipCoordinates})
+	}
+	if v.Rules.NoReveal {
+		v.inferSunk()
+	}
+}
+
+// closed reports if a ship cannot extend over the cell, i.e. the cell is
+// off the board, missed or sunk.
+func (v *View) closed(cell [2]int) bool {
+	if !v.Board.InBounds(cell[0], cell[1]) {
+		return true
+	}
+	state := v.Board[cell[0]][cell[1]]
+	return state == game.BoardCellStateMiss || state == game.BoardCellStateSunk
+}
+
+// inferSunk records the ships sunk, inferred from straight lines of hits
+// closed at both ends, with no hit next to the line. Such a line is taken
+// as a ship sunk if a ship of its length is afloat.
+func (v *View) inferSunk() {
+	hit := func(c [2]int) bool {
+		return v.Board.InBounds(c[0], c[1]) && v.Board[c[0]][c[1]] == game.BoardCellStateHit
+	}
+	for _, c := range v.Hits() {
+		for _, d := range [][2]int{{1, 0}, {0, 1}} {
+			if !hit(c) || hit([2]int{c[0] - d[0], c[1] - d[1]}) {
+				// Sunk, or not the start of a line.
+				continue
+			}
+			line := [][2]int{c}
+			for next := [2]int{c[0] + d[0], c[1] + d[1]}; hit(next); next = [2]int{next[0] + d[0], next[1] + d[1]} {
+				line = append(line, next)
+			}
+			end := line[len(line)-1]
+			if !v.closed([2]int{c[0] - d[0], c[1] - d[1]}) || !v.closed([2]int{end[0] + d[0], end[1] + d[1]}) {
+				continue
+			}
+			beside := false
+			for _, cell := range line {
+				for _, side := range [][2]int{{d[1], d[0]}, {-d[1], -d[0]}} {
+					next := [2]int{cell[0] + side[0], cell[1] + side[1]}
+					beside = beside || hit(next) || (len(line) == 1 && !v.closed(next))
+				}
+			}
+			if beside {
+				continue
+			}
+			if id, ok := v.afloatOfSize(len(line)); ok {
+				v.RecordSunk(game.ShipState{ID: id, Coordinates: line})
+			}
+		}
+	}
+}
+
+// afloatOfSize returns the ID of a ship type of the size with ships of
+// the opponent afloat.
+func (v *View) afloatOfSize(size int) (game.ShipID, bool) {
+	sunk := make(map[game.ShipID]int, len(v.Sunk))
+	for _, ship := range v.Sunk {
+		sunk[ship.ID]++
+	}
+	for _, st := range v.Rules.Fleet {
+		if st.Size == size && sunk[st.ID] < st.Count {
+			return st.ID, true
+		}
+	}
+	return game.ShipUndefined, false
+}
+
+// RecordSunk records a ship of the opponent sunk, and marks its cells.
+func (v *View) RecordSunk(ship game.ShipState) {
+	if len(ship.Coordinates) == 0 {
+		return
+	}
+	for _, s := range v.Sunk {
+		if s.ID == ship.ID && s.Coordinates[0] == ship.Coordinates[0] {
+			return
+		}
+	}
+	v.Sunk = append(v.Sunk, ship)
+	for _, c := range ship.Coordinates {
+		if v.Board.InBounds(c[0], c[1]) {
+			v.Board[c[0]][c[1]] = game.BoardCellStateSunk
+		}
+	}
+}
+
+// Client plays a game on the server with the strategy. It joins a room,
+// sends the placement of the ships, and shoots when it is its turn.
+//
+// Implements comms.MessageHandler interface.
+type Client struct {
+	strategy Strategy
+	stage    game.GameStage
+
+	// shots are the cells of the last shot request. refused are the
+	// cells of the shots refused in the frame, not to shoot again, in
+	// retries requests.
+	shots   [][2]int
+	refused [][2]int
+	retries int
+
+	// matchmake is true to wait for an opponent of similar
+	// rating, instead of joining any open room.
+	matchmake bool
+	rating    float64
+
+	// token authenticates the client to be rated, if not empty.
+	token string
+
+	// seat is the index of the board of the client in frames, i.e.
+	// 0 for player 1 and 1 for player 2.
+	seat int
+
+	view *View
+}
+
+// maxShotRetries is the number of times the client shoots again in a
+// frame after its shots are refused.
+const maxShotRetries = 3
+
+// NewClient creates a new Client of the strategy. The client joins any
+// open room, unless Matchmake is set.
+func NewClient(s Strategy) *Client {
+	return &Client{
+		strategy: s,
+		rating:   comms.DefaultMatchRating,
+		view:     NewView(game.DefaultRules()),
+	}
+}
+
+// Matchmake makes the client wait for an opponent of similar rating
+// with the matchmaker, instead of joining any open room.
+func (c *Client) Matchmake(rating float64) *Client {
+	c.matchmake, c.rating = true, rating
+	return c
+}
+
+// Token sets the token to authenticate with the server, for the bot to
+// be rated.
+func (c *Client) Token(token string) *Client {
+	c.token = token
+	return c
+}
+
+// View returns the view of the game.
+func (c *Client) View() *View {
+	return c.view
+}
+
+// enterLobby waits for an opponent with the matchmaker, or joins any
+// room with an open seat.
+func (c *Client) enterLobby(mw comms.MessageWriter) error {
+	if c.matchmake {
+		return mw.WriteMessage(comms.NewRequest("room", "matchmake", map[string]float64{"rating": c.rating}))
+	}
+	return mw.WriteMessage(comms.NewRequest("room", "room:join", nil))
+}
+
+// shoot sends a shot, or a salvo of one shot for each ship afloat in
+// the Salvo variant, at the cells chosen by the strategy. Cells refused
+// in the frame are taken as pending, so they are not shot again.
+func (c *Client) shoot(mw comms.MessageWriter) error {
+	n := 1
+	if c.view.Salvo {
+		n = 0
+		for _, ship := range c.view.Ships {
+			if ship.HP > 0 {
+				n++
+			}
+		}
+	}
+
+	c.view.Pending = append(make([][2]int, 0, len(c.refused)+n), c.refused...)
+	for len(c.view.Pending) < len(c.refused)+n {
+		cell := c.strategy.NextShot(c.view)
+		if !c.view.Unknown(cell) {
+			// Shoot at any cell left instead.
+			cells := c.view.UnknownCells()
+			if len(cells) == 0 {
+				break
+			}
+			log.Printf("strategy chose %v not unknown, shooting at %v", cell, cells[0])
+			cell = cells[0]
+		}
+		c.view.Pending = append(c.view.Pending, cell)
+	}
+	shots := c.view.Pending[len(c.refused):]
+	c.view.Pending = nil
+	c.shots = shots
+
+	if len(shots) == 0 {
+		return nil
+	}
+	if c.view.Salvo {
+		return mw.WriteMessage(comms.NewRequest("shot", "shot", shots))
+	}
+	return mw.WriteMessage(comms.NewRequest("shot", "shot", shots[0]))
+}
+
+// observe records the results of the shots in the response, and passes
+// them to the strategy. Shots refused as invalid (e.g. the view is out
+// of sync with the server) are made again at other cells, up to
+// maxShotRetries times in a frame.
+func (c *Client) observe(resp comms.Response, mw comms.MessageWriter) error {
+	if resp.Code() != 200 {
+		log.Printf("shot refused: %s", resp)
+		if resp.Code() != 400 {
+			// e.g. not our turn, or already shot in the frame.
+			return nil
+		}
+		if c.retries >= maxShotRetries {
+			return fmt.Errorf("shots refused %d times in frame %d: %s", c.retries+1, c.view.Frame, resp)
+		}
+		c.refused = append(c.refused, c.shots...)
+		c.retries++
+		return c.shoot(mw)
+	}
+	results := make([]game.ShotResult, 1)
+	if c.view.Salvo {
+		if err := resp.ReadDataTo(&results); err != nil {
+			return err
+		}
+	} else if err := resp.ReadDataTo(&results[0]); err != nil {
+		return err
+	}
+	for _, result := range results {
+		c.view.Record(result)
+		c.strategy.Observe(result)
+	}
+	return nil
+}
+
+// updateView updates the view with the frame, including the shots made
+// for the client on timeout, and the ships sunk.
+func (c *Client) updateView(frame game.FrameView) {
+	c.view.Frame, c.view.Salvo = frame.Frame, frame.Salvo
+	if len(frame.Boards) != 2 {
+		return
+	}
+	c.view.Ships = frame.Boards[c.seat].Ships
+	opponent := frame.Boards[1-c.seat]
+	for x := range opponent.Cells {
+		for y, state := range opponent.Cells[x] {
+			if state != game.BoardCellStateUnknown {
+				c.view.Record(game.ShotResult{Frame: frame.Frame, Coordinate: [2]int{x, y}, State: state})
+			}
+		}
+	}
+	for _, ship := range opponent.Ships {
+		if ship.HP == 0 {
+			c.view.RecordSunk(ship)
+		}
+	}
+}
+
+// HandleMessage handles the messages of the server in every stage of
+// the game.
+func (c *Client) HandleMessage(ctx context.Context, m comms.Message, mw comms.MessageWriter) (err error) {
+
+	// Handle stage change and rules events first.
+	if m.Type() == "event" {
+		evt := m.(comms.Event)
+		switch evt.EventType() {
+		case "stage:change":
+			log.Printf("received stage change message: %s", m)
+			evt.ReadDataTo(&c.stage)
+			log.Printf("stage changed to %s", c.stage)
+		case "game:rules":
+			log.Printf("received rules: %s", m)
+			var rules game.Rules
+			if err := evt.ReadDataTo(&rules); err != nil {
+				return err
+			}
+			c.view = NewView(rules)
+			return nil
+		}
+	}
+
+	switch c.stage {
+	case game.GameStageWaiting:
+		if m.Type() == "response" {
+			resp := m.(comms.Response)
+			switch resp.RequestID() {
+			case "auth":
+				if resp.Code() != 200 {
+					return fmt.Errorf("error authenticating: %s", resp)
+				}
+				return c.enterLobby(mw)
+			case "room":
+				if resp.Code() != 200 {
+					return fmt.Errorf("error joining room: %s", resp)
+				}
+				if c.matchmake {
+					// Join the game after matched.
+					return nil
+				}
+
+				// Annonce join game
+				return mw.WriteMessage(comms.NewRequest("join", "join", nil))
+			case "join":
+				var player string
+				resp.ReadDataTo(&player)
+				if player == "player2" {
+					c.seat = 1
+				}
+			}
+			return
+		}
+		if m.Type() == "event" && m.(comms.Event).EventType() == "match:found" {
+			log.Printf("match found: %s", m)
+			return mw.WriteMessage(comms.NewRequest("join", "join", nil))
+		}
+		if m.Type() == "event" && m.(comms.Event).EventType() == "match:error" {
+			return fmt.Errorf("error matchmaking: %s", m)
+		}
+		if m.Type() != "signal" {
+			return fmt.Errorf("invalid message type: %v", m.Type())
+		}
+		sig := m.(comms.Signal)
+		if sig.Signal() != "client:init" {
+			return fmt.Errorf("invalid signal type: %v", sig.Signal())
+		}
+
+		if c.token != "" {
+			// Authenticate to be rated
+			return mw.WriteMessage(comms.NewRequest("auth", "auth", map[string]string{"token": c.token}))
+		}
+		return c.enterLobby(mw)
+	case game.GameStageSetup:
+		if m.Type() == "response" && m.(comms.Response).Code() != 200 {
+			log.Printf("setup refused: %s", m)
+			return
+		}
+
+		// send the ship allocations to game server then wait.
+		if m.Type() != "event" || m.(comms.Event).EventType() != "stage:change" {
+			return
+		}
+		return mw.WriteMessage(comms.NewRequest("setup", "setup", c.strategy.Place(c.view.Rules)))
+	case game.GameStagePlaying:
+		if m.Type() == "response" && m.(comms.Response).RequestID() == "shot" {
+			return c.observe(m.(comms.Response), mw)
+		}
+		if m.Type() == "event" {
+			evt := m.(comms.Event)
+			switch evt.EventType() {
+			case "frame:update":
+				// Both players shoot in every frame, unless
+				// the players take turns.
+				var frame game.FrameView
+				if err = evt.ReadDataTo(&frame); err != nil {
+					return
+				}
+				c.updateView(frame)
+				c.refused, c.retries = nil, 0
+				if frame.Turn != "" || c.view.GameOver() {
+					// No shot after the last frame, as
+					// the game is ending.
+					return
+				}
+				return c.shoot(mw)
+			case "turn:start":
+				// It's our turn, send a shot.
+				c.refused, c.retries = nil, 0
+				return c.shoot(mw)
+			}
+		}
+	}
+
+	return nil
+}
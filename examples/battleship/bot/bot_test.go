@@ -0,0 +1,184 @@
+package bot_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+	"github.com/yookoala/botgame-playground/comms/commstest"
+	"github.com/yookoala/botgame-playground/examples/battleship/bot"
+	"github.com/yookoala/botgame-playground/examples/battleship/game"
+	"github.com/yookoala/botgame-playground/examples/battleship/server"
+)
+
+// playGame plays a game of 2 bots on a server of the games, and returns
+// the result. No request of the bots should be refused.
+func playGame(t *testing.T, newGame func() *server.Game, s1, s2 bot.Strategy) server.Result {
+	t.Helper()
+	results := make(chan server.Result, 1)
+	rm := comms.NewRoomManager().Register("battleship", 2, func() comms.MessageHandler {
+		return newGame()
+	})
+	rm.OnEvent(func(r *comms.Room, evt comms.Event) {
+		if evt.EventType() == "game:result" {
+			var res server.Result
+			evt.ReadDataTo(&res)
+			results <- res
+		}
+	})
+	h := commstest.NewHarness(t, rm)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	refused := make(chan string, 10)
+	for _, s := range []bot.Strategy{s1, s2} {
+		c := bot.NewClient(s)
+		go comms.NewClient(h.Listener, comms.MessageHandlerFunc(
+			func(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+				if resp, ok := m.(comms.Response); ok && m.Type() == "response" && resp.Code() != 200 {
+					refused <- fmt.Sprint(m)
+				}
+				return c.HandleMessage(ctx, m, mw)
+			},
+		)).Run(ctx)
+	}
+
+	var res server.Result
+	select {
+	case res = <-results:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for the game result")
+	}
+
+	// Wait for the responses to the requests made before the game
+	// ended.
+	select {
+	case m := <-refused:
+		t.Errorf("unexpected refused request: %s", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+	return res
+}
+
+func TestView_GameOver(t *testing.T) {
+	rules := game.Rules{Width: 4, Height: 4, Fleet: []game.ShipType{
+		{ID: 1, Name: "Patrol", Size: 2, Count: 1},
+	}}
+	view := bot.NewView(rules)
+	view.Ships = game.ShipStates{{ID: 1, HP: 1, Coordinates: [][2]int{{0, 0}, {0, 1}}}}
+	if view.GameOver() {
+		t.Errorf("unexpected game over at start")
+	}
+
+	// Ships sunk are not revealed.
+	view.Record(game.ShotResult{Coordinate: [2]int{2, 2}, State: game.BoardCellStateHit})
+	if view.GameOver() {
+		t.Errorf("unexpected game over with a ship afloat")
+	}
+	view.Record(game.ShotResult{Coordinate: [2]int{2, 3}, State: game.BoardCellStateHit})
+	if !view.GameOver() {
+		t.Errorf("expected game over with all cells of the fleet hit")
+	}
+
+	// The ships of the bot are sunk.
+	view = bot.NewView(rules)
+	view.Ships = game.ShipStates{{ID: 1, HP: 0, Coordinates: [][2]int{{0, 0}, {0, 1}}}}
+	if !view.GameOver() {
+		t.Errorf("expected game over with all ships of the bot sunk")
+	}
+}
+
+func TestClient(t *testing.T) {
+	rules := game.Rules{Width: 7, Height: 6, NoTouch: true, Fleet: []game.ShipType{
+		{ID: 1, Name: "Frigate", Size: 3, Count: 2},
+		{ID: 2, Name: "Patrol", Size: 2, Count: 2},
+	}}
+	tests := map[string]func() *server.Game{
+		"classic": server.NewGame,
+		"salvo": func() *server.Game {
+			return server.NewGame().Variant(game.VariantSalvo)
+		},
+		"alternating": func() *server.Game {
+			return server.NewGame().Turns(game.TurnModeAlternating, true)
+		},
+		"rules": func() *server.Game {
+			return server.NewGame().Rules(rules)
+		},
+	}
+	for name, newGame := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := playGame(t, newGame,
+				bot.NewHuntStrategy(rand.New(rand.NewSource(1))),
+				bot.NewDensityStrategy(rand.New(rand.NewSource(2))),
+			)
+			if want, have := server.ReasonFleetSunk, res.Reason; want != have {
+				t.Errorf("unexpected reason. want %#v, have %#v", want, have)
+			}
+		})
+	}
+}
+
+// messageRecorder records the messages written.
+type messageRecorder []comms.Message
+
+// WriteMessage implements comms.MessageWriter.
+func (r *messageRecorder) WriteMessage(m comms.Message) error {
+	*r = append(*r, m)
+	return nil
+}
+
+func TestClient_ShotRefused(t *testing.T) {
+	c := bot.NewClient(bot.NewScanStrategy(rand.New(rand.NewSource(1))))
+	mw := &messageRecorder{}
+	handle := func(m comms.Message) error {
+		t.Helper()
+		*mw = nil
+		return c.HandleMessage(context.Background(), m, mw)
+	}
+	shot := func() [2]int {
+		t.Helper()
+		if want, have := 1, len(*mw); want != have {
+			t.Fatalf("unexpected number of requests. want %d, have %d", want, have)
+		}
+		var cell [2]int
+		(*mw)[0].(comms.Request).ReadDataTo(&cell)
+		return cell
+	}
+	refuse := func(code int) error {
+		return handle(comms.NewErrorResponse("", "shot", code, "error", "refused"))
+	}
+
+	handle(comms.NewEvent("stage:change", game.GameStagePlaying))
+	handle(comms.NewEvent("frame:update", game.FrameView{Frame: 1, Boards: make([]game.BoardView, 2)}))
+	if want, have := [2]int{0, 0}, shot(); want != have {
+		t.Fatalf("unexpected shot. want %v, have %v", want, have)
+	}
+
+	// Shoot again at other cells when refused as invalid.
+	for _, want := range [][2]int{{1, 0}, {2, 0}, {3, 0}} {
+		if err := refuse(400); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if have := shot(); want != have {
+			t.Fatalf("unexpected shot. want %v, have %v", want, have)
+		}
+	}
+	if err := refuse(400); err == nil {
+		t.Errorf("expected error after %d retries", 3)
+	}
+
+	// Not shoot again if refused for other reasons.
+	handle(comms.NewEvent("frame:update", game.FrameView{Frame: 2, Boards: make([]game.BoardView, 2)}))
+	if want, have := [2]int{0, 0}, shot(); want != have {
+		t.Errorf("unexpected shot in the next frame. want %v, have %v", want, have)
+	}
+	if err := refuse(409); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if want, have := 0, len(*mw); want != have {
+		t.Errorf("unexpected requests. want %d, have %d", want, have)
+	}
+}
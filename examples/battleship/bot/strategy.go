@@ -0,0 +1,259 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+
+	"github.com/yookoala/botgame-playground/examples/battleship/game"
+)
+
+// StrategyNames are the names of the strategies of NewStrategy.
+var StrategyNames = []string{"scan", "random", "hunt", "density"}
+
+// NewStrategy creates the strategy of the name, with the random source
+// to place ships and break ties.
+func NewStrategy(name string, rng *rand.Rand) (Strategy, error) {
+	switch name {
+	case "scan":
+		return NewScanStrategy(rng), nil
+	case "random":
+		return NewRandomStrategy(rng), nil
+	case "hunt":
+		return NewHuntStrategy(rng), nil
+	case "density":
+		return NewDensityStrategy(rng), nil
+	}
+	return nil, fmt.Errorf("unknown strategy: %s", name)
+}
+
+// RandomPlacer places the ships at random, and observes nothing. Embed
+// it in a Strategy that only needs the View to shoot.
+type RandomPlacer struct {
+	Rand *rand.Rand
+}
+
+// Place places the fleet at random. Returns nil for the server to
+// place the ships if there is no legal placement found.
+func (p RandomPlacer) Place(rules game.Rules) []game.ShipPlacement {
+	ships, err := game.RandomPlacement(rules, p.Rand, game.PlacementOptions{})
+	if err != nil {
+		log.Printf("error placing ships, let the server place them: %s", err)
+		return nil
+	}
+	return ships
+}
+
+// Observe does nothing.
+func (p RandomPlacer) Observe(result game.ShotResult) {}
+
+// pick returns a random cell of the cells. Reports false if there is
+// none.
+func (p RandomPlacer) pick(cells [][2]int) ([2]int, bool) {
+	if len(cells) == 0 {
+		return [2]int{}, false
+	}
+	return cells[p.Rand.Intn(len(cells))], true
+}
+
+// ScanStrategy shoots the board cell by cell, row by row.
+type ScanStrategy struct {
+	RandomPlacer
+}
+
+// NewScanStrategy creates a new ScanStrategy.
+func NewScanStrategy(rng *rand.Rand) *ScanStrategy {
+	return &ScanStrategy{RandomPlacer{Rand: rng}}
+}
+
+// NextShot implements Strategy.
+func (s *ScanStrategy) NextShot(view *View) [2]int {
+	for y := 0; y < view.Rules.Height; y++ {
+		for x := 0; x < view.Rules.Width; x++ {
+			if cell := [2]int{x, y}; view.Unknown(cell) {
+				return cell
+			}
+		}
+	}
+	return [2]int{}
+}
+
+// RandomStrategy shoots at random cells, never the same cell twice.
+type RandomStrategy struct {
+	RandomPlacer
+}
+
+// NewRandomStrategy creates a new RandomStrategy.
+func NewRandomStrategy(rng *rand.Rand) *RandomStrategy {
+	return &RandomStrategy{RandomPlacer{Rand: rng}}
+}
+
+// NextShot implements Strategy.
+func (s *RandomStrategy) NextShot(view *View) [2]int {
+	cell, _ := s.pick(view.UnknownCells())
+	return cell
+}
+
+// HuntStrategy hunts for ships at random cells of a checkerboard, spaced
+// by the size of the smallest ship afloat, so every ship is found. Once
+// a ship is hit, it targets the cells next to the hits, along the line
+// of the hits if there are more than one.
+type HuntStrategy struct {
+	RandomPlacer
+}
+
+// NewHuntStrategy creates a new HuntStrategy.
+func NewHuntStrategy(rng *rand.Rand) *HuntStrategy {
+	return &HuntStrategy{RandomPlacer{Rand: rng}}
+}
+
+// NextShot implements Strategy.
+func (s *HuntStrategy) NextShot(view *View) [2]int {
+	if cell, ok := s.target(view); ok {
+		return cell
+	}
+	parity := 1
+	if sizes := view.Afloat(); len(sizes) > 0 {
+		parity = sizes[0]
+		for _, size := range sizes {
+			parity = min(parity, size)
+		}
+	}
+	cells := view.UnknownCells()
+	hunt := make([][2]int, 0, len(cells))
+	for _, cell := range cells {
+		if (cell[0]+cell[1])%parity == 0 {
+			hunt = append(hunt, cell)
+		}
+	}
+	if cell, ok := s.pick(hunt); ok {
+		return cell
+	}
+	cell, _ := s.pick(cells)
+	return cell
+}
+
+// target returns a cell next to the hits of ships afloat, if any.
+// Cells in line with 2 hits next to each other come first.
+func (s *HuntStrategy) target(view *View) ([2]int, bool) {
+	hits := view.Hits()
+	hit := make(map[[2]int]bool, len(hits))
+	for _, c := range hits {
+		hit[c] = true
+	}
+
+	// Extend lines of hits.
+	lines := make([][2]int, 0)
+	for _, c := range hits {
+		for _, d := range [][2]int{{1, 0}, {0, 1}} {
+			if !hit[[2]int{c[0] + d[0], c[1] + d[1]}] || hit[[2]int{c[0] - d[0], c[1] - d[1]}] {
+				// Not the start of a line.
+				continue
+			}
+			end := c
+			for hit[[2]int{end[0] + d[0], end[1] + d[1]}] {
+				end = [2]int{end[0] + d[0], end[1] + d[1]}
+			}
+			for _, next := range [][2]int{{c[0] - d[0], c[1] - d[1]}, {end[0] + d[0], end[1] + d[1]}} {
+				if view.Unknown(next) {
+					lines = append(lines, next)
+				}
+			}
+		}
+	}
+	if cell, ok := s.pick(lines); ok {
+		return cell, true
+	}
+
+	// Try around the hits.
+	around := make([][2]int, 0)
+	for _, c := range hits {
+		for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			if next := [2]int{c[0] + d[0], c[1] + d[1]}; view.Unknown(next) {
+				around = append(around, next)
+			}
+		}
+	}
+	return s.pick(around)
+}
+
+// DensityStrategy counts, for every cell, the ways the ships afloat can
+// be placed over it, and shoots at the cell with the most. When ships
+// are hit, only the placements over the hits are counted, weighted by
+// the number of hits they cover.
+type DensityStrategy struct {
+	RandomPlacer
+}
+
+// NewDensityStrategy creates a new DensityStrategy.
+func NewDensityStrategy(rng *rand.Rand) *DensityStrategy {
+	return &DensityStrategy{RandomPlacer{Rand: rng}}
+}
+
+// NextShot implements Strategy.
+func (s *DensityStrategy) NextShot(view *View) [2]int {
+	density := Density(view)
+	best, bestCells := 0, make([][2]int, 0)
+	for _, cell := range view.UnknownCells() {
+		switch d := density[cell[0]][cell[1]]; {
+		case d > best:
+			best, bestCells = d, append(bestCells[:0], cell)
+		case d == best:
+			bestCells = append(bestCells, cell)
+		}
+	}
+	cell, _ := s.pick(bestCells)
+	return cell
+}
+
+// Density returns the weighted count of placements of the ships afloat
+// over every cell of the view, indexed by [x][y]. Pending cells are
+// taken as missed.
+func Density(view *View) [][]int {
+	rules := view.Rules
+	density := make([][]int, rules.Width)
+	for x := range density {
+		density[x] = make([]int, rules.Height)
+	}
+	pending := make(map[[2]int]bool, len(view.Pending))
+	for _, c := range view.Pending {
+		pending[c] = true
+	}
+	targeting := len(view.Hits()) > 0
+
+	for _, size := range view.Afloat() {
+		for x := 0; x < rules.Width; x++ {
+			for y := 0; y < rules.Height; y++ {
+				for _, d := range [][2]int{{1, 0}, {0, 1}} {
+					if size == 1 && d[1] == 1 {
+						// Same cell as to the right.
+						continue
+					}
+					hits, ok := 0, true
+					for i := 0; i < size && ok; i++ {
+						c := [2]int{x + d[0]*i, y + d[1]*i}
+						switch {
+						case !view.Board.InBounds(c[0], c[1]) || pending[c]:
+							ok = false
+						case view.Board[c[0]][c[1]] == game.BoardCellStateHit:
+							hits++
+						case view.Board[c[0]][c[1]] != game.BoardCellStateUnknown:
+							ok = false
+						}
+					}
+					if !ok || (targeting && hits == 0) {
+						continue
+					}
+					weight := 1
+					if targeting {
+						weight = hits * 100
+					}
+					for i := 0; i < size; i++ {
+						density[x+d[0]*i][y+d[1]*i] += weight
+					}
+				}
+			}
+		}
+	}
+	return density
+}
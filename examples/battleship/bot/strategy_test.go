@@ -0,0 +1,222 @@
+package bot_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/yookoala/botgame-playground/examples/battleship/bot"
+	"github.com/yookoala/botgame-playground/examples/battleship/game"
+)
+
+// simulate plays the strategy against a random fleet of the rules until
+// the fleet is sunk. Returns the number of shots. Ships sunk are told as
+// hits if the rules keep them secret.
+func simulate(t *testing.T, s bot.Strategy, rules game.Rules, rng *rand.Rand) int {
+	t.Helper()
+	placements, err := game.RandomPlacement(rules, rng, game.PlacementOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ships := make(game.ShipStates, 0, len(placements))
+	for _, sp := range placements {
+		ss, _ := rules.NewShipState(sp.ID, sp.Coordinate, sp.Direction)
+		ships = append(ships, *ss)
+	}
+	target := rules.NewPlayerState(ships)
+
+	view := bot.NewView(rules)
+	for shots := 1; shots <= rules.Width*rules.Height; shots++ {
+		cell := s.NextShot(view)
+		if !view.Unknown(cell) {
+			t.Fatalf("shot %d at %v, not unknown", shots, cell)
+		}
+		hr, err := target.ReceiveShot(cell[0], cell[1])
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if rules.NoReveal {
+			hr = hr.Concealed()
+		}
+		result := game.ShotResult{
+			Frame:           shots,
+			Coordinate:      cell,
+			State:           hr.State,
+			Ship:            hr.Ship,
+			ShipCoordinates: hr.Coordinates,
+		}
+		view.Record(result)
+		s.Observe(result)
+		if target.IsAllShipsSunk() {
+			return shots
+		}
+	}
+	t.Fatalf("fleet not sunk after shooting every cell")
+	return 0
+}
+
+func TestStrategies(t *testing.T) {
+	// Average shots to sink the classic fleet should be within, with
+	// the ships sunk told or not.
+	limits := map[string]int{
+		"scan":    100,
+		"random":  100,
+		"hunt":    70,
+		"density": 65,
+	}
+	noReveal := game.DefaultRules()
+	noReveal.NoReveal = true
+	for _, name := range bot.StrategyNames {
+		for variant, rules := range map[string]game.Rules{"reveal": game.DefaultRules(), "no-reveal": noReveal} {
+			t.Run(name+"/"+variant, func(t *testing.T) {
+				rng := rand.New(rand.NewSource(1))
+				s, err := bot.NewStrategy(name, rng)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				const games = 20
+				total := 0
+				for i := 0; i < games; i++ {
+					total += simulate(t, s, rules, rng)
+				}
+				if avg := total / games; avg > limits[name] {
+					t.Errorf("unexpected average shots: %d, expected at most %d", avg, limits[name])
+				}
+			})
+		}
+	}
+	if _, err := bot.NewStrategy("psychic", nil); err == nil {
+		t.Error("expected error but got nil")
+	}
+}
+
+func TestHuntStrategy_Target(t *testing.T) {
+	s := bot.NewHuntStrategy(rand.New(rand.NewSource(1)))
+	view := bot.NewView(game.DefaultRules())
+	view.Record(game.ShotResult{Coordinate: [2]int{4, 4}, State: game.BoardCellStateHit})
+	view.Record(game.ShotResult{Coordinate: [2]int{5, 4}, State: game.BoardCellStateHit})
+	view.Record(game.ShotResult{Coordinate: [2]int{6, 4}, State: game.BoardCellStateMiss})
+
+	// Extend the line of hits to the left.
+	if want, have := [2]int{3, 4}, s.NextShot(view); want != have {
+		t.Errorf("unexpected shot. want %v, have %v", want, have)
+	}
+}
+
+func TestDensity(t *testing.T) {
+	// A destroyer on a 3x1 board is more likely in the middle.
+	rules := game.Rules{Width: 3, Height: 1, Fleet: []game.ShipType{
+		{ID: 1, Name: "Destroyer", Size: 2, Count: 1},
+	}}
+	view := bot.NewView(rules)
+	if want, have := []int{1, 2, 1}, bot.Density(view); have[0][0] != want[0] || have[1][0] != want[1] || have[2][0] != want[2] {
+		t.Errorf("unexpected density. want %v, have %v", want, have)
+	}
+	s := bot.NewDensityStrategy(rand.New(rand.NewSource(1)))
+	if want, have := [2]int{1, 0}, s.NextShot(view); want != have {
+		t.Errorf("unexpected shot. want %v, have %v", want, have)
+	}
+
+	// Pending cells are taken as missed.
+	view.Pending = [][2]int{{1, 0}}
+	if want, have := 0, bot.Density(view)[0][0]; want != have {
+		t.Errorf("unexpected density. want %d, have %d", want, have)
+	}
+}
+
+func TestScanStrategy(t *testing.T) {
+	s := bot.NewScanStrategy(rand.New(rand.NewSource(1)))
+	view := bot.NewView(game.Rules{Width: 3, Height: 2})
+	view.Record(game.ShotResult{Coordinate: [2]int{1, 0}, State: game.BoardCellStateMiss})
+	view.Pending = [][2]int{{0, 0}}
+
+	// Shoot row by row, skipping known and pending cells.
+	for _, want := range [][2]int{{2, 0}, {0, 1}, {1, 1}, {2, 1}} {
+		have := s.NextShot(view)
+		if want != have {
+			t.Fatalf("unexpected shot. want %v, have %v", want, have)
+		}
+		view.Record(game.ShotResult{Coordinate: have, State: game.BoardCellStateMiss})
+	}
+}
+
+func TestRandomStrategy(t *testing.T) {
+	s := bot.NewRandomStrategy(rand.New(rand.NewSource(1)))
+	rules := game.Rules{Width: 4, Height: 3}
+	view := bot.NewView(rules)
+
+	// Every cell once.
+	shot := make(map[[2]int]bool)
+	for i := 0; i < rules.Width*rules.Height; i++ {
+		cell := s.NextShot(view)
+		if !view.Unknown(cell) || shot[cell] {
+			t.Fatalf("shot %d at %v, not unknown", i+1, cell)
+		}
+		shot[cell] = true
+		view.Record(game.ShotResult{Coordinate: cell, State: game.BoardCellStateMiss})
+	}
+}
+
+func TestHuntStrategy_Parity(t *testing.T) {
+	s := bot.NewHuntStrategy(rand.New(rand.NewSource(1)))
+	view := bot.NewView(game.DefaultRules())
+
+	// Hunt on the cells of a checkerboard for the destroyer of size 2.
+	for i := 0; i < 30; i++ {
+		cell := s.NextShot(view)
+		if (cell[0]+cell[1])%2 != 0 {
+			t.Fatalf("unexpected shot %d at %v off the checkerboard", i+1, cell)
+		}
+		view.Record(game.ShotResult{Coordinate: cell, State: game.BoardCellStateMiss})
+	}
+
+	// Spaced by 3 once the destroyer is sunk.
+	view = bot.NewView(game.DefaultRules())
+	view.RecordSunk(game.ShipState{ID: game.ShipIDDestroyer, Coordinates: [][2]int{{0, 0}, {1, 0}}})
+	for i := 0; i < 20; i++ {
+		cell := s.NextShot(view)
+		if (cell[0]+cell[1])%3 != 0 {
+			t.Fatalf("unexpected shot %d at %v off the grid", i+1, cell)
+		}
+		view.Record(game.ShotResult{Coordinate: cell, State: game.BoardCellStateMiss})
+	}
+}
+
+func TestView_InferSunk(t *testing.T) {
+	rules := game.DefaultRules()
+	rules.NoReveal = true
+	view := bot.NewView(rules)
+	record := func(x, y int, state game.BoardCellState) {
+		view.Record(game.ShotResult{Coordinate: [2]int{x, y}, State: state})
+	}
+
+	// A line of 2 hits closed by the edge and a miss is the destroyer.
+	record(0, 0, game.BoardCellStateHit)
+	record(1, 0, game.BoardCellStateHit)
+	if want, have := 2, len(view.Hits()); want != have {
+		t.Fatalf("unexpected hits before the line is closed. want %d, have %d", want, have)
+	}
+	record(2, 0, game.BoardCellStateMiss)
+	if want, have := 0, len(view.Hits()); want != have {
+		t.Errorf("unexpected hits. want %d, have %d", want, have)
+	}
+	if want, have := []int{5, 4, 3, 3}, view.Afloat(); len(want) != len(have) {
+		t.Errorf("unexpected ships afloat. want %v, have %v", want, have)
+	}
+	if want, have := game.BoardCellStateSunk, view.Board[1][0]; want != have {
+		t.Errorf("unexpected cell. want %s, have %s", want, have)
+	}
+
+	// Not a ship sunk with a hit beside the line, or no ship of the
+	// length afloat.
+	record(5, 5, game.BoardCellStateHit)
+	record(6, 5, game.BoardCellStateHit)
+	record(5, 6, game.BoardCellStateHit)
+	record(4, 5, game.BoardCellStateMiss)
+	record(7, 5, game.BoardCellStateMiss)
+	record(9, 9, game.BoardCellStateHit)
+	record(9, 8, game.BoardCellStateHit)
+	record(9, 7, game.BoardCellStateMiss)
+	if want, have := 5, len(view.Hits()); want != have {
+		t.Errorf("unexpected hits. want %d, have %d", want, have)
+	}
+}
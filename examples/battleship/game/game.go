@@ -3,6 +3,7 @@ package game
 import "fmt"
 
 const (
+	// BoardSize is the width and height of the board of the default rules.
 	BoardSize = 10
 )
 
@@ -30,6 +31,72 @@ func (s GameStage) String() string {
 	}
 }
 
+// TurnMode is how the players take turns to shoot.
+type TurnMode int
+
+const (
+	// TurnModeSimultaneous lets both players shoot in every frame.
+	TurnModeSimultaneous TurnMode = iota
+
+	// TurnModeAlternating lets the players shoot in turn, one shot
+	// per frame.
+	TurnModeAlternating
+)
+
+func (m TurnMode) String() string {
+	switch m {
+	case TurnModeSimultaneous:
+		return "simultaneous"
+	case TurnModeAlternating:
+		return "alternating"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseTurnMode parses the name of a turn mode.
+func ParseTurnMode(s string) (TurnMode, error) {
+	for _, m := range []TurnMode{TurnModeSimultaneous, TurnModeAlternating} {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown turn mode: %s", s)
+}
+
+// Variant is a rule variant of the game.
+type Variant int
+
+const (
+	// VariantClassic allows one shot per frame.
+	VariantClassic Variant = iota
+
+	// VariantSalvo allows as many shots per frame as the ships the
+	// player has afloat.
+	VariantSalvo
+)
+
+func (v Variant) String() string {
+	switch v {
+	case VariantClassic:
+		return "classic"
+	case VariantSalvo:
+		return "salvo"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseVariant parses the name of a rule variant.
+func ParseVariant(s string) (Variant, error) {
+	for _, v := range []Variant{VariantClassic, VariantSalvo} {
+		if v.String() == s {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown variant: %s", s)
+}
+
 type ShipID int
 
 const (
@@ -129,81 +196,16 @@ type ShipState struct {
 	Coordinates [][2]int
 }
 
+// NewShipState creates the state of a ship of the default rules.
 func NewShipState(id ShipID, cord [2]int, dir ShipDirection) (state *ShipState, err error) {
-	// Check if ShipID is valid
-	if !id.IsValid() {
-		err = fmt.Errorf("invalid ShipID: %v", id)
-		return
-	}
-
-	// Check coordinate within bound
-	if cord[0] < 0 || cord[0] >= BoardSize || cord[1] < 0 || cord[1] >= BoardSize {
-		err = fmt.Errorf("coordinate out of bounds: %v", cord)
-		return
-	}
-
-	// Check coordinate with direction. Then generate the cords
-	cords := make([][2]int, id.Size())
-	if dir == ShipDirectionToRight {
-		if cord[0]+id.Size()-1 >= BoardSize {
-			err = fmt.Errorf("coordinate out of bounds: cord=%v, dir=%s, size=%d", cord, dir, id.Size())
-			return
-		}
-		for i := 0; i < id.Size(); i++ {
-			cords[i] = [2]int{cord[0] + i, cord[1]}
-		}
-	} else {
-		if cord[1]+id.Size()-1 >= BoardSize {
-			err = fmt.Errorf("coordinate out of bounds: cord=%v, dir=%s, size=%d", cord, dir, id.Size())
-			return
-		}
-		for i := 0; i < id.Size(); i++ {
-			cords[i] = [2]int{cord[0], cord[1] + i}
-		}
-	}
-
-	// Generate ship state.
-	state = &ShipState{
-		ID:          id,
-		HP:          id.Size(),
-		Coordinates: cords,
-	}
-	return
+	return DefaultRules().NewShipState(id, cord, dir)
 }
 
 type ShipStates []ShipState
 
+// Validate checks the ships against the fleet of the default rules.
 func (s ShipStates) Validate() error {
-	if s == nil {
-		return fmt.Errorf("nil pointer")
-	}
-
-	// Check if all ships are placed.
-	for i := ShipIDCarrier; i <= ShipIDDestroyer; i++ {
-		found := false
-		for j := range s {
-			if s[j].ID == i {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return fmt.Errorf("ship %v not placed", i)
-		}
-	}
-
-	// Check if ships have duplicated coordinate(s)
-	coords := make(map[[2]int]bool)
-	for i := range s {
-		for j := range s[i].Coordinates {
-			if coords[s[i].Coordinates[j]] {
-				return fmt.Errorf("duplicated coordinate: (%d, %d)",
-					s[i].Coordinates[j][0], s[i].Coordinates[j][1])
-			}
-			coords[s[i].Coordinates[j]] = true
-		}
-	}
-	return nil
+	return DefaultRules().ValidateFleet(s)
 }
 
 func (s ShipStates) Initialize() error {
@@ -211,7 +213,7 @@ func (s ShipStates) Initialize() error {
 		return fmt.Errorf("nil pointer")
 	}
 	for i, l := 0, len(s); i < l; i++ {
-		s[i].HP = s[i].ID.Size()
+		s[i].HP = len(s[i].Coordinates)
 	}
 	return nil
 }
@@ -244,8 +246,8 @@ func (s BoardCellState) String() string {
 type PlayerState struct {
 	Ready         bool
 	Ships         ShipStates
-	Board         [BoardSize][BoardSize]BoardCellState
-	OpponentBoard [BoardSize][BoardSize]BoardCellState
+	Board         Board
+	OpponentBoard Board
 }
 
 // FindOwnShipAt returns the ship at the given coordinates.
@@ -280,6 +282,16 @@ func (p *PlayerState) IsAllShipsSunk() bool {
 	return true
 }
 
+// ShipsLeft returns the number of ships not sunk.
+func (p *PlayerState) ShipsLeft() (n int) {
+	for i := range p.Ships {
+		if p.Ships[i].HP > 0 {
+			n++
+		}
+	}
+	return
+}
+
 // IsAllShipsPlaced returns true if all ships are placed.
 func (p *PlayerState) IsAllShipsPlaced() bool {
 	for i := range p.Ships {
@@ -290,31 +302,61 @@ func (p *PlayerState) IsAllShipsPlaced() bool {
 	return true
 }
 
+// HitResult is the result of a shot received.
+type HitResult struct {
+	State BoardCellState `json:"state"`
+
+	// Ship is the ship sunk by the shot, if any.
+	Ship ShipID `json:"ship,omitempty"`
+
+	// Coordinates are the cells of the ship sunk by the shot, if any.
+	Coordinates [][2]int `json:"coordinates,omitempty"`
+}
+
+// Concealed returns the result without telling if a ship is sunk, i.e.
+// a shot that sinks a ship is only a hit.
+func (r HitResult) Concealed() HitResult {
+	if r.State == BoardCellStateSunk {
+		return HitResult{State: BoardCellStateHit}
+	}
+	return r
+}
+
+// ReceiveHit receives a shot at the cell, and returns the state of the
+// cell after the shot.
 func (p *PlayerState) ReceiveHit(x, y int) (s BoardCellState, err error) {
+	r, err := p.ReceiveShot(x, y)
+	return r.State, err
+}
+
+// ReceiveShot receives a shot at the cell. If the shot sinks a ship,
+// all cells of the ship are marked sunk, and the result tells the ship
+// and its cells.
+func (p *PlayerState) ReceiveShot(x, y int) (r HitResult, err error) {
+	if !p.Board.InBounds(x, y) {
+		err = fmt.Errorf("coordinate out of bounds: (%d, %d)", x, y)
+		return
+	}
 	if p.Board[x][y] != BoardCellStateUnknown {
 		err = fmt.Errorf("cell already hit")
 		return
 	}
 
-	s = BoardCellStateMiss
-
-shipInspectionLoop:
-	for i := range p.Ships {
-		for j := range p.Ships[i].Coordinates {
-			if p.Ships[i].Coordinates[j][0] == x && p.Ships[i].Coordinates[j][1] == y {
-				p.Ships[i].HP--
-				if p.Ships[i].HP == 0 {
-					s = BoardCellStateSunk
-					break shipInspectionLoop
-				} else {
-					s = BoardCellStateHit
-					break shipInspectionLoop
-				}
-			}
+	r.State = BoardCellStateMiss
+	if ship := p.FindOwnShipAt(x, y); ship != nil {
+		ship.HP--
+		r.State = BoardCellStateHit
+		if ship.HP == 0 {
+			r.State = BoardCellStateSunk
+			r.Ship = ship.ID
+			r.Coordinates = append([][2]int{}, ship.Coordinates...)
 		}
 	}
 
 	// Remember on own board.
-	p.Board[x][y] = s
+	p.Board[x][y] = r.State
+	for _, c := range r.Coordinates {
+		p.Board[c[0]][c[1]] = BoardCellStateSunk
+	}
 	return
 }
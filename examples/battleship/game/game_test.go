@@ -1,6 +1,7 @@
 package game_test
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -166,3 +167,226 @@ func TestShipsState_DuplicatedCoordinate(t *testing.T) {
 		t.Errorf("unexpected error: want=%q, have=%q", want, have)
 	}
 }
+
+func TestParseTurnMode(t *testing.T) {
+	for _, mode := range []game.TurnMode{game.TurnModeSimultaneous, game.TurnModeAlternating} {
+		if have, err := game.ParseTurnMode(mode.String()); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if want := mode; want != have {
+			t.Errorf("unexpected turn mode: want=%s, have=%s", want, have)
+		}
+	}
+	if _, err := game.ParseTurnMode("random"); err == nil {
+		t.Error("expected error but got nil")
+	}
+}
+
+func TestParseVariant(t *testing.T) {
+	for _, v := range []game.Variant{game.VariantClassic, game.VariantSalvo} {
+		if have, err := game.ParseVariant(v.String()); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if want := v; want != have {
+			t.Errorf("unexpected variant: want=%s, have=%s", want, have)
+		}
+	}
+	if _, err := game.ParseVariant("advanced"); err == nil {
+		t.Error("expected error but got nil")
+	}
+}
+
+func TestPlayerState_ShipsLeft(t *testing.T) {
+	p := game.PlayerState{Ships: game.ShipStates{
+		{ID: game.ShipIDCarrier, HP: 5},
+		{ID: game.ShipIDDestroyer, HP: 0},
+	}}
+	if want, have := 1, p.ShipsLeft(); want != have {
+		t.Errorf("unexpected ships left: want=%d, have=%d", want, have)
+	}
+}
+
+func TestParseFleet(t *testing.T) {
+	fleet, err := game.ParseFleet("Carrier:5,Battleship:4,Cruiser:3,Submarine:3,Destroyer:2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want, have := game.DefaultRules().Fleet, fleet; len(want) != len(have) {
+		t.Fatalf("unexpected fleet: want=%#v, have=%#v", want, have)
+	} else {
+		for i := range want {
+			if want[i] != have[i] {
+				t.Errorf("unexpected ship type %d: want=%#v, have=%#v", i, want[i], have[i])
+			}
+		}
+	}
+
+	fleet, err = game.ParseFleet("Frigate:3x2, Patrol:1x4")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want, have := (game.ShipType{ID: 2, Name: "Patrol", Size: 1, Count: 4}), fleet[1]; want != have {
+		t.Errorf("unexpected ship type: want=%#v, have=%#v", want, have)
+	}
+
+	for _, s := range []string{"", "Frigate", "Frigate:x2", "Frigate:3xtwo"} {
+		if _, err := game.ParseFleet(s); err == nil {
+			t.Errorf("expected error parsing %q but got nil", s)
+		}
+	}
+}
+
+func TestRules_Validate(t *testing.T) {
+	if err := game.DefaultRules().Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	fleet := []game.ShipType{{ID: 1, Name: "Frigate", Size: 3, Count: 2}}
+	for _, r := range []game.Rules{
+		{Width: 0, Height: 5, Fleet: fleet},
+		{Width: 5, Height: 5},
+		{Width: 2, Height: 2, Fleet: fleet},
+		{Width: 3, Height: 1, Fleet: fleet},
+		{Width: 5, Height: 5, Fleet: []game.ShipType{{ID: 1, Name: "Frigate", Size: 3, Count: 0}}},
+		{Width: 5, Height: 5, Fleet: append(fleet, fleet...)},
+	} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected error validating %#v but got nil", r)
+		}
+	}
+}
+
+func TestRules_ValidateFleet(t *testing.T) {
+	rules := game.Rules{Width: 6, Height: 4, Fleet: []game.ShipType{
+		{ID: 1, Name: "Frigate", Size: 3, Count: 2},
+		{ID: 2, Name: "Patrol", Size: 1, Count: 1},
+	}}
+	place := func(id game.ShipID, cord [2]int, dir game.ShipDirection) game.ShipState {
+		s, err := rules.NewShipState(id, cord, dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return *s
+	}
+	frigate1 := place(1, [2]int{3, 0}, game.ShipDirectionToRight)
+	frigate2 := place(1, [2]int{0, 1}, game.ShipDirectionToDown)
+	patrol := place(2, [2]int{5, 3}, game.ShipDirectionToRight)
+	if err := rules.ValidateFleet(game.ShipStates{frigate1, frigate2, patrol}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if _, err := rules.NewShipState(1, [2]int{4, 0}, game.ShipDirectionToRight); err == nil {
+		t.Error("expected error placing ship out of board but got nil")
+	}
+	if _, err := rules.NewShipState(3, [2]int{0, 0}, game.ShipDirectionToRight); err == nil {
+		t.Error("expected error placing ship not in fleet but got nil")
+	}
+	if err := rules.ValidateFleet(game.ShipStates{frigate1, patrol}); err == nil {
+		t.Error("expected error with missing frigate but got nil")
+	}
+	if err := rules.ValidateFleet(game.ShipStates{frigate1, frigate2, frigate1, patrol}); err == nil {
+		t.Error("expected error with extra frigate but got nil")
+	}
+
+	state := rules.NewPlayerState(game.ShipStates{frigate1, frigate2, patrol})
+	if want, have := 6, len(state.Board); want != have {
+		t.Errorf("unexpected board width: want=%d, have=%d", want, have)
+	}
+	if s, err := state.ReceiveHit(5, 3); err != nil || s != game.BoardCellStateSunk {
+		t.Errorf("unexpected result: %s, %v", s, err)
+	}
+	if _, err := state.ReceiveHit(6, 0); err == nil {
+		t.Error("expected error hitting out of board but got nil")
+	}
+}
+
+func TestRules_ValidationError(t *testing.T) {
+	rules := game.Rules{Width: 6, Height: 4, NoTouch: true, Fleet: []game.ShipType{
+		{ID: 1, Name: "Frigate", Size: 3, Count: 1},
+		{ID: 2, Name: "Patrol", Size: 1, Count: 1},
+	}}
+	frigate := game.ShipState{ID: 1, HP: 3, Coordinates: [][2]int{{0, 0}, {1, 0}, {2, 0}}}
+	ship := func(id game.ShipID, cords ...[2]int) game.ShipState {
+		return game.ShipState{ID: id, HP: len(cords), Coordinates: cords}
+	}
+
+	tests := map[string]struct {
+		ships game.ShipStates
+		rule  string
+		ship  game.ShipID
+		cord  *[2]int
+	}{
+		"extra ship":     {game.ShipStates{frigate, ship(2, [2]int{5, 3}), ship(3, [2]int{5, 0})}, game.RuleExtraShip, 3, nil},
+		"too many ships": {game.ShipStates{frigate, ship(2, [2]int{5, 3}), ship(2, [2]int{5, 0})}, game.RuleTooManyShips, 2, nil},
+		"missing ship":   {game.ShipStates{frigate}, game.RuleMissingShip, 2, nil},
+		"out of bounds":  {game.ShipStates{frigate, ship(2, [2]int{6, 3})}, game.RuleOutOfBounds, 2, &[2]int{6, 3}},
+		"overlap":        {game.ShipStates{frigate, ship(2, [2]int{2, 0})}, game.RuleOverlap, 2, &[2]int{2, 0}},
+		"no touch":       {game.ShipStates{frigate, ship(2, [2]int{3, 1})}, game.RuleNoTouch, 1, &[2]int{3, 1}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := rules.ValidateFleet(test.ships)
+			var verr *game.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected ValidationError, got %#v", err)
+			}
+			if want, have := test.rule, verr.Rule; want != have {
+				t.Errorf("unexpected rule: want=%q, have=%q", want, have)
+			}
+			if want, have := test.ship, verr.Ship; want != have {
+				t.Errorf("unexpected ship: want=%d, have=%d", want, have)
+			}
+			if want, have := test.cord, verr.Coordinate; (want == nil) != (have == nil) || (want != nil && *want != *have) {
+				t.Errorf("unexpected coordinate: want=%v, have=%v", want, have)
+			}
+		})
+	}
+
+	// Ships may touch without the rule.
+	rules.NoTouch = false
+	if err := rules.ValidateFleet(game.ShipStates{frigate, ship(2, [2]int{3, 1})}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	// Ships of a type are placed up to the count of the type.
+	rules.Fleet[1].Count = 2
+	if err := rules.ValidateFleet(game.ShipStates{frigate, ship(2, [2]int{5, 3}), ship(2, [2]int{5, 0})}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	var verr *game.ValidationError
+	err := rules.ValidateFleet(game.ShipStates{frigate, ship(2, [2]int{5, 3}), ship(2, [2]int{5, 0}), ship(2, [2]int{3, 3})})
+	if !errors.As(err, &verr) || verr.Rule != game.RuleTooManyShips {
+		t.Errorf("expected %q error, got %#v", game.RuleTooManyShips, err)
+	}
+}
+
+func TestPlayerState_ReceiveShot(t *testing.T) {
+	rules := game.Rules{Width: 4, Height: 4, Fleet: []game.ShipType{
+		{ID: 1, Name: "Destroyer", Size: 2, Count: 1},
+	}}
+	ship, _ := rules.NewShipState(1, [2]int{1, 1}, game.ShipDirectionToDown)
+	p := rules.NewPlayerState(game.ShipStates{*ship})
+
+	if r, err := p.ReceiveShot(0, 0); err != nil || r.State != game.BoardCellStateMiss {
+		t.Errorf("unexpected result: %#v, %v", r, err)
+	}
+	if r, err := p.ReceiveShot(1, 1); err != nil || r.State != game.BoardCellStateHit || r.Ship != game.ShipUndefined {
+		t.Errorf("unexpected result: %#v, %v", r, err)
+	}
+	r, err := p.ReceiveShot(1, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want, have := (game.HitResult{State: game.BoardCellStateSunk, Ship: 1, Coordinates: [][2]int{{1, 1}, {1, 2}}}), r; want.State != have.State || want.Ship != have.Ship ||
+		len(have.Coordinates) != 2 || want.Coordinates[0] != have.Coordinates[0] || want.Coordinates[1] != have.Coordinates[1] {
+		t.Errorf("unexpected result: want=%#v, have=%#v", want, have)
+	}
+
+	// All cells of the ship are sunk.
+	for _, c := range r.Coordinates {
+		if want, have := game.BoardCellStateSunk, p.Board[c[0]][c[1]]; want != have {
+			t.Errorf("unexpected state of %v: want=%s, have=%s", c, want, have)
+		}
+	}
+
+	if want, have := (game.HitResult{State: game.BoardCellStateHit}), r.Concealed(); want.State != have.State || have.Ship != 0 || have.Coordinates != nil {
+		t.Errorf("unexpected concealed result: want=%#v, have=%#v", want, have)
+	}
+}
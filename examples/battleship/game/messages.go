@@ -0,0 +1,49 @@
+package game
+
+// BoardView is the board of a player in the "frame:update" event.
+type BoardView struct {
+	// Player is the session ID of the player.
+	Player string `json:"player"`
+
+	// Ships are the ships of the player. The opponent and spectators
+	// only see the ships that are sunk.
+	Ships ShipStates `json:"ships"`
+
+	// Cells are the outcomes of the shots the player received.
+	Cells Board `json:"cells"`
+}
+
+// FrameView is the data of the "frame:update" event.
+type FrameView struct {
+	Frame  int         `json:"frame"`
+	Boards []BoardView `json:"boards"`
+
+	// Turn is the session ID of the player to shoot in alternating
+	// turn mode. Empty if both players shoot in the frame.
+	Turn string `json:"turn,omitempty"`
+
+	// Salvo is true in the Salvo variant.
+	Salvo bool `json:"salvo,omitempty"`
+}
+
+// Turn is the data of the "turn:start" event.
+type Turn struct {
+	Player string `json:"player"`
+	Frame  int    `json:"frame"`
+}
+
+// ShotResult is the response to a "shot" request after the frame is
+// resolved.
+type ShotResult struct {
+	Frame      int            `json:"frame"`
+	Coordinate [2]int         `json:"coordinate"`
+	State      BoardCellState `json:"state"`
+
+	// Ship is the ship sunk by the shot, unless the rules keep ships
+	// sunk secret.
+	Ship ShipID `json:"ship,omitempty"`
+
+	// ShipCoordinates are the cells of the ship sunk by the shot,
+	// unless the rules keep ships sunk secret.
+	ShipCoordinates [][2]int `json:"shipCoordinates,omitempty"`
+}
@@ -0,0 +1,126 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// DefaultPlacementAttempts is the number of fleets RandomPlacement
+// tries by default before giving up.
+const DefaultPlacementAttempts = 100000
+
+// PlacementOptions are the constraints of RandomPlacement, in addition
+// to the rules.
+type PlacementOptions struct {
+	// NoTouch keeps the ships apart, even diagonally. Ships are always
+	// kept apart if the rules forbid them to touch.
+	NoTouch bool
+
+	// AvoidEdges keeps the ships off the edges of the board.
+	AvoidEdges bool
+
+	// Attempts is the number of fleets to try before giving up.
+	// DefaultPlacementAttempts if 0.
+	Attempts int
+}
+
+// candidate is a position of a ship on the board.
+type candidate struct {
+	placement ShipPlacement
+	cells     [][2]int
+}
+
+// candidates returns all the positions of the ship type on the board
+// allowed by the options.
+func candidates(rules Rules, st ShipType, opts PlacementOptions) []candidate {
+	margin := 0
+	if opts.AvoidEdges {
+		margin = 1
+	}
+	list := make([]candidate, 0, 2*rules.Width*rules.Height)
+	for _, dir := range []ShipDirection{ShipDirectionToRight, ShipDirectionToDown} {
+		if st.Size == 1 && dir == ShipDirectionToDown {
+			// Same cells as to the right.
+			continue
+		}
+		for x := margin; x < rules.Width-margin; x++ {
+			for y := margin; y < rules.Height-margin; y++ {
+				state, err := rules.NewShipState(st.ID, [2]int{x, y}, dir)
+				if err != nil {
+					continue
+				}
+				last := state.Coordinates[len(state.Coordinates)-1]
+				if last[0] >= rules.Width-margin || last[1] >= rules.Height-margin {
+					continue
+				}
+				list = append(list, candidate{
+					placement: ShipPlacement{ID: st.ID, Coordinate: [2]int{x, y}, Direction: dir},
+					cells:     state.Coordinates,
+				})
+			}
+		}
+	}
+	return list
+}
+
+// RandomPlacement returns a random legal placement of the fleet of the
+// rules, drawn from the random source. Every legal fleet is equally
+// likely: each ship is put at a random position, and the whole fleet is
+// tried again if a ship does not fit with the ships placed before.
+//
+// Returns error if no legal fleet is found within the attempts.
+func RandomPlacement(rules Rules, rng *rand.Rand, opts PlacementOptions) ([]ShipPlacement, error) {
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	noTouch := opts.NoTouch || rules.NoTouch
+	attempts := opts.Attempts
+	if attempts <= 0 {
+		attempts = DefaultPlacementAttempts
+	}
+
+	// Place the largest ships first, to reject crowded fleets early.
+	types := make([][]candidate, 0, rules.FleetSize())
+	for _, st := range rules.Fleet {
+		list := candidates(rules, st, opts)
+		if len(list) == 0 {
+			return nil, fmt.Errorf("no room for ship %s", st.Name)
+		}
+		for i := 0; i < st.Count; i++ {
+			types = append(types, list)
+		}
+	}
+	sort.SliceStable(types, func(i, j int) bool {
+		return len(types[i][0].cells) > len(types[j][0].cells)
+	})
+
+	placements := make([]ShipPlacement, len(types))
+	blocked := make(map[[2]int]bool, rules.Width*rules.Height)
+attemptLoop:
+	for n := 0; n < attempts; n++ {
+		clear(blocked)
+		for i, list := range types {
+			c := list[rng.Intn(len(list))]
+			for _, cell := range c.cells {
+				if blocked[cell] {
+					continue attemptLoop
+				}
+			}
+			for _, cell := range c.cells {
+				blocked[cell] = true
+				if !noTouch {
+					continue
+				}
+				for dx := -1; dx <= 1; dx++ {
+					for dy := -1; dy <= 1; dy++ {
+						blocked[[2]int{cell[0] + dx, cell[1] + dy}] = true
+					}
+				}
+			}
+			placements[i] = c.placement
+		}
+		return placements, nil
+	}
+	return nil, fmt.Errorf("no legal placement found in %d attempts", attempts)
+}
@@ -0,0 +1,110 @@
+package game_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/yookoala/botgame-playground/examples/battleship/game"
+)
+
+// shipStates converts the placements to ship states of the rules.
+func shipStates(t *testing.T, rules game.Rules, ships []game.ShipPlacement) game.ShipStates {
+	states := make(game.ShipStates, 0, len(ships))
+	for _, sp := range ships {
+		s, err := rules.NewShipState(sp.ID, sp.Coordinate, sp.Direction)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		states = append(states, *s)
+	}
+	return states
+}
+
+func TestRandomPlacement(t *testing.T) {
+	rules := game.DefaultRules()
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		ships, err := game.RandomPlacement(rules, rng, game.PlacementOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := rules.ValidateFleet(shipStates(t, rules, ships)); err != nil {
+			t.Fatalf("invalid placement %v: %s", ships, err)
+		}
+	}
+
+	// Same seed, same placement.
+	ships1, _ := game.RandomPlacement(rules, rand.New(rand.NewSource(42)), game.PlacementOptions{})
+	ships2, _ := game.RandomPlacement(rules, rand.New(rand.NewSource(42)), game.PlacementOptions{})
+	for i := range ships1 {
+		if ships1[i] != ships2[i] {
+			t.Errorf("unexpected placement %d with the same seed: %v != %v", i, ships1[i], ships2[i])
+		}
+	}
+}
+
+func TestRandomPlacement_Options(t *testing.T) {
+	rules := game.DefaultRules()
+	touching := rules
+	touching.NoTouch = true
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		ships, err := game.RandomPlacement(rules, rng, game.PlacementOptions{NoTouch: true, AvoidEdges: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		states := shipStates(t, rules, ships)
+		if err := touching.ValidateFleet(states); err != nil {
+			t.Fatalf("invalid placement %v: %s", ships, err)
+		}
+		for _, s := range states {
+			for _, c := range s.Coordinates {
+				if c[0] == 0 || c[1] == 0 || c[0] == rules.Width-1 || c[1] == rules.Height-1 {
+					t.Fatalf("ship %s on the edge: %v", s.ID, s.Coordinates)
+				}
+			}
+		}
+	}
+}
+
+func TestRandomPlacement_Impossible(t *testing.T) {
+	rules := game.Rules{Width: 3, Height: 3, NoTouch: true, Fleet: []game.ShipType{
+		{ID: 1, Name: "Frigate", Size: 3, Count: 3},
+	}}
+	_, err := game.RandomPlacement(rules, rand.New(rand.NewSource(1)), game.PlacementOptions{Attempts: 100})
+	if err == nil {
+		t.Error("expected error but got nil")
+	}
+	rules.Width = 2
+	_, err = game.RandomPlacement(rules, rand.New(rand.NewSource(1)), game.PlacementOptions{AvoidEdges: true})
+	if err == nil {
+		t.Error("expected error but got nil")
+	}
+}
+
+func TestRandomPlacement_Uniform(t *testing.T) {
+	// A frigate and a patrol boat on a 4x1 board have 6 legal
+	// placements, to be drawn equally likely.
+	rules := game.Rules{Width: 4, Height: 1, Fleet: []game.ShipType{
+		{ID: 1, Name: "Frigate", Size: 2, Count: 1},
+		{ID: 2, Name: "Patrol", Size: 1, Count: 1},
+	}}
+	rng := rand.New(rand.NewSource(1))
+	counts := make(map[[2][2]int]int)
+	const draws = 6000
+	for i := 0; i < draws; i++ {
+		ships, err := game.RandomPlacement(rules, rng, game.PlacementOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		counts[[2][2]int{ships[0].Coordinate, ships[1].Coordinate}]++
+	}
+	if want, have := 6, len(counts); want != have {
+		t.Fatalf("unexpected number of placements. want %d, have %d: %v", want, have, counts)
+	}
+	for placement, n := range counts {
+		if n < draws/6*8/10 || n > draws/6*12/10 {
+			t.Errorf("placement %v drawn %d times of %d", placement, n, draws)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Board is the cell states of a board, indexed by [x][y].
+type Board [][]BoardCellState
+
+// NewBoard creates a new board of unknown cells.
+func NewBoard(width, height int) Board {
+	b := make(Board, width)
+	for x := range b {
+		b[x] = make([]BoardCellState, height)
+	}
+	return b
+}
+
+// InBounds reports if the coordinate is on the board.
+func (b Board) InBounds(x, y int) bool {
+	return x >= 0 && x < len(b) && y >= 0 && y < len(b[x])
+}
+
+// Clone returns a copy of the board.
+func (b Board) Clone() Board {
+	if b == nil {
+		return nil
+	}
+	c := make(Board, len(b))
+	for x := range b {
+		c[x] = append([]BoardCellState{}, b[x]...)
+	}
+	return c
+}
+
+// ShipType is a type of ship in the fleet.
+type ShipType struct {
+	ID    ShipID `json:"id"`
+	Name  string `json:"name"`
+	Size  int    `json:"size"`
+	Count int    `json:"count"`
+}
+
+// Rules are the board dimensions and the fleet of a match.
+type Rules struct {
+	Width  int        `json:"width"`
+	Height int        `json:"height"`
+	Fleet  []ShipType `json:"fleet"`
+
+	// NoTouch forbids ships to be placed next to each other, even
+	// diagonally.
+	NoTouch bool `json:"noTouch,omitempty"`
+
+	// NoReveal keeps the ships sunk secret from the opponent. A shot
+	// that sinks a ship is told as a hit.
+	NoReveal bool `json:"noReveal,omitempty"`
+}
+
+// Placement rules broken in ValidationError.
+//
+// Ships of a type share the ShipID of the type. RuleTooManyShips and
+// RuleMissingShip are broken if a type is placed more or less times
+// than the Count of the type.
+const (
+	RuleExtraShip    = "extra ship"
+	RuleMissingShip  = "missing ship"
+	RuleTooManyShips = "too many ships"
+	RuleOutOfBounds  = "out of bounds"
+	RuleOverlap      = "overlap"
+	RuleNoTouch      = "no touch"
+)
+
+// ValidationError is an error of ship placement. It tells the rule
+// broken, and the ship and the coordinate at fault if any.
+type ValidationError struct {
+	Rule       string  `json:"rule"`
+	Ship       ShipID  `json:"ship,omitempty"`
+	Coordinate *[2]int `json:"coordinate,omitempty"`
+	Message    string  `json:"message"`
+}
+
+// newValidationError creates a ValidationError of the ship at the
+// coordinate. The coordinate is omitted if nil.
+func newValidationError(rule string, ship ShipID, cord *[2]int, format string, a ...interface{}) *ValidationError {
+	return &ValidationError{
+		Rule:       rule,
+		Ship:       ship,
+		Coordinate: cord,
+		Message:    fmt.Sprintf(format, a...),
+	}
+}
+
+func (err *ValidationError) Error() string {
+	return err.Message
+}
+
+// DefaultRules returns the rules of the classic game: a board of
+// BoardSize by BoardSize, and one of each ship from Carrier to Destroyer.
+func DefaultRules() Rules {
+	r := Rules{Width: BoardSize, Height: BoardSize}
+	for id := ShipIDCarrier; id <= ShipIDDestroyer; id++ {
+		r.Fleet = append(r.Fleet, ShipType{ID: id, Name: id.String(), Size: id.Size(), Count: 1})
+	}
+	return r
+}
+
+// ParseFleet parses a fleet of comma separated ship types. Each ship type
+// is "<name>:<size>", or "<name>:<size>x<count>" for more than one ship
+// of the type. Ships are given IDs from 1 in order, so the classic fleet
+// is "Carrier:5,Battleship:4,Cruiser:3,Submarine:3,Destroyer:2".
+func ParseFleet(s string) ([]ShipType, error) {
+	fleet := make([]ShipType, 0)
+	for i, field := range strings.Split(s, ",") {
+		name, spec, ok := strings.Cut(strings.TrimSpace(field), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid ship type %q: expected <name>:<size>[x<count>]", field)
+		}
+		size, count, ok := strings.Cut(spec, "x")
+		if !ok {
+			count = "1"
+		}
+		st := ShipType{ID: ShipID(i + 1), Name: name}
+		var err error
+		if st.Size, err = strconv.Atoi(size); err != nil {
+			return nil, fmt.Errorf("invalid size of ship %s: %s", name, size)
+		}
+		if st.Count, err = strconv.Atoi(count); err != nil {
+			return nil, fmt.Errorf("invalid count of ship %s: %s", name, count)
+		}
+		fleet = append(fleet, st)
+	}
+	return fleet, nil
+}
+
+// Validate checks if a game can be played with the rules.
+func (r Rules) Validate() error {
+	if r.Width <= 0 || r.Height <= 0 {
+		return fmt.Errorf("invalid board size: %dx%d", r.Width, r.Height)
+	}
+	if len(r.Fleet) == 0 {
+		return fmt.Errorf("empty fleet")
+	}
+	ids := make(map[ShipID]bool, len(r.Fleet))
+	cells := 0
+	for _, st := range r.Fleet {
+		if st.ID == ShipUndefined || ids[st.ID] {
+			return fmt.Errorf("invalid or duplicated ShipID: %v", int(st.ID))
+		}
+		ids[st.ID] = true
+		if st.Size <= 0 || (st.Size > r.Width && st.Size > r.Height) {
+			return fmt.Errorf("ship %s of size %d does not fit the board", st.Name, st.Size)
+		}
+		if st.Count <= 0 {
+			return fmt.Errorf("invalid count of ship %s: %d", st.Name, st.Count)
+		}
+		cells += st.Size * st.Count
+	}
+	if cells > r.Width*r.Height {
+		return fmt.Errorf("fleet of %d cells does not fit the board", cells)
+	}
+	return nil
+}
+
+// ShipType returns the ship type of the ID.
+func (r Rules) ShipType(id ShipID) (st ShipType, ok bool) {
+	for _, st := range r.Fleet {
+		if st.ID == id {
+			return st, true
+		}
+	}
+	return
+}
+
+// FleetSize returns the number of ships in the fleet.
+func (r Rules) FleetSize() (n int) {
+	for _, st := range r.Fleet {
+		n += st.Count
+	}
+	return
+}
+
+// NewBoard creates a new board of the rules.
+func (r Rules) NewBoard() Board {
+	return NewBoard(r.Width, r.Height)
+}
+
+// InBounds reports if the coordinate is on the board.
+func (r Rules) InBounds(cord [2]int) bool {
+	return cord[0] >= 0 && cord[0] < r.Width && cord[1] >= 0 && cord[1] < r.Height
+}
+
+// NewShipState creates the state of the ship placed at the coordinate
+// in the direction.
+func (r Rules) NewShipState(id ShipID, cord [2]int, dir ShipDirection) (state *ShipState, err error) {
+	// Check if ShipID is valid
+	st, ok := r.ShipType(id)
+	if !ok {
+		err = newValidationError(RuleExtraShip, id, nil, "invalid ShipID: %v", id)
+		return
+	}
+
+	// Check coordinate within bound
+	if !r.InBounds(cord) {
+		err = newValidationError(RuleOutOfBounds, id, &cord, "coordinate out of bounds: %v", cord)
+		return
+	}
+
+	// Check coordinate with direction. Then generate the cords
+	cords := make([][2]int, st.Size)
+	for i := range cords {
+		if dir == ShipDirectionToRight {
+			cords[i] = [2]int{cord[0] + i, cord[1]}
+		} else {
+			cords[i] = [2]int{cord[0], cord[1] + i}
+		}
+	}
+	if !r.InBounds(cords[len(cords)-1]) {
+		err = newValidationError(RuleOutOfBounds, id, &cord,
+			"coordinate out of bounds: cord=%v, dir=%s, size=%d", cord, dir, st.Size)
+		return
+	}
+
+	// Generate ship state.
+	state = &ShipState{
+		ID:          id,
+		HP:          st.Size,
+		Coordinates: cords,
+	}
+	return
+}
+
+// ValidateFleet checks if the ships are the fleet of the rules, all on
+// the board without overlapping, and not touching each other if the
+// rules forbid. Errors of placement are *ValidationError.
+func (r Rules) ValidateFleet(s ShipStates) error {
+	if s == nil {
+		return fmt.Errorf("nil pointer")
+	}
+
+	// Check if all ships of each type are placed, and no more.
+	placed := make(map[ShipID]int, len(r.Fleet))
+	for i := range s {
+		st, ok := r.ShipType(s[i].ID)
+		if !ok {
+			return newValidationError(RuleExtraShip, s[i].ID, nil, "invalid ShipID: %v", s[i].ID)
+		}
+		if placed[st.ID]++; placed[st.ID] > st.Count {
+			return newValidationError(RuleTooManyShips, st.ID, nil,
+				"ship %s placed more than %d time(s)", st.Name, st.Count)
+		}
+	}
+	for _, st := range r.Fleet {
+		switch n := placed[st.ID]; {
+		case n == 0:
+			return newValidationError(RuleMissingShip, st.ID, nil, "ship %s not placed", st.Name)
+		case n < st.Count:
+			return newValidationError(RuleMissingShip, st.ID, nil,
+				"ship %s: %d of %d placed", st.Name, n, st.Count)
+		}
+	}
+
+	// Check if ships have duplicated coordinate(s)
+	owners := make(map[[2]int]int)
+	for i := range s {
+		for _, cord := range s[i].Coordinates {
+			cord := cord
+			if !r.InBounds(cord) {
+				return newValidationError(RuleOutOfBounds, s[i].ID, &cord, "coordinate out of bounds: %v", cord)
+			}
+			if _, ok := owners[cord]; ok {
+				return newValidationError(RuleOverlap, s[i].ID, &cord,
+					"duplicated coordinate: (%d, %d)", cord[0], cord[1])
+			}
+			owners[cord] = i
+		}
+	}
+	if !r.NoTouch {
+		return nil
+	}
+
+	// Check if ships touch each other.
+	for i := range s {
+		for _, cord := range s[i].Coordinates {
+			for dx := -1; dx <= 1; dx++ {
+				for dy := -1; dy <= 1; dy++ {
+					next := [2]int{cord[0] + dx, cord[1] + dy}
+					if j, ok := owners[next]; ok && j != i {
+						st1, _ := r.ShipType(s[i].ID)
+						st2, _ := r.ShipType(s[j].ID)
+						return newValidationError(RuleNoTouch, s[i].ID, &next,
+							"ship %s touches ship %s at (%d, %d)", st1.Name, st2.Name, next[0], next[1])
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// NewPlayerState creates the state of a player with the ships, and the
+// boards of the rules.
+func (r Rules) NewPlayerState(ships ShipStates) PlayerState {
+	return PlayerState{
+		Ready:         true,
+		Ships:         ships,
+		Board:         r.NewBoard(),
+		OpponentBoard: r.NewBoard(),
+	}
+}
@@ -0,0 +1,1044 @@
+// Package server implements the battleship game server as a
+// comms.MessageHandler.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+	"github.com/yookoala/botgame-playground/examples/battleship/game"
+	"github.com/yookoala/botgame-playground/gameclock"
+	"github.com/yookoala/botgame-playground/ratings"
+)
+
+// Game is a battleship game of 2 players.
+//
+// Other sessions can watch the game as spectators with the "subscribe"
+// request. Events of the game are written once for all sessions, then
+// projected for each recipient by ProjectEvent. An event may carry
+// private information (e.g. the full boards in "frame:update") only if
+// ProjectEvent hides it from the sessions not to see it. Events not
+// known to ProjectEvent are sent to all sessions as is, so they must
+// only carry public information.
+//
+// A player may "setup" with null data to have the ships placed at
+// random. The placements are sent to the player in the response.
+//
+// Implements comms.MessageHandler interface.
+type Game struct {
+	stage game.GameStage
+
+	player1 *comms.Session
+	player2 *comms.Session
+
+	spectators map[string]*comms.Session
+
+	playerState map[*comms.Session]game.PlayerState
+
+	lock *sync.Mutex
+
+	frame         int
+	frameRequests map[string]comms.Request
+
+	// handling serializes message handling with timeouts of the clock.
+	handling *sync.Mutex
+
+	timeSource  gameclock.Clock
+	timeControl gameclock.Config
+	clock       *gameclock.GameClock
+	mw          comms.MessageWriter
+
+	turnMode  game.TurnMode
+	extraShot bool
+	turn      string
+
+	variant game.Variant
+
+	rules game.Rules
+
+	// rng places ships automatically and makes random shots. Only used
+	// with the handling lock held.
+	rng *rand.Rand
+}
+
+// NewGame creates a new Game.
+func NewGame() *Game {
+	return &Game{
+		lock:     &sync.Mutex{},
+		handling: &sync.Mutex{},
+
+		playerState: make(map[*comms.Session]game.PlayerState),
+		spectators:  make(map[string]*comms.Session),
+
+		frameRequests: make(map[string]comms.Request),
+
+		rules: game.DefaultRules(),
+		rng:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// RandomSource sets the source of randomness of the game, e.g. a seeded
+// source to reproduce automatic placements and random shots.
+func (g *Game) RandomSource(src rand.Source) *Game {
+	g.rng = rand.New(src)
+	return g
+}
+
+// Rules sets the board size and the fleet of the game. The rules are
+// announced to the players with the "game:rules" event when the setup
+// stage starts.
+func (g *Game) Rules(r game.Rules) *Game {
+	g.rules = r
+	return g
+}
+
+// TimeControl limits the time of players to make their shots, on the
+// clock. Players that run out of time get the timeout action of the
+// config. The clocks are announced with "clock:update" events.
+func (g *Game) TimeControl(clock gameclock.Clock, config gameclock.Config) *Game {
+	g.timeSource, g.timeControl = clock, config
+	return g
+}
+
+// Turns sets how the players take turns to shoot. In alternating turn
+// mode, the active player is sent a "turn:start" event and shots out of
+// turn are refused. If extraShot is true, a player who hits a ship
+// shoots again.
+func (g *Game) Turns(mode game.TurnMode, extraShot bool) *Game {
+	g.turnMode, g.extraShot = mode, extraShot
+	return g
+}
+
+// Variant sets the rule variant of the game. In the Salvo variant, the
+// data of a "shot" request is a list of coordinates, one for each ship
+// of the player afloat, and the response is a list of game.ShotResult.
+func (g *Game) Variant(v game.Variant) *Game {
+	g.variant = v
+	return g
+}
+
+func (g *Game) IsPlayerSession(sessionID string) bool {
+	return g.GetPlayerSession(sessionID) != nil
+}
+
+func (g *Game) GetPlayerSession(sessionID string) *comms.Session {
+	if g.player1 != nil && g.player1.ID() == sessionID {
+		return g.player1
+	}
+	if g.player2 != nil && g.player2.ID() == sessionID {
+		return g.player2
+	}
+	return nil
+}
+
+// frameUpdate returns the "frame:update" event of the current frame with
+// the full boards of both players. The event is projected for each
+// recipient by ProjectEvent.
+func (g *Game) frameUpdate() comms.Message {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	view := game.FrameView{
+		Frame:  g.frame,
+		Boards: make([]game.BoardView, 0, 2),
+		Turn:   g.turn,
+		Salvo:  g.variant == game.VariantSalvo,
+	}
+	for _, p := range []*comms.Session{g.player1, g.player2} {
+		state := g.playerState[p]
+		view.Boards = append(view.Boards, game.BoardView{
+			Player: p.ID(),
+			Ships:  append(game.ShipStates{}, state.Ships...),
+			Cells:  state.Board.Clone(),
+		})
+	}
+	return comms.NewEvent("frame:update", view)
+}
+
+// ProjectEvent hides the ships of the opponent in "frame:update" events,
+// unless they are sunk. Spectators see no ship that is not sunk. If the
+// rules keep ships sunk secret, no ship of the opponent is shown, and
+// cells sunk are shown as hit. The "turn:start" event is only sent to
+// the active player. Other events are public.
+//
+// Implements comms.EventProjector interface.
+func (g *Game) ProjectEvent(evt comms.Event, sessionID string) comms.Message {
+	if evt.EventType() == "turn:start" {
+		var turn game.Turn
+		if err := evt.ReadDataTo(&turn); err != nil || turn.Player != sessionID {
+			return nil
+		}
+		return evt
+	}
+	if evt.EventType() != "frame:update" {
+		return evt
+	}
+	var view game.FrameView
+	if err := evt.ReadDataTo(&view); err != nil {
+		log.Printf("error reading frame: %s", err)
+		return nil
+	}
+	for i, b := range view.Boards {
+		if b.Player == sessionID {
+			continue
+		}
+		sunk := make(game.ShipStates, 0, len(b.Ships))
+		for _, ship := range b.Ships {
+			if ship.HP == 0 && !g.rules.NoReveal {
+				sunk = append(sunk, ship)
+			}
+		}
+		view.Boards[i].Ships = sunk
+		if g.rules.NoReveal {
+			for x := range b.Cells {
+				for y := range b.Cells[x] {
+					if b.Cells[x][y] == game.BoardCellStateSunk {
+						b.Cells[x][y] = game.BoardCellStateHit
+					}
+				}
+			}
+		}
+	}
+	return comms.NewEvent("frame:update", view)
+}
+
+// IsSpectatorSession reports if the session is a spectator.
+func (g *Game) IsSpectatorSession(sessionID string) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	_, ok := g.spectators[sessionID]
+	return ok
+}
+
+// PublicState is the game state visible to spectators.
+type PublicState struct {
+	Stage   game.GameStage `json:"stage"`
+	Players []string       `json:"players"`
+
+	// Turn is the player to shoot in alternating turn mode.
+	Turn string `json:"turn,omitempty"`
+
+	// Rules are the board size and the fleet of the game.
+	Rules game.Rules `json:"rules"`
+}
+
+// publicState returns the current public state of the game.
+func (g *Game) publicState() PublicState {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	ps := PublicState{Stage: g.stage, Players: make([]string, 0, 2), Turn: g.turn, Rules: g.rules}
+	for _, p := range []*comms.Session{g.player1, g.player2} {
+		if p != nil {
+			ps.Players = append(ps.Players, p.ID())
+		}
+	}
+	return ps
+}
+
+// subscribe adds the session as a spectator, and responds with the
+// public state of the game. Players cannot be spectators.
+func (g *Game) subscribe(sc comms.SessionCollection, sessionID string, req comms.Request, mw comms.MessageWriter) error {
+	if g.IsPlayerSession(sessionID) {
+		return mw.WriteMessage(comms.NewErrorResponse(
+			sessionID,
+			req.RequestID(),
+			400,
+			"error",
+			"player cannot subscribe as spectator",
+		))
+	}
+
+	s := sc.Get(sessionID)
+	if s == nil {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	g.lock.Lock()
+	if _, ok := g.spectators[sessionID]; !ok {
+		g.spectators[sessionID] = s
+		s.OnClose(func(s *comms.Session) {
+			g.lock.Lock()
+			delete(g.spectators, s.ID())
+			g.lock.Unlock()
+		})
+		log.Printf("adding session as spectator: %s", sessionID)
+	}
+	g.lock.Unlock()
+
+	return mw.WriteMessage(comms.NewResponse(
+		sessionID,
+		req.RequestID(),
+		req.RequestType(),
+		200,
+		"success",
+		g.publicState(),
+	))
+}
+
+// FullState is the full state of the game for administrators.
+type FullState struct {
+	PublicState
+	Frame      int              `json:"frame"`
+	Boards     []game.BoardView `json:"boards"`
+	Ready      []string         `json:"ready"`
+	Spectators []string         `json:"spectators"`
+}
+
+// Inspect returns the full state of the game, including the ships of
+// both players.
+//
+// Implements comms.Inspector interface.
+func (g *Game) Inspect() interface{} {
+	fs := FullState{PublicState: g.publicState()}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	fs.Frame = g.frame
+	fs.Boards = make([]game.BoardView, 0, 2)
+	fs.Ready = make([]string, 0, 2)
+	for _, p := range []*comms.Session{g.player1, g.player2} {
+		if p == nil {
+			continue
+		}
+		state := g.playerState[p]
+		fs.Boards = append(fs.Boards, game.BoardView{
+			Player: p.ID(),
+			Ships:  append(game.ShipStates{}, state.Ships...),
+			Cells:  state.Board.Clone(),
+		})
+		if state.Ready {
+			fs.Ready = append(fs.Ready, p.ID())
+		}
+	}
+	fs.Spectators = make([]string, 0, len(g.spectators))
+	for id := range g.spectators {
+		fs.Spectators = append(fs.Spectators, id)
+	}
+	sort.Strings(fs.Spectators)
+	return fs
+}
+
+// EndGame ends the game with the winner declared by an administrator,
+// and broadcasts the "game:result" event. The winner must be a player,
+// or empty for a draw.
+//
+// Implements comms.GameEnder interface.
+func (g *Game) EndGame(winner string, mw comms.MessageWriter) error {
+	g.handling.Lock()
+	defer g.handling.Unlock()
+	return g.endGame(winner, ReasonAdmin, mw)
+}
+
+// Leave forfeits the game of a player who left the room, e.g. a bot
+// that crashed, once the players are set up or playing. The opponent
+// wins.
+//
+// Implements comms.Leaver interface.
+func (g *Game) Leave(sessionID string, mw comms.MessageWriter) {
+	g.handling.Lock()
+	defer g.handling.Unlock()
+	ps := g.publicState()
+	if ps.Stage != game.GameStageSetup && ps.Stage != game.GameStagePlaying {
+		return
+	}
+	if !g.IsPlayerSession(sessionID) {
+		return
+	}
+	winner := g.player1.ID()
+	if winner == sessionID {
+		winner = g.player2.ID()
+	}
+	log.Printf("player %s left the game", sessionID)
+	g.endGame(winner, ReasonForfeit, mw)
+}
+
+// Reasons a game ends.
+const (
+	ReasonFleetSunk = "fleet sunk"
+	ReasonTimeout   = "timeout"
+	ReasonAdmin     = "admin"
+	ReasonForfeit   = "forfeit"
+)
+
+// PlayerStats are the statistics of a player in the "game:result" event.
+type PlayerStats struct {
+	Player    string `json:"player"`
+	Shots     int    `json:"shots"`
+	Hits      int    `json:"hits"`
+	Misses    int    `json:"misses"`
+	ShipsSunk int    `json:"shipsSunk"`
+	ShipsLeft int    `json:"shipsLeft"`
+}
+
+// Result is the data of the "game:result" event. It embeds the result
+// for ratings, so it can also be read as ratings.GameResult.
+type Result struct {
+	ratings.GameResult
+	Reason string        `json:"reason"`
+	Frames int           `json:"frames"`
+	Stats  []PlayerStats `json:"stats"`
+}
+
+// stats returns the statistics of the players.
+func (g *Game) stats() []PlayerStats {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	stats := make([]PlayerStats, 0, 2)
+	for _, pair := range [][2]*comms.Session{{g.player1, g.player2}, {g.player2, g.player1}} {
+		p, opponent := pair[0], pair[1]
+		if p == nil {
+			continue
+		}
+		ps := PlayerStats{Player: p.ID()}
+		state := g.playerState[p]
+		for _, row := range state.OpponentBoard {
+			for _, cell := range row {
+				switch cell {
+				case game.BoardCellStateHit, game.BoardCellStateSunk:
+					ps.Hits++
+				case game.BoardCellStateMiss:
+					ps.Misses++
+				}
+			}
+		}
+		ps.Shots = ps.Hits + ps.Misses
+		for _, ship := range state.Ships {
+			if ship.HP > 0 {
+				ps.ShipsLeft++
+			}
+		}
+		if opponent != nil {
+			for _, ship := range g.playerState[opponent].Ships {
+				if ship.HP == 0 {
+					ps.ShipsSunk++
+				}
+			}
+		}
+		stats = append(stats, ps)
+	}
+	return stats
+}
+
+// endGame ends the game with the winner for the reason, and broadcasts
+// the result. Caller should hold the handling lock.
+func (g *Game) endGame(winner, reason string, mw comms.MessageWriter) error {
+	ps := g.publicState()
+	if ps.Stage == game.GameStageEnded {
+		return fmt.Errorf("game already ended")
+	}
+	if winner != "" && !g.IsPlayerSession(winner) {
+		return fmt.Errorf("winner is not a player: %s", winner)
+	}
+
+	g.lock.Lock()
+	g.stage = game.GameStageEnded
+	g.lock.Unlock()
+	if g.clock != nil {
+		g.clock.StopAll()
+	}
+	mw.WriteMessage(comms.NewEvent("stage:change", game.GameStageEnded))
+	g.lock.Lock()
+	frames := g.frame
+	g.lock.Unlock()
+	log.Printf("game ended (winner=%q, reason=%s)", winner, reason)
+	return mw.WriteMessage(comms.NewEvent("game:result", Result{
+		GameResult: ratings.GameResult{
+			Players: ps.Players,
+			Winner:  winner,
+		},
+		Reason: reason,
+		Frames: frames,
+		Stats:  g.stats(),
+	}))
+}
+
+// startClock starts the clocks of both players for the first frame, if
+// there is time control. Caller should hold the handling lock.
+func (g *Game) startClock(mw comms.MessageWriter) {
+	if !g.timeControl.Enabled() {
+		return
+	}
+	g.mw = mw
+	g.clock = gameclock.New(g.timeSource, g.timeControl, g.player1.ID(), g.player2.ID())
+	g.clock.OnTimeout(g.handleTimeout)
+	g.restartClock(mw)
+}
+
+// restartClock starts the clocks of the players to shoot in a new
+// frame, if there is time control.
+func (g *Game) restartClock(mw comms.MessageWriter) {
+	if g.clock == nil {
+		return
+	}
+	for _, p := range g.shooters() {
+		g.clock.Start(p)
+	}
+	mw.WriteMessage(comms.NewEvent("clock:update", g.clock.State()))
+}
+
+// shooters returns the players to shoot in the current frame.
+func (g *Game) shooters() []string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.turnMode == game.TurnModeAlternating {
+		return []string{g.turn}
+	}
+	return []string{g.player1.ID(), g.player2.ID()}
+}
+
+// startTurn sends the "turn:start" event to the active player in
+// alternating turn mode.
+func (g *Game) startTurn(mw comms.MessageWriter) {
+	g.lock.Lock()
+	turn := game.Turn{Player: g.turn, Frame: g.frame}
+	g.lock.Unlock()
+	if turn.Player != "" {
+		mw.WriteMessage(comms.NewEvent("turn:start", turn))
+	}
+}
+
+// handleTimeout takes the timeout action for the player who has not
+// shot in time.
+func (g *Game) handleTimeout(player string) {
+	g.handling.Lock()
+	defer g.handling.Unlock()
+	if g.publicState().Stage != game.GameStagePlaying {
+		return
+	}
+
+	action := g.timeControl.Timeout
+	log.Printf("player %s timed out (action=%s)", player, action)
+	g.mw.WriteMessage(comms.NewEvent("clock:timeout", map[string]interface{}{
+		"player": player,
+		"action": action,
+	}))
+
+	switch action {
+	case gameclock.ActionRandom:
+		g.submitMove(player, g.randomShot(player), g.mw)
+	case gameclock.ActionSkip:
+		g.submitMove(player, comms.NewRequest("", "skip", nil), g.mw)
+	default:
+		winner := g.player1.ID()
+		if winner == player {
+			winner = g.player2.ID()
+		}
+		g.endGame(winner, ReasonTimeout, g.mw)
+	}
+}
+
+// Pause pauses the clocks of the players, so no player times out while
+// the room of the game is paused.
+//
+// Implements comms.Pauser interface.
+func (g *Game) Pause() {
+	g.handling.Lock()
+	defer g.handling.Unlock()
+	if g.clock == nil {
+		return
+	}
+	g.clock.Pause()
+	g.mw.WriteMessage(comms.NewEvent("clock:update", g.clock.State()))
+}
+
+// Resume resumes the clocks of the players with the time left when
+// paused.
+//
+// Implements comms.Pauser interface.
+func (g *Game) Resume() {
+	g.handling.Lock()
+	defer g.handling.Unlock()
+	if g.clock == nil {
+		return
+	}
+	g.clock.Resume()
+	g.mw.WriteMessage(comms.NewEvent("clock:update", g.clock.State()))
+}
+
+// randomShot returns a shot request at random cells the player has not
+// shot at, or a skip request if there is none.
+func (g *Game) randomShot(player string) comms.Request {
+	g.lock.Lock()
+	state := g.playerState[g.GetPlayerSession(player)]
+	g.lock.Unlock()
+	board := state.OpponentBoard
+
+	cells := make([][2]int, 0, g.rules.Width*g.rules.Height)
+	for x := range board {
+		for y := range board[x] {
+			if board[x][y] == game.BoardCellStateUnknown {
+				cells = append(cells, [2]int{x, y})
+			}
+		}
+	}
+	if len(cells) == 0 {
+		return comms.NewRequest("", "skip", nil)
+	}
+	g.rng.Shuffle(len(cells), func(i, j int) {
+		cells[i], cells[j] = cells[j], cells[i]
+	})
+	if g.variant == game.VariantSalvo {
+		return comms.NewRequest("", "shot", cells[:min(state.ShipsLeft(), len(cells))])
+	}
+	return comms.NewRequest("", "shot", cells[0])
+}
+
+// submitMove accepts the move of the player for the frame, and stops the
+// clock of the player. Only the first move of a frame is accepted. Caller
+// should hold the handling lock.
+func (g *Game) submitMove(player string, req comms.Request, mw comms.MessageWriter) {
+	g.lock.Lock()
+	if _, ok := g.frameRequests[player]; !ok {
+		// Only accept the first shot request.
+		g.frameRequests[player] = req
+	}
+	submitted := len(g.frameRequests)
+	g.lock.Unlock()
+
+	if g.clock != nil && g.clock.Stop(player) {
+		mw.WriteMessage(comms.NewEvent("clock:update", g.clock.State()))
+	}
+	if submitted == len(g.shooters()) {
+		// All players has submitted their shot.
+		g.resolveFrame(mw)
+	}
+}
+
+// readShots reads the coordinates of the shot request. The data is a
+// coordinate, or a list of coordinates in the Salvo variant.
+func (g *Game) readShots(req comms.Request) (shots [][2]int, err error) {
+	if g.variant == game.VariantSalvo {
+		err = req.ReadDataTo(&shots)
+		return
+	}
+	var shot [2]int
+	if err = req.ReadDataTo(&shot); err != nil {
+		return nil, err
+	}
+	return [][2]int{shot}, nil
+}
+
+// validateShot reads the coordinates of the shot request, and checks the
+// player has not shot at them. In the Salvo variant, the player must
+// shoot once for each ship afloat, or at all the cells left if less.
+func (g *Game) validateShot(player string, req comms.Request) (shots [][2]int, err error) {
+	if shots, err = g.readShots(req); err != nil {
+		return nil, fmt.Errorf("invalid shot: %s", err)
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if _, ok := g.frameRequests[player]; ok {
+		return nil, fmt.Errorf("already shot in frame %d", g.frame)
+	}
+	state := g.playerState[g.GetPlayerSession(player)]
+	if g.variant == game.VariantSalvo {
+		unknown := 0
+		for x := range state.OpponentBoard {
+			for y := range state.OpponentBoard[x] {
+				if state.OpponentBoard[x][y] == game.BoardCellStateUnknown {
+					unknown++
+				}
+			}
+		}
+		if want := min(state.ShipsLeft(), unknown); len(shots) != want {
+			return nil, fmt.Errorf("expected %d shots in salvo, got %d", want, len(shots))
+		}
+	}
+
+	seen := make(map[[2]int]bool, len(shots))
+	for _, shot := range shots {
+		if !g.rules.InBounds(shot) {
+			return nil, fmt.Errorf("shot out of board: %v", shot)
+		}
+		if seen[shot] {
+			return nil, fmt.Errorf("duplicated shot: %v", shot)
+		}
+		seen[shot] = true
+		if state.OpponentBoard[shot[0]][shot[1]] != game.BoardCellStateUnknown {
+			return nil, fmt.Errorf("cell already shot: %v", shot)
+		}
+	}
+	return shots, nil
+}
+
+// resolveFrame applies the shots of the frame to the boards of the
+// opponents, answers each shot with its result, and starts the next
+// frame. Caller should hold the handling lock.
+func (g *Game) resolveFrame(mw comms.MessageWriter) {
+	responses := make([]comms.Message, 0, 2)
+	hit := false
+
+	g.lock.Lock()
+	for _, pair := range [][2]*comms.Session{{g.player1, g.player2}, {g.player2, g.player1}} {
+		shooter, target := pair[0], pair[1]
+		req, ok := g.frameRequests[shooter.ID()]
+		if !ok || req.RequestType() != "shot" {
+			// Not in turn, or skipped.
+			continue
+		}
+		shots, err := g.readShots(req)
+		if err != nil {
+			log.Printf("error reading shots of %s: %s", shooter.ID(), err)
+			continue
+		}
+
+		targetState := g.playerState[target]
+		shooterState := g.playerState[shooter]
+		results := make([]game.ShotResult, 0, len(shots))
+		for _, shot := range shots {
+			result, err := targetState.ReceiveShot(shot[0], shot[1])
+			if err != nil {
+				log.Printf("error resolving shot of %s at %v: %s", shooter.ID(), shot, err)
+				continue
+			}
+			if g.rules.NoReveal {
+				result = result.Concealed()
+			}
+			shooterState.OpponentBoard[shot[0]][shot[1]] = result.State
+			for _, c := range result.Coordinates {
+				shooterState.OpponentBoard[c[0]][c[1]] = game.BoardCellStateSunk
+			}
+			results = append(results, game.ShotResult{
+				Frame:           g.frame,
+				Coordinate:      shot,
+				State:           result.State,
+				Ship:            result.Ship,
+				ShipCoordinates: result.Coordinates,
+			})
+			hit = hit || result.State != game.BoardCellStateMiss
+		}
+		g.playerState[target] = targetState
+		g.playerState[shooter] = shooterState
+
+		if req.RequestID() != "" {
+			var data interface{} = results
+			if g.variant != game.VariantSalvo && len(results) == 1 {
+				data = results[0]
+			}
+			responses = append(responses, comms.NewResponse(
+				shooter.ID(),
+				req.RequestID(),
+				req.RequestType(),
+				200,
+				"success",
+				data,
+			))
+		}
+	}
+	g.frame++
+	g.frameRequests = make(map[string]comms.Request)
+	if g.turnMode == game.TurnModeAlternating && !(hit && g.extraShot) {
+		// Pass the turn to the opponent.
+		if g.turn == g.player1.ID() {
+			g.turn = g.player2.ID()
+		} else {
+			g.turn = g.player1.ID()
+		}
+	}
+	g.lock.Unlock()
+
+	for _, resp := range responses {
+		mw.WriteMessage(resp)
+	}
+	mw.WriteMessage(g.frameUpdate())
+
+	// The game ends when a fleet is sunk. It is a draw if both
+	// fleets are sunk in the same frame.
+	g.lock.Lock()
+	state1, state2 := g.playerState[g.player1], g.playerState[g.player2]
+	g.lock.Unlock()
+	sunk1, sunk2 := state1.IsAllShipsSunk(), state2.IsAllShipsSunk()
+	switch {
+	case sunk1 && sunk2:
+		g.endGame("", ReasonFleetSunk, mw)
+	case sunk1:
+		g.endGame(g.player2.ID(), ReasonFleetSunk, mw)
+	case sunk2:
+		g.endGame(g.player1.ID(), ReasonFleetSunk, mw)
+	default:
+		g.startTurn(mw)
+		g.restartClock(mw)
+	}
+}
+
+// setupError returns the error response to a setup request. The data of
+// the response is the game.ValidationError, if the placement breaks a
+// rule.
+func setupError(sessionID string, req comms.Request, err error) comms.Message {
+	var verr *game.ValidationError
+	if errors.As(err, &verr) {
+		return comms.NewErrorResponseWithData(sessionID, req.RequestID(), 400, "error", err.Error(), verr)
+	}
+	return comms.NewErrorResponse(sessionID, req.RequestID(), 400, "error", err.Error())
+}
+
+func (g *Game) HandleMessage(ctx context.Context, min comms.Message, mw comms.MessageWriter) error {
+	g.handling.Lock()
+	defer g.handling.Unlock()
+
+	if min.Type() != "request" {
+		return fmt.Errorf("invalid request type: %v", min.Type())
+	}
+	// log.Printf("received message: %s, game stage: %s", min, g.stage)
+
+	// Resolve context variables.
+	sc := comms.GetSessionCollection(ctx)
+	sessionID := comms.GetSessionID(ctx)
+
+	if min.Type() == "signal" {
+		// Ignore signal for now.
+		return nil
+	}
+
+	// Spectators can subscribe in any stage, but cannot play.
+	switch req := min.(comms.Request); req.RequestType() {
+	case "subscribe":
+		return g.subscribe(sc, sessionID, req, mw)
+	case "join", "setup", "shot":
+		if g.IsSpectatorSession(sessionID) {
+			return mw.WriteMessage(comms.NewErrorResponse(
+				sessionID,
+				req.RequestID(),
+				403,
+				"error",
+				"forbidden",
+			))
+		}
+	}
+
+	switch g.stage {
+	case game.GameStageWaiting:
+
+		req := min.(comms.Request)
+		switch req.RequestType() {
+		case "join":
+			// TODO: more sophisticated player joinning request / response.
+			if g.player1 == nil && sc.Has(sessionID) {
+				if g.player2 != nil && g.player2.ID() == sessionID {
+					// player 1 cannot join again.
+					// ignore for now.
+					return nil
+				}
+
+				log.Printf("adding session as player 1: %s", sessionID)
+				g.lock.Lock()
+				g.player1 = sc.Get(sessionID)
+				g.lock.Unlock()
+
+				resp := comms.NewResponse(
+					sessionID,
+					req.RequestID(),
+					req.RequestType(),
+					200,
+					"success",
+					"player1",
+				)
+
+				err := mw.WriteMessage(resp)
+				if err != nil {
+					log.Printf("error sending response message: %s", err)
+					g.lock.Lock()
+					g.player1 = nil // unset player1
+					g.lock.Unlock()
+					return err
+				}
+
+				log.Printf("response send to player 1: %s", resp)
+			} else if g.player2 == nil && sc.Has(sessionID) {
+				if g.player1 != nil && g.player1.ID() == sessionID {
+					// player 1 cannot join again.
+					// ignore for now.
+					return nil
+				}
+				log.Printf("adding session as player 2: %s", sessionID)
+				g.lock.Lock()
+				g.player2 = sc.Get(sessionID)
+				g.lock.Unlock()
+
+				resp := comms.NewResponse(
+					sessionID,
+					req.RequestID(),
+					req.RequestType(),
+					200,
+					"success",
+					"player2",
+				)
+
+				err := mw.WriteMessage(resp)
+				if err != nil {
+					log.Printf("error sending response message: %s", err)
+					g.lock.Lock()
+					g.player2 = nil // unset player1
+					g.lock.Unlock()
+					return err
+				}
+
+				log.Printf("response send to player 2: %s", resp)
+			}
+
+			// After both player has joinned and all setup done
+			// start accepting game setup request.
+			if g.player1 != nil && g.player2 != nil {
+				log.Print("move on to setup stage")
+				g.lock.Lock()
+				g.stage = game.GameStageSetup
+				g.lock.Unlock()
+				mw.WriteMessage(comms.NewEvent("game:rules", g.rules))
+				mw.WriteMessage(comms.NewEvent("stage:change", game.GameStageSetup))
+			}
+		}
+
+	case game.GameStageSetup:
+		req := min.(comms.Request)
+		if req.RequestType() != "setup" {
+			return fmt.Errorf("invalid request type: %v", req.RequestType())
+		}
+
+		// Only allow player to setup their own ships.
+		s := g.GetPlayerSession(comms.GetSessionID(ctx))
+		if s == nil {
+			mw.WriteMessage(comms.NewErrorResponse(
+				sessionID,
+				req.RequestID(),
+				403,
+				"error",
+				"forbidden",
+			))
+			return nil
+		}
+
+		// Each player can only setup once.
+		if _, ok := g.playerState[s]; ok {
+			mw.WriteMessage(comms.NewErrorResponse(
+				sessionID,
+				req.RequestID(),
+				400,
+				"error",
+				"state already set",
+			))
+			return nil
+		}
+
+		// Place the ships at random if the data is null.
+		var raw json.RawMessage
+		req.ReadDataTo(&raw)
+		auto := len(raw) == 0 || string(raw) == "null"
+		ships := make([]game.ShipPlacement, 0, g.rules.FleetSize())
+		if auto {
+			var err error
+			if ships, err = game.RandomPlacement(g.rules, g.rng, game.PlacementOptions{}); err != nil {
+				return mw.WriteMessage(setupError(sessionID, req, err))
+			}
+		} else if err := json.Unmarshal(raw, &ships); err != nil {
+			return mw.WriteMessage(setupError(sessionID, req, fmt.Errorf("invalid setup: %s", err)))
+		}
+
+		// Validate the ship placements.
+		shipStates := make(game.ShipStates, len(ships))
+		for i, sp := range ships {
+			ss, err := g.rules.NewShipState(sp.ID, sp.Coordinate, sp.Direction)
+			if err != nil {
+				return mw.WriteMessage(setupError(sessionID, req, err))
+			}
+			shipStates[i] = *ss
+		}
+
+		if err := g.rules.ValidateFleet(shipStates); err != nil {
+			return mw.WriteMessage(setupError(sessionID, req, err))
+		}
+
+		log.Printf("accepted setup: %v", shipStates)
+		g.playerState[s] = g.rules.NewPlayerState(shipStates)
+		if auto {
+			// Tell the player where the ships are.
+			mw.WriteMessage(comms.NewResponse(
+				sessionID,
+				req.RequestID(),
+				req.RequestType(),
+				200,
+				"success",
+				ships,
+			))
+		}
+
+		if len(g.playerState) == 2 {
+
+			// Change the game stage to playing. Player 1 shoots
+			// first in alternating turn mode.
+			g.lock.Lock()
+			g.stage = game.GameStagePlaying
+			if g.turnMode == game.TurnModeAlternating {
+				g.turn = g.player1.ID()
+			}
+			g.lock.Unlock()
+
+			// Announce stage change
+			mw.WriteMessage(comms.NewEvent(
+				"stage:change",
+				game.GameStagePlaying,
+			))
+
+			// Resolve initial frame (frame 0)
+			mw.WriteMessage(g.frameUpdate())
+			g.startTurn(mw)
+			g.startClock(mw)
+		}
+
+	case game.GameStageEnded:
+		// Refuse to play after the game ended.
+		if req := min.(comms.Request); req.RequestType() == "shot" {
+			return mw.WriteMessage(comms.NewErrorResponse(
+				sessionID,
+				req.RequestID(),
+				400,
+				"error",
+				"game ended",
+			))
+		}
+
+	case game.GameStagePlaying:
+		req := min.(comms.Request)
+		switch req.RequestType() {
+		case "shot":
+			// Only allow players to shoot.
+			if !g.IsPlayerSession(sessionID) {
+				mw.WriteMessage(comms.NewErrorResponse(
+					sessionID,
+					req.RequestID(),
+					403,
+					"error",
+					"forbidden",
+				))
+				return nil
+			}
+
+			if g.turnMode == game.TurnModeAlternating && g.publicState().Turn != sessionID {
+				return mw.WriteMessage(comms.NewErrorResponse(
+					sessionID,
+					req.RequestID(),
+					409,
+					"error",
+					"not your turn",
+				))
+			}
+			if _, err := g.validateShot(sessionID, req); err != nil {
+				return mw.WriteMessage(comms.NewErrorResponse(
+					sessionID,
+					req.RequestID(),
+					400,
+					"error",
+					err.Error(),
+				))
+			}
+			g.submitMove(sessionID, req, mw)
+		}
+	}
+	return nil
+}
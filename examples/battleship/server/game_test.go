@@ -0,0 +1,697 @@
+package server_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/yookoala/botgame-playground/comms"
+	"github.com/yookoala/botgame-playground/comms/commstest"
+	"github.com/yookoala/botgame-playground/examples/battleship/game"
+	"github.com/yookoala/botgame-playground/examples/battleship/server"
+	"github.com/yookoala/botgame-playground/gameclock"
+	"github.com/yookoala/botgame-playground/ratings"
+)
+
+// testShips returns a valid fleet placement.
+func testShips() []*game.ShipPlacement {
+	ships := make([]*game.ShipPlacement, 5)
+	ships[0], _ = game.NewShipPlacement(game.ShipIDCarrier, [2]int{0, 0}, game.ShipDirectionToRight)
+	ships[1], _ = game.NewShipPlacement(game.ShipIDBattleship, [2]int{0, 1}, game.ShipDirectionToRight)
+	ships[2], _ = game.NewShipPlacement(game.ShipIDCruiser, [2]int{0, 2}, game.ShipDirectionToRight)
+	ships[3], _ = game.NewShipPlacement(game.ShipIDSubmarine, [2]int{0, 3}, game.ShipDirectionToRight)
+	ships[4], _ = game.NewShipPlacement(game.ShipIDDestroyer, [2]int{0, 4}, game.ShipDirectionToRight)
+	return ships
+}
+
+func TestGame_Spectator(t *testing.T) {
+	h := commstest.NewHarness(t, server.NewGame())
+	p1, p2, spectator := h.Connect(), h.Connect(), h.Connect()
+
+	var state server.PublicState
+	spectator.ExpectResponseCode(spectator.Request("subscribe", nil), 200).ReadDataTo(&state)
+	if want, have := game.GameStageWaiting, state.Stage; want != have {
+		t.Errorf("unexpected stage. want %s, have %s", want, have)
+	}
+	spectator.ExpectResponseCode(spectator.Request("join", nil), 403)
+
+	p1.ExpectResponseCode(p1.Request("join", nil), 200)
+	p1.ExpectResponseCode(p1.Request("subscribe", nil), 400)
+	p2.ExpectResponseCode(p2.Request("join", nil), 200)
+
+	// Spectators get public events.
+	var stage game.GameStage
+	spectator.ExpectEvent("stage:change").ReadDataTo(&stage)
+	if want, have := game.GameStageSetup, stage; want != have {
+		t.Errorf("unexpected stage. want %s, have %s", want, have)
+	}
+
+	// Spectators can subscribe in any stage.
+	spectator.ExpectResponseCode(spectator.Request("subscribe", nil), 200).ReadDataTo(&state)
+	if want, have := game.GameStageSetup, state.Stage; want != have {
+		t.Errorf("unexpected stage. want %s, have %s", want, have)
+	}
+	if want, have := []string{p1.ID(), p2.ID()}, state.Players; len(have) != 2 || want[0] != have[0] || want[1] != have[1] {
+		t.Errorf("unexpected players. want %#v, have %#v", want, have)
+	}
+	spectator.ExpectResponseCode(spectator.Request("setup", testShips()), 403)
+
+	p1.Request("setup", testShips())
+	p2.Request("setup", testShips())
+	var view game.FrameView
+	spectator.ExpectEvent("frame:update").ReadDataTo(&view)
+	for _, b := range view.Boards {
+		if len(b.Ships) != 0 {
+			t.Errorf("unexpected ships of %s shown to spectator: %v", b.Player, b.Ships)
+		}
+	}
+	spectator.ExpectResponseCode(spectator.Request("shot", [2]int{0, 0}), 403)
+}
+
+func TestGame_FrameUpdate(t *testing.T) {
+	h := commstest.NewHarness(t, server.NewGame())
+	p1, p2 := h.Connect(), h.Connect()
+	p1.ExpectResponseCode(p1.Request("join", nil), 200)
+	p2.ExpectResponseCode(p2.Request("join", nil), 200)
+	p1.Request("setup", testShips())
+	p2.Request("setup", testShips())
+
+	// Each player sees its own ships, but not the ships of the opponent.
+	for _, p := range []*commstest.FakeClient{p1, p2} {
+		var view game.FrameView
+		p.ExpectEvent("frame:update").ReadDataTo(&view)
+		if want, have := 2, len(view.Boards); want != have {
+			t.Fatalf("unexpected number of boards. want %d, have %d", want, have)
+		}
+		for _, b := range view.Boards {
+			want := 0
+			if b.Player == p.ID() {
+				want = 5
+			}
+			if have := len(b.Ships); want != have {
+				t.Errorf("[%s] unexpected number of ships of %s. want %d, have %d", p.ID(), b.Player, want, have)
+			}
+		}
+	}
+}
+
+func TestGame_InspectEnd(t *testing.T) {
+	g := server.NewGame()
+	h := commstest.NewHarness(t, g)
+	p1, p2, spectator := h.Connect(), h.Connect(), h.Connect()
+	p1.ExpectResponseCode(p1.Request("join", nil), 200)
+	p2.ExpectResponseCode(p2.Request("join", nil), 200)
+	spectator.ExpectResponseCode(spectator.Request("subscribe", nil), 200)
+	p1.Request("setup", testShips())
+	p2.Request("setup", testShips())
+	p1.ExpectEvent("frame:update")
+
+	// Administrators see all ships.
+	fs := g.Inspect().(server.FullState)
+	if want, have := game.GameStagePlaying, fs.Stage; want != have {
+		t.Errorf("unexpected stage. want %s, have %s", want, have)
+	}
+	if want, have := 2, len(fs.Boards); want != have {
+		t.Fatalf("unexpected number of boards. want %d, have %d", want, have)
+	}
+	if want, have := 5, len(fs.Boards[0].Ships); want != have {
+		t.Errorf("unexpected number of ships. want %d, have %d", want, have)
+	}
+	if want, have := []string{p1.ID(), p2.ID()}, fs.Ready; len(have) != 2 || want[0] != have[0] || want[1] != have[1] {
+		t.Errorf("unexpected ready players. want %#v, have %#v", want, have)
+	}
+	if want, have := []string{spectator.ID()}, fs.Spectators; len(have) != 1 || want[0] != have[0] {
+		t.Errorf("unexpected spectators. want %#v, have %#v", want, have)
+	}
+
+	if err := g.EndGame(spectator.ID(), h.Broker); err == nil {
+		t.Errorf("expected error declaring spectator as winner")
+	}
+	if err := g.EndGame(p2.ID(), h.Broker); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var res ratings.GameResult
+	spectator.ExpectEvent("game:result").ReadDataTo(&res)
+	if want, have := p2.ID(), res.Winner; want != have {
+		t.Errorf("unexpected winner. want %#v, have %#v", want, have)
+	}
+	if want, have := 2, len(res.Players); want != have {
+		t.Errorf("unexpected number of players. want %d, have %d", want, have)
+	}
+	if err := g.EndGame("", h.Broker); err == nil {
+		t.Errorf("expected error ending an ended game")
+	}
+}
+
+func TestGame_TimeControl(t *testing.T) {
+	clock := gameclock.NewFakeClock(time.Unix(0, 0))
+	g := server.NewGame().TimeControl(clock, gameclock.Config{
+		MoveTime: time.Second,
+		Timeout:  gameclock.ActionForfeit,
+	})
+	h := commstest.NewHarness(t, g)
+	p1, p2 := h.Connect(), h.Connect()
+	p1.ExpectResponseCode(p1.Request("join", nil), 200)
+	p2.ExpectResponseCode(p2.Request("join", nil), 200)
+	p1.Request("setup", testShips())
+	p2.Request("setup", testShips())
+
+	var state gameclock.State
+	p1.ExpectEvent("clock:update").ReadDataTo(&state)
+	if want, have := 2, len(state.Players); want != have {
+		t.Fatalf("unexpected number of clocks. want %d, have %d", want, have)
+	}
+	for _, pc := range state.Players {
+		if !pc.Running || pc.Remaining != 1000 {
+			t.Errorf("unexpected clock of %s: %#v", pc.Player, pc)
+		}
+	}
+
+	// Player 1 shoots in time, player 2 does not.
+	p1.Request("shot", [2]int{0, 0})
+	p1.ExpectEvent("clock:update").ReadDataTo(&state)
+	if state.Players[0].Running || !state.Players[1].Running {
+		t.Errorf("unexpected clocks: %#v", state.Players)
+	}
+	clock.Advance(time.Second)
+
+	p2.ExpectEvent("clock:timeout")
+	var res ratings.GameResult
+	p2.ExpectEvent("game:result").ReadDataTo(&res)
+	if want, have := p1.ID(), res.Winner; want != have {
+		t.Errorf("unexpected winner. want %#v, have %#v", want, have)
+	}
+	if want, have := game.GameStageEnded, g.Inspect().(server.FullState).Stage; want != have {
+		t.Errorf("unexpected stage. want %s, have %s", want, have)
+	}
+}
+
+func TestGame_PauseClock(t *testing.T) {
+	clock := gameclock.NewFakeClock(time.Unix(0, 0))
+	rm := comms.NewRoomManager().Register("battleship", 2, func() comms.MessageHandler {
+		return server.NewGame().TimeControl(clock, gameclock.Config{
+			MoveTime: time.Second,
+			Timeout:  gameclock.ActionForfeit,
+		})
+	})
+	h := commstest.NewHarness(t, rm)
+	p1, p2 := h.Connect(), h.Connect()
+	for _, p := range []*commstest.FakeClient{p1, p2} {
+		p.ExpectResponseCode(p.Request("room:join", nil), 200)
+		p.ExpectResponseCode(p.Request("join", nil), 200)
+	}
+	p1.Request("setup", testShips())
+	p2.Request("setup", testShips())
+	p1.ExpectEvent("frame:update")
+	p1.ExpectEvent("clock:update")
+
+	// No player times out while the room is paused.
+	room := rm.RoomOf(p1.ID())
+	if err := room.Pause(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var state gameclock.State
+	p1.ExpectEvent("clock:update").ReadDataTo(&state)
+	if !state.Paused {
+		t.Errorf("expected clocks to be paused")
+	}
+	p1.ExpectEvent("game:pause")
+	p1.Request("shot", [2]int{0, 0})
+	clock.Advance(time.Hour)
+	if want, have := game.GameStagePlaying, room.Handler().(*server.Game).Inspect().(server.FullState).Stage; want != have {
+		t.Fatalf("unexpected stage. want %s, have %s", want, have)
+	}
+
+	// The shot held is made after resume, within the time left.
+	if err := room.Resume(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	p1.ExpectEvent("game:resume")
+	p2.Request("shot", [2]int{0, 0})
+	p1.ExpectEvent("frame:update")
+	if want, have := game.GameStagePlaying, room.Handler().(*server.Game).Inspect().(server.FullState).Stage; want != have {
+		t.Errorf("unexpected stage. want %s, have %s", want, have)
+	}
+
+	// The clocks run again for the next frame.
+	deadline := time.Now().Add(time.Second)
+	for clock.Pending() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for clocks of the next frame")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	p1.ExpectEvent("clock:timeout")
+}
+
+func TestGame_Leave(t *testing.T) {
+	rm := comms.NewRoomManager().Register("battleship", 2, func() comms.MessageHandler {
+		return server.NewGame()
+	})
+	h := commstest.NewHarness(t, rm)
+	p1, p2 := h.Connect(), h.Connect()
+	for _, p := range []*commstest.FakeClient{p1, p2} {
+		p.ExpectResponseCode(p.Request("room:join", nil), 200)
+		p.ExpectResponseCode(p.Request("join", nil), 200)
+	}
+	p1.Request("setup", testShips())
+	p2.Request("setup", testShips())
+	p2.ExpectEvent("frame:update")
+
+	// Player 1 disconnects, and forfeits.
+	p1.Close()
+	var res server.Result
+	p2.ExpectEvent("game:result").ReadDataTo(&res)
+	if want, have := p2.ID(), res.Winner; want != have {
+		t.Errorf("unexpected winner. want %#v, have %#v", want, have)
+	}
+	if want, have := server.ReasonForfeit, res.Reason; want != have {
+		t.Errorf("unexpected reason. want %#v, have %#v", want, have)
+	}
+}
+
+func TestGame_ShotResolution(t *testing.T) {
+	h := commstest.NewHarness(t, server.NewGame())
+	p1, p2 := h.Connect(), h.Connect()
+	p1.ExpectResponseCode(p1.Request("join", nil), 200)
+	p2.ExpectResponseCode(p2.Request("join", nil), 200)
+	p1.Request("setup", testShips())
+	p2.Request("setup", testShips())
+	p1.ExpectEvent("frame:update")
+	p2.ExpectEvent("frame:update")
+
+	p1.ExpectResponseCode(p1.Request("shot", [2]int{10, 0}), 400)
+	shot1 := p1.Request("shot", [2]int{0, 4})
+	p1.ExpectResponseCode(p1.Request("shot", [2]int{1, 4}), 400)
+	shot2 := p2.Request("shot", [2]int{9, 9})
+
+	var res game.ShotResult
+	p1.ExpectResponseCode(shot1, 200).ReadDataTo(&res)
+	if want, have := game.BoardCellStateHit, res.State; want != have {
+		t.Errorf("unexpected result of player 1. want %s, have %s", want, have)
+	}
+	p2.ExpectResponseCode(shot2, 200).ReadDataTo(&res)
+	if want, have := game.BoardCellStateMiss, res.State; want != have {
+		t.Errorf("unexpected result of player 2. want %s, have %s", want, have)
+	}
+
+	var view game.FrameView
+	p1.ExpectEvent("frame:update").ReadDataTo(&view)
+	p2.ExpectEvent("frame:update")
+	if want, have := 1, view.Frame; want != have {
+		t.Errorf("unexpected frame. want %d, have %d", want, have)
+	}
+	if want, have := game.BoardCellStateHit, view.Boards[1].Cells[0][4]; want != have {
+		t.Errorf("unexpected cell on board of player 2. want %s, have %s", want, have)
+	}
+
+	// Cannot shoot the same cell twice.
+	p1.ExpectResponseCode(p1.Request("shot", [2]int{0, 4}), 400)
+
+	shot1 = p1.Request("shot", [2]int{1, 4})
+	p2.Request("shot", [2]int{9, 8})
+	p1.ExpectResponseCode(shot1, 200).ReadDataTo(&res)
+	if want, have := game.BoardCellStateSunk, res.State; want != have {
+		t.Errorf("unexpected result of player 1. want %s, have %s", want, have)
+	}
+
+	// Sunk ships of the opponent are revealed.
+	p1.ExpectEvent("frame:update").ReadDataTo(&view)
+	if want, have := 1, len(view.Boards[1].Ships); want != have {
+		t.Fatalf("unexpected number of ships of player 2 shown. want %d, have %d", want, have)
+	}
+	if want, have := game.ShipIDDestroyer, view.Boards[1].Ships[0].ID; want != have {
+		t.Errorf("unexpected ship shown. want %v, have %v", want, have)
+	}
+}
+
+// fleetCells returns the cells of the fleet of testShips.
+func fleetCells() [][2]int {
+	cells := make([][2]int, 0, 17)
+	for y, size := range []int{5, 4, 3, 3, 2} {
+		for x := 0; x < size; x++ {
+			cells = append(cells, [2]int{x, y})
+		}
+	}
+	return cells
+}
+
+// startPlaying starts a game of 2 players with testShips.
+func startPlaying(t *testing.T) (p1, p2 *commstest.FakeClient) {
+	h := commstest.NewHarness(t, server.NewGame())
+	p1, p2 = h.Connect(), h.Connect()
+	p1.ExpectResponseCode(p1.Request("join", nil), 200)
+	p2.ExpectResponseCode(p2.Request("join", nil), 200)
+	p1.Request("setup", testShips())
+	p2.Request("setup", testShips())
+	p1.ExpectEvent("frame:update")
+	p2.ExpectEvent("frame:update")
+	return
+}
+
+// playFrames plays a frame for each pair of shots.
+func playFrames(p1, p2 *commstest.FakeClient, shots1, shots2 [][2]int) {
+	for i := range shots1 {
+		r1, r2 := p1.Request("shot", shots1[i]), p2.Request("shot", shots2[i])
+		p1.ExpectResponseCode(r1, 200)
+		p2.ExpectResponseCode(r2, 200)
+		p1.ExpectEvent("frame:update")
+		p2.ExpectEvent("frame:update")
+	}
+}
+
+func TestGame_Result(t *testing.T) {
+	p1, p2 := startPlaying(t)
+
+	// Player 1 sinks the fleet of player 2, while player 2 misses.
+	misses := make([][2]int, 0, 17)
+	for i := 0; i < 17; i++ {
+		misses = append(misses, [2]int{5 + i%5, i / 5})
+	}
+	playFrames(p1, p2, fleetCells(), misses)
+
+	var res server.Result
+	p2.ExpectEvent("game:result").ReadDataTo(&res)
+	if want, have := p1.ID(), res.Winner; want != have {
+		t.Errorf("unexpected winner. want %#v, have %#v", want, have)
+	}
+	if want, have := 17, res.Frames; want != have {
+		t.Errorf("unexpected frames. want %d, have %d", want, have)
+	}
+	if want, have := server.ReasonFleetSunk, res.Reason; want != have {
+		t.Errorf("unexpected reason. want %#v, have %#v", want, have)
+	}
+	want := []server.PlayerStats{
+		{Player: p1.ID(), Shots: 17, Hits: 17, ShipsSunk: 5, ShipsLeft: 5},
+		{Player: p2.ID(), Shots: 17, Misses: 17, ShipsSunk: 0, ShipsLeft: 0},
+	}
+	if len(res.Stats) != 2 || want[0] != res.Stats[0] || want[1] != res.Stats[1] {
+		t.Errorf("unexpected stats.\nwant %#v\nhave %#v", want, res.Stats)
+	}
+
+	// No more shots after the game ended.
+	p1.ExpectResponseCode(p1.Request("shot", [2]int{9, 9}), 400)
+}
+
+func TestGame_ResultDraw(t *testing.T) {
+	p1, p2 := startPlaying(t)
+	playFrames(p1, p2, fleetCells(), fleetCells())
+
+	var res server.Result
+	p1.ExpectEvent("game:result").ReadDataTo(&res)
+	if want, have := "", res.Winner; want != have {
+		t.Errorf("unexpected winner. want %#v, have %#v", want, have)
+	}
+	if want, have := []string{p1.ID(), p2.ID()}, res.Players; len(have) != 2 || want[0] != have[0] || want[1] != have[1] {
+		t.Errorf("unexpected players. want %#v, have %#v", want, have)
+	}
+}
+
+func TestGame_AlternatingTurns(t *testing.T) {
+	h := commstest.NewHarness(t, server.NewGame().Turns(game.TurnModeAlternating, true))
+	p1, p2 := h.Connect(), h.Connect()
+	p1.ExpectResponseCode(p1.Request("join", nil), 200)
+	p2.ExpectResponseCode(p2.Request("join", nil), 200)
+	p1.Request("setup", testShips())
+	p2.Request("setup", testShips())
+
+	var view game.FrameView
+	p2.ExpectEvent("frame:update").ReadDataTo(&view)
+	if want, have := p1.ID(), view.Turn; want != have {
+		t.Errorf("unexpected turn. want %#v, have %#v", want, have)
+	}
+	var turn game.Turn
+	p1.ExpectEvent("frame:update")
+	p1.ExpectEvent("turn:start").ReadDataTo(&turn)
+	if want, have := p1.ID(), turn.Player; want != have {
+		t.Errorf("unexpected turn. want %#v, have %#v", want, have)
+	}
+
+	// Shots out of turn are refused.
+	p2.ExpectResponseCode(p2.Request("shot", [2]int{0, 0}), 409)
+
+	// Player 1 hits and shoots again.
+	p1.ExpectResponseCode(p1.Request("shot", [2]int{0, 0}), 200)
+	p1.ExpectEvent("frame:update").ReadDataTo(&view)
+	p1.ExpectEvent("turn:start").ReadDataTo(&turn)
+	if want, have := p1.ID(), turn.Player; want != have {
+		t.Errorf("unexpected turn. want %#v, have %#v", want, have)
+	}
+	if want, have := 1, turn.Frame; want != have {
+		t.Errorf("unexpected frame. want %d, have %d", want, have)
+	}
+
+	// Player 1 misses, and it is the turn of player 2.
+	p1.ExpectResponseCode(p1.Request("shot", [2]int{9, 9}), 200)
+	p1.ExpectEvent("frame:update").ReadDataTo(&view)
+	if want, have := p2.ID(), view.Turn; want != have {
+		t.Errorf("unexpected turn. want %#v, have %#v", want, have)
+	}
+	p2.ExpectEvent("turn:start").ReadDataTo(&turn)
+	if want, have := p2.ID(), turn.Player; want != have {
+		t.Errorf("unexpected turn. want %#v, have %#v", want, have)
+	}
+	p1.ExpectResponseCode(p1.Request("shot", [2]int{9, 8}), 409)
+
+	// Turns are only sent to the active player.
+	evt := comms.NewEvent("turn:start", game.Turn{Player: p1.ID()}).(comms.Event)
+	if m := server.NewGame().ProjectEvent(evt, p2.ID()); m != nil {
+		t.Errorf("unexpected turn sent to player 2: %s", m)
+	}
+}
+
+func TestGame_Salvo(t *testing.T) {
+	h := commstest.NewHarness(t, server.NewGame().Variant(game.VariantSalvo))
+	p1, p2 := h.Connect(), h.Connect()
+	p1.ExpectResponseCode(p1.Request("join", nil), 200)
+	p2.ExpectResponseCode(p2.Request("join", nil), 200)
+	p1.Request("setup", testShips())
+	p2.Request("setup", testShips())
+	var view game.FrameView
+	p1.ExpectEvent("frame:update").ReadDataTo(&view)
+	if !view.Salvo {
+		t.Errorf("expected salvo in frame")
+	}
+
+	// One shot for each ship afloat, each at a different cell on board.
+	p1.ExpectResponseCode(p1.Request("shot", [][2]int{{0, 4}, {1, 4}, {9, 9}, {9, 8}}), 400)
+	p1.ExpectResponseCode(p1.Request("shot", [][2]int{{0, 4}, {1, 4}, {9, 9}, {9, 8}, {9, 8}}), 400)
+	p1.ExpectResponseCode(p1.Request("shot", [][2]int{{0, 4}, {1, 4}, {9, 9}, {9, 8}, {9, 10}}), 400)
+	p1.ExpectResponseCode(p1.Request("shot", [2]int{0, 4}), 400)
+
+	shot1 := p1.Request("shot", [][2]int{{0, 4}, {1, 4}, {9, 9}, {9, 8}, {9, 7}})
+	shot2 := p2.Request("shot", [][2]int{{9, 9}, {9, 8}, {9, 7}, {9, 6}, {9, 5}})
+	var results []game.ShotResult
+	p1.ExpectResponseCode(shot1, 200).ReadDataTo(&results)
+	want := []game.BoardCellState{
+		game.BoardCellStateHit,
+		game.BoardCellStateSunk,
+		game.BoardCellStateMiss,
+		game.BoardCellStateMiss,
+		game.BoardCellStateMiss,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("unexpected number of results. want %d, have %d", len(want), len(results))
+	}
+	for i, res := range results {
+		if want[i] != res.State {
+			t.Errorf("unexpected result %d. want %s, have %s", i, want[i], res.State)
+		}
+	}
+	p2.ExpectResponseCode(shot2, 200)
+
+	// Player 2 has 4 ships afloat.
+	p2.ExpectResponseCode(p2.Request("shot", [][2]int{{8, 9}, {8, 8}, {8, 7}, {8, 6}, {8, 5}}), 400)
+	shot2 = p2.Request("shot", [][2]int{{8, 9}, {8, 8}, {8, 7}, {8, 6}})
+	p1.Request("shot", [][2]int{{8, 9}, {8, 8}, {8, 7}, {8, 6}, {8, 5}})
+	p2.ExpectResponseCode(shot2, 200).ReadDataTo(&results)
+	if want, have := 4, len(results); want != have {
+		t.Errorf("unexpected number of results. want %d, have %d", want, have)
+	}
+}
+
+func TestGame_Rules(t *testing.T) {
+	rules := game.Rules{Width: 6, Height: 4, Fleet: []game.ShipType{
+		{ID: 1, Name: "Frigate", Size: 3, Count: 2},
+		{ID: 2, Name: "Patrol", Size: 1, Count: 1},
+	}}
+	h := commstest.NewHarness(t, server.NewGame().Rules(rules))
+	p1, p2 := h.Connect(), h.Connect()
+	p1.ExpectResponseCode(p1.Request("join", nil), 200)
+	p2.ExpectResponseCode(p2.Request("join", nil), 200)
+
+	// The rules are announced before setup.
+	var have game.Rules
+	p1.ExpectEvent("game:rules").ReadDataTo(&have)
+	if want := rules; want.Width != have.Width || want.Height != have.Height || len(have.Fleet) != 2 || want.Fleet[0] != have.Fleet[0] {
+		t.Errorf("unexpected rules. want %#v, have %#v", want, have)
+	}
+	p1.ExpectEvent("stage:change")
+
+	place := func(id game.ShipID, x, y int) *game.ShipPlacement {
+		sp, _ := game.NewShipPlacement(id, [2]int{x, y}, game.ShipDirectionToRight)
+		return sp
+	}
+	ships := []*game.ShipPlacement{place(1, 0, 0), place(1, 0, 2), place(2, 5, 3)}
+
+	// The classic fleet, or ships out of the board, are refused.
+	p1.ExpectResponseCode(p1.Request("setup", testShips()), 400)
+	p1.ExpectResponseCode(p1.Request("setup", []*game.ShipPlacement{place(1, 0, 0), place(1, 4, 2), place(2, 5, 3)}), 400)
+	p1.ExpectResponseCode(p1.Request("setup", ships[:2]), 400)
+
+	p1.Request("setup", ships)
+	p2.Request("setup", ships)
+	var view game.FrameView
+	p1.ExpectEvent("frame:update").ReadDataTo(&view)
+	if want, have := 6, len(view.Boards[0].Cells); want != have {
+		t.Errorf("unexpected board width. want %d, have %d", want, have)
+	}
+	p2.ExpectEvent("frame:update")
+
+	p1.ExpectResponseCode(p1.Request("shot", [2]int{6, 0}), 400)
+	shot1, shot2 := p1.Request("shot", [2]int{5, 3}), p2.Request("shot", [2]int{5, 0})
+	var res game.ShotResult
+	p1.ExpectResponseCode(shot1, 200).ReadDataTo(&res)
+	if want, have := game.BoardCellStateSunk, res.State; want != have {
+		t.Errorf("unexpected result. want %s, have %s", want, have)
+	}
+	p2.ExpectResponseCode(shot2, 200)
+}
+
+func TestGame_SetupValidationError(t *testing.T) {
+	rules := game.DefaultRules()
+	rules.NoTouch = true
+	h := commstest.NewHarness(t, server.NewGame().Rules(rules))
+	p1, p2 := h.Connect(), h.Connect()
+	p1.ExpectResponseCode(p1.Request("join", nil), 200)
+	p2.ExpectResponseCode(p2.Request("join", nil), 200)
+	p1.ExpectEvent("stage:change")
+
+	// The ships of testShips are in adjacent rows.
+	resp := p1.ExpectResponseCode(p1.Request("setup", testShips()), 400)
+	var verr game.ValidationError
+	if err := resp.ReadDataTo(&verr); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want, have := game.RuleNoTouch, verr.Rule; want != have {
+		t.Errorf("unexpected rule. want %q, have %q", want, have)
+	}
+	if want, have := game.ShipIDCarrier, verr.Ship; want != have {
+		t.Errorf("unexpected ship. want %s, have %s", want, have)
+	}
+	if verr.Coordinate == nil || *verr.Coordinate != [2]int{0, 1} {
+		t.Errorf("unexpected coordinate: %v", verr.Coordinate)
+	}
+	if want, have := verr.Message, resp.(comms.ErrorResponse).ErrorString(); want != have {
+		t.Errorf("unexpected error string. want %q, have %q", want, have)
+	}
+
+	// Every other row is fine.
+	ships := testShips()
+	for i, sp := range ships {
+		sp.Coordinate[1] = i * 2
+	}
+	p1.Request("setup", ships)
+	p2.Request("setup", ships)
+	p1.ExpectEvent("frame:update")
+}
+
+func TestGame_AutoPlacement(t *testing.T) {
+	rules := game.DefaultRules()
+	rules.NoTouch = true
+	h := commstest.NewHarness(t, server.NewGame().Rules(rules).RandomSource(rand.NewSource(1)))
+	p1, p2 := h.Connect(), h.Connect()
+	p1.ExpectResponseCode(p1.Request("join", nil), 200)
+	p2.ExpectResponseCode(p2.Request("join", nil), 200)
+	p1.ExpectResponseCode(p1.Request("setup", "ships"), 400)
+
+	// The ships are placed at random, and told to the player.
+	var ships []game.ShipPlacement
+	p1.ExpectResponseCode(p1.Request("setup", nil), 200).ReadDataTo(&ships)
+	states := make(game.ShipStates, 0, len(ships))
+	for _, sp := range ships {
+		s, err := rules.NewShipState(sp.ID, sp.Coordinate, sp.Direction)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		states = append(states, *s)
+	}
+	if err := rules.ValidateFleet(states); err != nil {
+		t.Errorf("invalid placement %v: %s", ships, err)
+	}
+
+	p2.ExpectResponseCode(p2.Request("setup", nil), 200)
+	var view game.FrameView
+	p1.ExpectEvent("frame:update").ReadDataTo(&view)
+	if want, have := len(ships), len(view.Boards[0].Ships); want != have {
+		t.Errorf("unexpected ships of player 1. want %d, have %d", want, have)
+	}
+}
+
+// sinkDestroyer starts a game of the rules, and player 1 sinks the
+// destroyer of player 2 in 2 frames. Returns the result of the sinking
+// shot, and the last frame seen by both players.
+func sinkDestroyer(t *testing.T, rules game.Rules) (res game.ShotResult, view1, view2 game.FrameView) {
+	h := commstest.NewHarness(t, server.NewGame().Rules(rules))
+	p1, p2 := h.Connect(), h.Connect()
+	p1.ExpectResponseCode(p1.Request("join", nil), 200)
+	p2.ExpectResponseCode(p2.Request("join", nil), 200)
+	p1.Request("setup", testShips())
+	p2.Request("setup", testShips())
+	p1.ExpectEvent("frame:update")
+	p2.ExpectEvent("frame:update")
+	playFrames(p1, p2, [][2]int{{0, 4}}, [][2]int{{9, 9}})
+
+	shot1 := p1.Request("shot", [2]int{1, 4})
+	p2.Request("shot", [2]int{9, 8})
+	p1.ExpectResponseCode(shot1, 200).ReadDataTo(&res)
+	p1.ExpectEvent("frame:update").ReadDataTo(&view1)
+	p2.ExpectEvent("frame:update").ReadDataTo(&view2)
+	return
+}
+
+func TestGame_SunkShip(t *testing.T) {
+	res, view1, view2 := sinkDestroyer(t, game.DefaultRules())
+	if want, have := game.BoardCellStateSunk, res.State; want != have {
+		t.Errorf("unexpected result. want %s, have %s", want, have)
+	}
+	if want, have := game.ShipIDDestroyer, res.Ship; want != have {
+		t.Errorf("unexpected ship sunk. want %s, have %s", want, have)
+	}
+	if want, have := [][2]int{{0, 4}, {1, 4}}, res.ShipCoordinates; len(have) != 2 || want[0] != have[0] || want[1] != have[1] {
+		t.Errorf("unexpected coordinates of ship sunk. want %v, have %v", want, have)
+	}
+
+	// All cells of the ship are sunk on the boards seen by both players.
+	for _, view := range []game.FrameView{view1, view2} {
+		for _, c := range res.ShipCoordinates {
+			if want, have := game.BoardCellStateSunk, view.Boards[1].Cells[c[0]][c[1]]; want != have {
+				t.Errorf("unexpected cell %v. want %s, have %s", c, want, have)
+			}
+		}
+	}
+}
+
+func TestGame_SunkShipNoReveal(t *testing.T) {
+	rules := game.DefaultRules()
+	rules.NoReveal = true
+	res, view1, view2 := sinkDestroyer(t, rules)
+	if want, have := game.BoardCellStateHit, res.State; want != have {
+		t.Errorf("unexpected result. want %s, have %s", want, have)
+	}
+	if res.Ship != game.ShipUndefined || res.ShipCoordinates != nil {
+		t.Errorf("unexpected ship sunk revealed: %v at %v", res.Ship, res.ShipCoordinates)
+	}
+
+	// The opponent sees no ship sunk, but the owner does.
+	if want, have := 0, len(view1.Boards[1].Ships); want != have {
+		t.Errorf("unexpected ships of player 2 shown. want %d, have %d", want, have)
+	}
+	if want, have := game.BoardCellStateHit, view1.Boards[1].Cells[0][4]; want != have {
+		t.Errorf("unexpected cell to player 1. want %s, have %s", want, have)
+	}
+	if want, have := game.BoardCellStateSunk, view2.Boards[1].Cells[0][4]; want != have {
+		t.Errorf("unexpected cell to player 2. want %s, have %s", want, have)
+	}
+}
@@ -0,0 +1,123 @@
+package gameclock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and schedules functions. The game clock runs on
+// a Clock so it can be tested with a FakeClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// AfterFunc calls f in its own goroutine after the duration.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a function scheduled by Clock.
+type Timer interface {
+	// Stop prevents the function from being called. Returns false if
+	// the function has been called or the timer has been stopped.
+	Stop() bool
+}
+
+type systemClock struct{}
+
+// SystemClock returns the Clock of the system time.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// FakeClock is a Clock that only moves with Advance.
+type FakeClock struct {
+	now    time.Time
+	timers []*fakeTimer
+	lock   *sync.Mutex
+}
+
+// NewFakeClock creates a new FakeClock starting at the time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:  now,
+		lock: &sync.Mutex{},
+	}
+}
+
+// Now implements Clock.
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// AfterFunc implements Clock. Unlike the system clock, f is called by
+// Advance in the goroutine of the caller.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by the duration, and calls the
+// functions due in the order of their time.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	end := c.now.Add(d)
+	c.lock.Unlock()
+
+	for {
+		c.lock.Lock()
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].when.Before(c.timers[j].when)
+		})
+		if len(c.timers) == 0 || c.timers[0].when.After(end) {
+			c.now = end
+			c.lock.Unlock()
+			return
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		c.lock.Unlock()
+		t.f()
+	}
+}
+
+// Pending returns the number of functions scheduled and not called.
+func (c *FakeClock) Pending() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.timers)
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	f     func()
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	for i, other := range t.clock.timers {
+		if other == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
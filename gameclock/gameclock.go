@@ -0,0 +1,341 @@
+// Package gameclock keeps the time of the players in turn-based games,
+// with per-move time limits and chess-style time banks.
+package gameclock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Action is what a game does to a player who runs out of time.
+type Action string
+
+// Timeout actions.
+const (
+	// ActionForfeit ends the game with the player losing.
+	ActionForfeit Action = "forfeit"
+
+	// ActionRandom makes a random legal move for the player.
+	ActionRandom Action = "random"
+
+	// ActionSkip skips the move of the player.
+	ActionSkip Action = "skip"
+)
+
+// ParseAction parses the name of a timeout action.
+func ParseAction(s string) (Action, error) {
+	switch a := Action(s); a {
+	case ActionForfeit, ActionRandom, ActionSkip:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown timeout action: %s", s)
+}
+
+// Config is the time control of a game.
+type Config struct {
+	// MoveTime is the time limit of each move. 0 for no limit.
+	MoveTime time.Duration
+
+	// Bank is the time bank of each player for all moves of the game.
+	// Time spent on a move is taken from the bank. 0 for no bank.
+	Bank time.Duration
+
+	// Increment is added to the bank after each move in time.
+	Increment time.Duration
+
+	// Timeout is the action when a player runs out of time.
+	Timeout Action
+}
+
+// Enabled reports if the config limits the time of players.
+func (c Config) Enabled() bool {
+	return c.MoveTime > 0 || c.Bank > 0
+}
+
+// PlayerClock is the clock of a player in State.
+type PlayerClock struct {
+	Player string `json:"player"`
+
+	// Running is true if the player is making a move.
+	Running bool `json:"running"`
+
+	// Remaining is the time left in milliseconds for the current move
+	// if running, or for the next move.
+	Remaining int64 `json:"remainingMs"`
+
+	// Bank is the time left in the bank in milliseconds. Omitted if
+	// there is no time bank.
+	Bank *int64 `json:"bankMs,omitempty"`
+}
+
+// State is the data of the "clock:update" event.
+type State struct {
+	Players []PlayerClock `json:"players"`
+
+	// Paused is true if the clocks are paused.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// player is the clock of a player.
+type player struct {
+	bank    time.Duration
+	started time.Time
+	running bool
+	timer   Timer
+
+	// moves counts the started moves and resumes, to tell stale
+	// timers.
+	moves int
+}
+
+// GameClock keeps the time of the players of a game. A player's clock
+// runs from Start until Stop. If the player does not stop the clock in
+// time, the timeout callbacks are called with the player.
+//
+// A move is in time if it is within MoveTime and the time left in the
+// bank. A player with an empty bank times out right after Start.
+//
+// The clocks can be paused, e.g. while the game is paused. No time is
+// spent from Pause until Resume.
+type GameClock struct {
+	clock     Clock
+	config    Config
+	order     []string
+	players   map[string]*player
+	onTimeout []func(player string)
+	lock      *sync.Mutex
+
+	paused   bool
+	pausedAt time.Time
+}
+
+// New creates a new GameClock of the players.
+func New(clock Clock, config Config, players ...string) *GameClock {
+	gc := &GameClock{
+		clock:   clock,
+		config:  config,
+		order:   players,
+		players: make(map[string]*player, len(players)),
+		lock:    &sync.Mutex{},
+	}
+	for _, p := range players {
+		gc.players[p] = &player{bank: config.Bank}
+	}
+	return gc
+}
+
+// Config returns the time control of the clock.
+func (gc *GameClock) Config() Config {
+	return gc.config
+}
+
+// OnTimeout adds a callback function to be called when a player runs
+// out of time. Callbacks are called in the goroutine of the Clock
+// timer, after the clock of the player is stopped.
+func (gc *GameClock) OnTimeout(f func(player string)) *GameClock {
+	gc.lock.Lock()
+	gc.onTimeout = append(gc.onTimeout, f)
+	gc.lock.Unlock()
+	return gc
+}
+
+// limit returns the time limit of the next move of the player.
+// Reports false for no limit. Caller should hold the lock.
+func (gc *GameClock) limit(p *player) (limit time.Duration, ok bool) {
+	if !gc.config.Enabled() {
+		return 0, false
+	}
+	if gc.config.Bank <= 0 {
+		return gc.config.MoveTime, true
+	}
+	limit = max(p.bank, 0)
+	if gc.config.MoveTime > 0 && gc.config.MoveTime < limit {
+		limit = gc.config.MoveTime
+	}
+	return limit, true
+}
+
+// now returns the current time of the clocks, which stands still while
+// paused. Caller should hold the lock.
+func (gc *GameClock) now() time.Time {
+	if gc.paused {
+		return gc.pausedAt
+	}
+	return gc.clock.Now()
+}
+
+// schedule schedules the timeout of the running clock of the player, if
+// there is a time limit and the clocks are not paused. Caller should
+// hold the lock.
+func (gc *GameClock) schedule(name string, p *player) {
+	limit, ok := gc.limit(p)
+	if !ok || gc.paused {
+		return
+	}
+	move := p.moves
+	p.timer = gc.clock.AfterFunc(max(limit-gc.clock.Now().Sub(p.started), 0), func() {
+		gc.timeout(name, move)
+	})
+}
+
+// Start starts the clock of the player for a move. Does nothing if the
+// clock is already running.
+func (gc *GameClock) Start(name string) error {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	p, ok := gc.players[name]
+	if !ok {
+		return fmt.Errorf("unknown player: %s", name)
+	}
+	if p.running {
+		return nil
+	}
+	p.running, p.started = true, gc.now()
+	p.moves++
+	gc.schedule(name, p)
+	return nil
+}
+
+// Stop stops the clock of the player after a move, and adds the
+// increment to the bank. Reports false if the clock was not running,
+// e.g. the player has already timed out.
+func (gc *GameClock) Stop(name string) bool {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	p, ok := gc.players[name]
+	if !ok || !p.running {
+		return false
+	}
+	gc.stop(p)
+	if gc.config.Bank > 0 {
+		p.bank += gc.config.Increment
+	}
+	return true
+}
+
+// StopAll stops the clocks of all players without increment, e.g. when
+// the game ends.
+func (gc *GameClock) StopAll() {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	for _, p := range gc.players {
+		if p.running {
+			gc.stop(p)
+		}
+	}
+}
+
+// stop stops the running clock of the player, and takes the time spent
+// from the bank. Caller should hold the lock.
+func (gc *GameClock) stop(p *player) {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if gc.config.Bank > 0 {
+		p.bank = max(p.bank-gc.now().Sub(p.started), 0)
+	}
+	p.running = false
+}
+
+// timeout stops the clock of the player and calls the timeout callbacks,
+// unless the clock has been stopped since the move started.
+func (gc *GameClock) timeout(name string, move int) {
+	gc.lock.Lock()
+	p := gc.players[name]
+	if !p.running || p.moves != move || gc.paused {
+		gc.lock.Unlock()
+		return
+	}
+	p.timer = nil
+	gc.stop(p)
+	callbacks := gc.onTimeout
+	gc.lock.Unlock()
+
+	for _, f := range callbacks {
+		f(name)
+	}
+}
+
+// Pause stops the time of all clocks until Resume. Running clocks stay
+// running, but do not time out while paused. Does nothing if the clocks
+// are already paused.
+func (gc *GameClock) Pause() {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	if gc.paused {
+		return
+	}
+	gc.paused, gc.pausedAt = true, gc.clock.Now()
+	for _, p := range gc.players {
+		if p.timer != nil {
+			p.timer.Stop()
+			p.timer = nil
+		}
+	}
+}
+
+// Resume restarts the time of all clocks after Pause, with the time
+// left when paused. Does nothing if the clocks are not paused.
+func (gc *GameClock) Resume() {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	if !gc.paused {
+		return
+	}
+	gc.paused = false
+	pause := gc.clock.Now().Sub(gc.pausedAt)
+	for _, name := range gc.order {
+		p := gc.players[name]
+		if !p.running {
+			continue
+		}
+		p.started = p.started.Add(pause)
+		p.moves++
+		gc.schedule(name, p)
+	}
+}
+
+// Paused reports if the clocks are paused.
+func (gc *GameClock) Paused() bool {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	return gc.paused
+}
+
+// Running reports if the clock of the player is running.
+func (gc *GameClock) Running(name string) bool {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	p, ok := gc.players[name]
+	return ok && p.running
+}
+
+// State returns the state of the clocks of all players.
+func (gc *GameClock) State() State {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	now := gc.now()
+	state := State{Players: make([]PlayerClock, 0, len(gc.order)), Paused: gc.paused}
+	for _, name := range gc.order {
+		p := gc.players[name]
+		pc := PlayerClock{Player: name, Running: p.running}
+		bank := p.bank
+		if p.running {
+			bank = max(bank-now.Sub(p.started), 0)
+		}
+		if limit, ok := gc.limit(p); ok {
+			if p.running {
+				limit = max(limit-now.Sub(p.started), 0)
+			}
+			pc.Remaining = limit.Milliseconds()
+		}
+		if gc.config.Bank > 0 {
+			ms := bank.Milliseconds()
+			pc.Bank = &ms
+		}
+		state.Players = append(state.Players, pc)
+	}
+	return state
+}
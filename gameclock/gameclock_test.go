@@ -0,0 +1,178 @@
+package gameclock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yookoala/botgame-playground/gameclock"
+)
+
+// timeouts records the players timed out.
+func timeouts(gc *gameclock.GameClock) *[]string {
+	players := make([]string, 0)
+	gc.OnTimeout(func(player string) {
+		players = append(players, player)
+	})
+	return &players
+}
+
+func TestGameClock_MoveTime(t *testing.T) {
+	clock := gameclock.NewFakeClock(time.Unix(0, 0))
+	gc := gameclock.New(clock, gameclock.Config{MoveTime: time.Second}, "a", "b")
+	timedOut := timeouts(gc)
+
+	gc.Start("a")
+	gc.Start("b")
+	clock.Advance(900 * time.Millisecond)
+	if !gc.Stop("a") {
+		t.Errorf("expected a to stop in time")
+	}
+	clock.Advance(100 * time.Millisecond)
+	if want, have := []string{"b"}, *timedOut; len(have) != 1 || want[0] != have[0] {
+		t.Errorf("unexpected timeouts. want %#v, have %#v", want, have)
+	}
+	if gc.Stop("b") {
+		t.Errorf("expected b not running after timeout")
+	}
+
+	// The move time is reset for every move.
+	gc.Start("a")
+	clock.Advance(900 * time.Millisecond)
+	if !gc.Stop("a") {
+		t.Errorf("expected a to stop in time")
+	}
+	if want, have := 0, clock.Pending(); want != have {
+		t.Errorf("unexpected pending timers. want %d, have %d", want, have)
+	}
+}
+
+func TestGameClock_Bank(t *testing.T) {
+	clock := gameclock.NewFakeClock(time.Unix(0, 0))
+	gc := gameclock.New(clock, gameclock.Config{
+		MoveTime:  3 * time.Second,
+		Bank:      5 * time.Second,
+		Increment: time.Second,
+	}, "a", "b")
+	timedOut := timeouts(gc)
+
+	gc.Start("a")
+	clock.Advance(2 * time.Second)
+	state := gc.State()
+	if want, have := int64(1000), state.Players[0].Remaining; want != have {
+		t.Errorf("unexpected remaining move time. want %d, have %d", want, have)
+	}
+	if want, have := int64(3000), *state.Players[0].Bank; want != have {
+		t.Errorf("unexpected bank. want %d, have %d", want, have)
+	}
+	gc.Stop("a")
+	if want, have := int64(4000), *gc.State().Players[0].Bank; want != have {
+		t.Errorf("unexpected bank after increment. want %d, have %d", want, have)
+	}
+
+	// Spend the bank within the move time.
+	for i := 0; i < 2; i++ {
+		gc.Start("a")
+		clock.Advance(2 * time.Second)
+		gc.Stop("a")
+	}
+	if want, have := int64(2000), *gc.State().Players[0].Bank; want != have {
+		t.Errorf("unexpected bank. want %d, have %d", want, have)
+	}
+	if want, have := int64(2000), gc.State().Players[0].Remaining; want != have {
+		t.Errorf("unexpected remaining move time. want %d, have %d", want, have)
+	}
+
+	// The move is limited by the bank.
+	gc.Start("a")
+	clock.Advance(2 * time.Second)
+	if want, have := []string{"a"}, *timedOut; len(have) != 1 || want[0] != have[0] {
+		t.Errorf("unexpected timeouts. want %#v, have %#v", want, have)
+	}
+	if want, have := int64(0), *gc.State().Players[0].Bank; want != have {
+		t.Errorf("unexpected bank. want %d, have %d", want, have)
+	}
+
+	// Player b is untouched.
+	if want, have := int64(5000), *gc.State().Players[1].Bank; want != have {
+		t.Errorf("unexpected bank of b. want %d, have %d", want, have)
+	}
+}
+
+func TestGameClock_Disabled(t *testing.T) {
+	clock := gameclock.NewFakeClock(time.Unix(0, 0))
+	gc := gameclock.New(clock, gameclock.Config{}, "a")
+	timedOut := timeouts(gc)
+	gc.Start("a")
+	clock.Advance(time.Hour)
+	if len(*timedOut) != 0 {
+		t.Errorf("unexpected timeouts: %#v", *timedOut)
+	}
+	if !gc.Stop("a") {
+		t.Errorf("expected a to stop in time")
+	}
+	if err := gc.Start("c"); err == nil {
+		t.Errorf("expected error starting unknown player")
+	}
+}
+
+func TestGameClock_Pause(t *testing.T) {
+	clock := gameclock.NewFakeClock(time.Unix(0, 0))
+	gc := gameclock.New(clock, gameclock.Config{
+		MoveTime: 3 * time.Second,
+		Bank:     5 * time.Second,
+	}, "a", "b")
+	timedOut := timeouts(gc)
+
+	gc.Start("a")
+	clock.Advance(2 * time.Second)
+	gc.Pause()
+	gc.Start("b")
+
+	// No time is spent while paused.
+	clock.Advance(time.Hour)
+	if len(*timedOut) != 0 {
+		t.Errorf("unexpected timeouts while paused: %#v", *timedOut)
+	}
+	state := gc.State()
+	if !state.Paused {
+		t.Errorf("expected clocks to be paused")
+	}
+	if want, have := int64(1000), state.Players[0].Remaining; want != have {
+		t.Errorf("unexpected remaining move time. want %d, have %d", want, have)
+	}
+	if want, have := int64(3000), *state.Players[0].Bank; want != have {
+		t.Errorf("unexpected bank. want %d, have %d", want, have)
+	}
+	if want, have := int64(3000), state.Players[1].Remaining; want != have {
+		t.Errorf("unexpected remaining move time of b. want %d, have %d", want, have)
+	}
+
+	// The clocks go on with the time left when paused.
+	gc.Resume()
+	clock.Advance(900 * time.Millisecond)
+	if len(*timedOut) != 0 {
+		t.Errorf("unexpected timeouts: %#v", *timedOut)
+	}
+	clock.Advance(100 * time.Millisecond)
+	if want, have := []string{"a"}, *timedOut; len(have) != 1 || want[0] != have[0] {
+		t.Errorf("unexpected timeouts. want %#v, have %#v", want, have)
+	}
+	if !gc.Stop("b") {
+		t.Errorf("expected b to stop in time")
+	}
+	if want, have := int64(4000), *gc.State().Players[1].Bank; want != have {
+		t.Errorf("unexpected bank of b. want %d, have %d", want, have)
+	}
+	if want, have := 0, clock.Pending(); want != have {
+		t.Errorf("unexpected pending timers. want %d, have %d", want, have)
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	if a, err := gameclock.ParseAction("skip"); err != nil || a != gameclock.ActionSkip {
+		t.Errorf("unexpected result: %#v, %v", a, err)
+	}
+	if _, err := gameclock.ParseAction("resign"); err == nil {
+		t.Errorf("expected error parsing unknown action")
+	}
+}
@@ -0,0 +1,40 @@
+package ratings
+
+import "math"
+
+// EloInitialRating is the rating of a new player in Elo.
+const EloInitialRating = 1500
+
+// Elo is the Elo rating system.
+//
+// Implements System interface.
+type Elo struct {
+	// K is the maximum change of rating by a game.
+	K float64
+}
+
+// NewElo creates an Elo rating system with the K-factor.
+func NewElo(k float64) *Elo {
+	return &Elo{K: k}
+}
+
+// Initial returns the rating of a new player.
+func (e *Elo) Initial() Rating {
+	return Rating{Value: EloInitialRating}
+}
+
+// Expected returns the expected score of a player of rating a against
+// a player of rating b.
+func (e *Elo) Expected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// Rate returns the new rating of a player after the games. All games
+// are rated against the rating before the period.
+func (e *Elo) Rate(r Rating, games []Game) Rating {
+	delta := 0.0
+	for _, g := range games {
+		delta += e.K * (g.Score - e.Expected(r.Value, g.Opponent.Value))
+	}
+	return Rating{Value: r.Value + delta}
+}
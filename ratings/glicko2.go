@@ -0,0 +1,122 @@
+package ratings
+
+import "math"
+
+// Default ratings of a new player in Glicko-2.
+const (
+	Glicko2InitialRating     = 1500
+	Glicko2InitialDeviation  = 350
+	Glicko2InitialVolatility = 0.06
+)
+
+// glicko2Scale converts between the Glicko and the Glicko-2 scale.
+const glicko2Scale = 173.7178
+
+// glicko2Epsilon is the convergence tolerance of the volatility.
+const glicko2Epsilon = 0.000001
+
+// Glicko2 is the Glicko-2 rating system by Mark E. Glickman.
+// See http://www.glicko.net/glicko/glicko2.pdf
+//
+// Implements System interface.
+type Glicko2 struct {
+	// Tau constrains the change in volatility over time. Reasonable
+	// choices are between 0.3 and 1.2.
+	Tau float64
+}
+
+// NewGlicko2 creates a Glicko-2 rating system with the system constant tau.
+func NewGlicko2(tau float64) *Glicko2 {
+	return &Glicko2{Tau: tau}
+}
+
+// Initial returns the rating of a new player.
+func (g2 *Glicko2) Initial() Rating {
+	return Rating{
+		Value:      Glicko2InitialRating,
+		Deviation:  Glicko2InitialDeviation,
+		Volatility: Glicko2InitialVolatility,
+	}
+}
+
+// glicko2G is the g function of Glicko-2.
+func glicko2G(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+// glicko2E is the E function of Glicko-2.
+func glicko2E(mu, muj, phij float64) float64 {
+	return 1 / (1 + math.Exp(-glicko2G(phij)*(mu-muj)))
+}
+
+// Rate returns the new rating of a player after the games in a rating
+// period. If there is no game, only the deviation increases.
+func (g2 *Glicko2) Rate(r Rating, games []Game) Rating {
+	// Step 2: convert to the Glicko-2 scale.
+	mu := (r.Value - Glicko2InitialRating) / glicko2Scale
+	phi := r.Deviation / glicko2Scale
+	sigma := r.Volatility
+
+	if len(games) == 0 {
+		return Rating{
+			Value:      r.Value,
+			Deviation:  math.Sqrt(phi*phi+sigma*sigma) * glicko2Scale,
+			Volatility: sigma,
+		}
+	}
+
+	// Step 3 and 4: estimated variance and improvement.
+	vInv, sum := 0.0, 0.0
+	for _, g := range games {
+		muj := (g.Opponent.Value - Glicko2InitialRating) / glicko2Scale
+		phij := g.Opponent.Deviation / glicko2Scale
+		gj, ej := glicko2G(phij), glicko2E(mu, muj, phij)
+		vInv += gj * gj * ej * (1 - ej)
+		sum += gj * (g.Score - ej)
+	}
+	v := 1 / vInv
+	delta := v * sum
+
+	// Step 5: new volatility, by the Illinois algorithm.
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(g2.Tau*g2.Tau)
+	}
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*g2.Tau) < 0 {
+			k++
+		}
+		B = a - k*g2.Tau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glicko2Epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA = fA / 2
+		}
+		B, fB = C, fC
+	}
+	sigma = math.Exp(A / 2)
+
+	// Step 6 and 7: new deviation and rating.
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu = mu + phi*phi*sum
+
+	// Step 8: convert back to the original scale.
+	return Rating{
+		Value:      mu*glicko2Scale + Glicko2InitialRating,
+		Deviation:  phi * glicko2Scale,
+		Volatility: sigma,
+	}
+}
@@ -0,0 +1,170 @@
+package ratings
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/yookoala/botgame-playground/comms"
+)
+
+// GameResult is the data of a "game:result" event of a finished game.
+type GameResult struct {
+	// Players are the session IDs of the players.
+	Players []string `json:"players"`
+
+	// Winner is the session ID of the winner. Empty for a draw.
+	Winner string `json:"winner"`
+}
+
+// Standing is the standing of a player in the leaderboard.
+type Standing struct {
+	Rank     int    `json:"rank"`
+	Identity string `json:"identity"`
+	Record
+}
+
+// Ladder keeps the records of players in the store, and updates them
+// with match results. Every match is a rating period of its own.
+//
+// Ladder handles the "leaderboard" request, which data is an optional
+// {"limit": 10}, and responds with the standings.
+//
+// Implements comms.MessageHandler interface.
+type Ladder struct {
+	system  System
+	store   Store
+	records map[string]Record
+	lock    *sync.RWMutex
+}
+
+// NewLadder creates a new Ladder and loads records from the store.
+func NewLadder(system System, store Store) (*Ladder, error) {
+	records, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading ratings: %w", err)
+	}
+	return &Ladder{
+		system:  system,
+		store:   store,
+		records: records,
+		lock:    &sync.RWMutex{},
+	}, nil
+}
+
+// Get returns the record of the player. New players have the initial
+// rating of the rating system.
+func (l *Ladder) Get(identity string) Record {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.get(identity)
+}
+
+// get returns the record of the player. Caller should hold the lock.
+func (l *Ladder) get(identity string) Record {
+	if r, ok := l.records[identity]; ok {
+		return r
+	}
+	return Record{Rating: l.system.Initial()}
+}
+
+// RecordMatch updates the records of both players with the match
+// result, then saves the records to the store. Score is the score of
+// player a, i.e. ScoreWin, ScoreDraw or ScoreLoss.
+func (l *Ladder) RecordMatch(a, b string, score float64) error {
+	if a == b {
+		return fmt.Errorf("player %s cannot play against itself", a)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	ra, rb := l.get(a), l.get(b)
+	ra.Rating, rb.Rating = l.system.Rate(ra.Rating, []Game{{Opponent: rb.Rating, Score: score}}),
+		l.system.Rate(rb.Rating, []Game{{Opponent: ra.Rating, Score: 1 - score}})
+	switch score {
+	case ScoreWin:
+		ra.Wins++
+		rb.Losses++
+	case ScoreLoss:
+		ra.Losses++
+		rb.Wins++
+	default:
+		ra.Draws++
+		rb.Draws++
+	}
+	l.records[a], l.records[b] = ra, rb
+	log.Printf("Ladder recorded match %s vs %s (score=%v): %.1f, %.1f", a, b, score, ra.Value, rb.Value)
+	return l.store.Save(l.records)
+}
+
+// RecordResult records the game result. The identity function resolves
+// the identity of the players from their session IDs. Results with
+// unauthenticated players are not rated.
+func (l *Ladder) RecordResult(res GameResult, identity func(sessionID string) string) error {
+	if len(res.Players) != 2 {
+		return fmt.Errorf("expected 2 players, got %d", len(res.Players))
+	}
+	a, b := identity(res.Players[0]), identity(res.Players[1])
+	if a == "" || b == "" {
+		return fmt.Errorf("result not rated: player not authenticated")
+	}
+	score := ScoreDraw
+	switch res.Winner {
+	case res.Players[0]:
+		score = ScoreWin
+	case res.Players[1]:
+		score = ScoreLoss
+	}
+	return l.RecordMatch(a, b, score)
+}
+
+// Standings returns the standings of all players, ordered by rating.
+func (l *Ladder) Standings() []Standing {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	standings := make([]Standing, 0, len(l.records))
+	for id, r := range l.records {
+		standings = append(standings, Standing{Identity: id, Record: r})
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Value != standings[j].Value {
+			return standings[i].Value > standings[j].Value
+		}
+		return standings[i].Identity < standings[j].Identity
+	})
+	for i := range standings {
+		standings[i].Rank = i + 1
+	}
+	return standings
+}
+
+// HandleMessage responds to the "leaderboard" request with the standings.
+//
+// Implements comms.MessageHandler interface.
+func (l *Ladder) HandleMessage(ctx context.Context, m comms.Message, mw comms.MessageWriter) error {
+	req, ok := m.(comms.Request)
+	if !ok || m.Type() != "request" || req.RequestType() != "leaderboard" {
+		return nil
+	}
+
+	data := struct {
+		Limit int `json:"limit"`
+	}{}
+	req.ReadDataTo(&data)
+	standings := l.Standings()
+	if data.Limit > 0 && data.Limit < len(standings) {
+		standings = standings[:data.Limit]
+	}
+	return mw.WriteMessage(comms.NewResponse(
+		comms.GetSessionID(ctx),
+		req.RequestID(),
+		req.RequestType(),
+		200,
+		"success",
+		standings,
+	))
+}
@@ -0,0 +1,93 @@
+package ratings_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/yookoala/botgame-playground/comms/commstest"
+	"github.com/yookoala/botgame-playground/ratings"
+)
+
+func TestFileStore(t *testing.T) {
+	fs := ratings.NewFileStore(filepath.Join(t.TempDir(), "ratings.json"))
+
+	records, err := fs.Load()
+	if err != nil {
+		t.Fatalf("unexpected error loading missing file: %s", err)
+	}
+	if want, have := 0, len(records); want != have {
+		t.Errorf("unexpected number of records. want %d, have %d", want, have)
+	}
+
+	records["alice"] = ratings.Record{Rating: ratings.Rating{Value: 1516}, Wins: 1}
+	if err := fs.Save(records); err != nil {
+		t.Fatalf("unexpected error saving: %s", err)
+	}
+	records, err = fs.Load()
+	if err != nil {
+		t.Fatalf("unexpected error loading: %s", err)
+	}
+	if want, have := (ratings.Record{Rating: ratings.Rating{Value: 1516}, Wins: 1}), records["alice"]; want != have {
+		t.Errorf("unexpected record. want %#v, have %#v", want, have)
+	}
+}
+
+func TestLadder(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ratings.json")
+	l, err := ratings.NewLadder(ratings.NewElo(32), ratings.NewFileStore(filename))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	identities := map[string]string{"s1": "alice", "s2": "bob", "s3": ""}
+	identity := func(sessionID string) string { return identities[sessionID] }
+	if err := l.RecordResult(ratings.GameResult{Players: []string{"s1", "s2"}, Winner: "s1"}, identity); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := l.RecordResult(ratings.GameResult{Players: []string{"s2", "s1"}}, identity); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := l.RecordResult(ratings.GameResult{Players: []string{"s1", "s3"}, Winner: "s1"}, identity); err == nil {
+		t.Errorf("expected error rating unauthenticated player")
+	}
+
+	alice := l.Get("alice")
+	if want, have := 1, alice.Wins; want != have {
+		t.Errorf("unexpected wins. want %d, have %d", want, have)
+	}
+	if want, have := 1, alice.Draws; want != have {
+		t.Errorf("unexpected draws. want %d, have %d", want, have)
+	}
+	if alice.Value <= 1500 {
+		t.Errorf("expected rating of winner to rise, have %v", alice.Value)
+	}
+
+	// Records are persisted.
+	l, err = ratings.NewLadder(ratings.NewElo(32), ratings.NewFileStore(filename))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want, have := alice, l.Get("alice"); want != have {
+		t.Errorf("unexpected record after reload. want %#v, have %#v", want, have)
+	}
+
+	// Leaderboard request.
+	h := commstest.NewHarness(t, l)
+	c := h.Connect()
+	var standings []ratings.Standing
+	c.ExpectResponseCode(c.Request("leaderboard", nil), 200).ReadDataTo(&standings)
+	if want, have := 2, len(standings); want != have {
+		t.Fatalf("unexpected number of standings. want %d, have %d", want, have)
+	}
+	if want, have := "alice", standings[0].Identity; want != have {
+		t.Errorf("unexpected leader. want %#v, have %#v", want, have)
+	}
+	if want, have := 2, standings[1].Rank; want != have {
+		t.Errorf("unexpected rank. want %d, have %d", want, have)
+	}
+
+	c.ExpectResponseCode(c.Request("leaderboard", map[string]int{"limit": 1}), 200).ReadDataTo(&standings)
+	if want, have := 1, len(standings); want != have {
+		t.Errorf("unexpected number of standings. want %d, have %d", want, have)
+	}
+}
@@ -0,0 +1,42 @@
+// Package ratings ranks bots by their match results, with Elo or
+// Glicko-2 rating systems.
+package ratings
+
+// Scores of a game from the view of a player.
+const (
+	ScoreLoss = 0.0
+	ScoreDraw = 0.5
+	ScoreWin  = 1.0
+)
+
+// Rating is the rating of a player.
+type Rating struct {
+	// Value is the rating value, e.g. 1500.
+	Value float64 `json:"rating"`
+
+	// Deviation is the rating deviation (RD) of Glicko-2. Unused by Elo.
+	Deviation float64 `json:"deviation,omitempty"`
+
+	// Volatility is the rating volatility of Glicko-2. Unused by Elo.
+	Volatility float64 `json:"volatility,omitempty"`
+}
+
+// Game is the result of a game against an opponent.
+type Game struct {
+	// Opponent is the rating of the opponent before the game.
+	Opponent Rating
+
+	// Score is the score of the player, i.e. ScoreWin, ScoreDraw
+	// or ScoreLoss.
+	Score float64
+}
+
+// System is a rating system.
+type System interface {
+	// Initial returns the rating of a new player.
+	Initial() Rating
+
+	// Rate returns the new rating of a player after the games
+	// in a rating period.
+	Rate(r Rating, games []Game) Rating
+}
@@ -0,0 +1,91 @@
+package ratings_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/yookoala/botgame-playground/ratings"
+)
+
+// near reports if a and b are equal within the tolerance.
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestElo(t *testing.T) {
+	elo := ratings.NewElo(32)
+	if want, have := 1500.0, elo.Initial().Value; want != have {
+		t.Errorf("unexpected initial rating. want %v, have %v", want, have)
+	}
+	if want, have := 0.5, elo.Expected(1500, 1500); want != have {
+		t.Errorf("unexpected expected score. want %v, have %v", want, have)
+	}
+	if want, have := 0.76, elo.Expected(1600, 1400); !near(want, have, 0.01) {
+		t.Errorf("unexpected expected score. want %v, have %v", want, have)
+	}
+
+	tests := []struct {
+		desc  string
+		games []ratings.Game
+		want  float64
+	}{
+		{
+			desc:  "win against equal",
+			games: []ratings.Game{{Opponent: ratings.Rating{Value: 1500}, Score: ratings.ScoreWin}},
+			want:  1516,
+		},
+		{
+			desc:  "draw against equal",
+			games: []ratings.Game{{Opponent: ratings.Rating{Value: 1500}, Score: ratings.ScoreDraw}},
+			want:  1500,
+		},
+		{
+			desc:  "loss against stronger",
+			games: []ratings.Game{{Opponent: ratings.Rating{Value: 1700}, Score: ratings.ScoreLoss}},
+			want:  1492.31,
+		},
+		{
+			desc: "period of games",
+			games: []ratings.Game{
+				{Opponent: ratings.Rating{Value: 1500}, Score: ratings.ScoreWin},
+				{Opponent: ratings.Rating{Value: 1500}, Score: ratings.ScoreLoss},
+			},
+			want: 1500,
+		},
+	}
+	for _, test := range tests {
+		have := elo.Rate(elo.Initial(), test.games)
+		if !near(test.want, have.Value, 0.01) {
+			t.Errorf("%s: unexpected rating. want %v, have %v", test.desc, test.want, have.Value)
+		}
+	}
+}
+
+func TestGlicko2(t *testing.T) {
+	g2 := ratings.NewGlicko2(0.5)
+
+	// Example in Glickman's paper "Example of the Glicko-2 system".
+	have := g2.Rate(ratings.Rating{Value: 1500, Deviation: 200, Volatility: 0.06}, []ratings.Game{
+		{Opponent: ratings.Rating{Value: 1400, Deviation: 30}, Score: ratings.ScoreWin},
+		{Opponent: ratings.Rating{Value: 1550, Deviation: 100}, Score: ratings.ScoreLoss},
+		{Opponent: ratings.Rating{Value: 1700, Deviation: 300}, Score: ratings.ScoreLoss},
+	})
+	if want := 1464.06; !near(want, have.Value, 0.01) {
+		t.Errorf("unexpected rating. want %v, have %v", want, have.Value)
+	}
+	if want := 151.52; !near(want, have.Deviation, 0.01) {
+		t.Errorf("unexpected deviation. want %v, have %v", want, have.Deviation)
+	}
+	if want := 0.05999; !near(want, have.Volatility, 0.00001) {
+		t.Errorf("unexpected volatility. want %v, have %v", want, have.Volatility)
+	}
+
+	// Without games, only the deviation increases.
+	have = g2.Rate(ratings.Rating{Value: 1500, Deviation: 200, Volatility: 0.06}, nil)
+	if want := 1500.0; want != have.Value {
+		t.Errorf("unexpected rating. want %v, have %v", want, have.Value)
+	}
+	if want := math.Sqrt(200*200 + math.Pow(0.06*173.7178, 2)); !near(want, have.Deviation, 0.01) {
+		t.Errorf("unexpected deviation. want %v, have %v", want, have.Deviation)
+	}
+}
@@ -0,0 +1,89 @@
+package ratings
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Record is the rating and the match record of a player.
+type Record struct {
+	Rating
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+	Draws  int `json:"draws"`
+}
+
+// Games returns the number of games played.
+func (r Record) Games() int {
+	return r.Wins + r.Losses + r.Draws
+}
+
+// Store persists the records of players, keyed by identity.
+type Store interface {
+	Load() (map[string]Record, error)
+	Save(records map[string]Record) error
+}
+
+// FileStore stores records in a JSON file.
+//
+// Implements Store interface.
+type FileStore struct {
+	filename string
+	lock     *sync.Mutex
+}
+
+// NewFileStore creates a FileStore of the file. The file is created
+// on first save.
+func NewFileStore(filename string) *FileStore {
+	return &FileStore{
+		filename: filename,
+		lock:     &sync.Mutex{},
+	}
+}
+
+// Load loads records from the file. Returns empty records if the file
+// does not exist.
+func (fs *FileStore) Load() (map[string]Record, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	records := make(map[string]Record)
+	b, err := os.ReadFile(fs.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Save saves records to the file. The file is replaced atomically so
+// it is never left half written.
+func (fs *FileStore) Save(records map[string]Record) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	b, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(fs.filename), filepath.Base(fs.filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fs.filename)
+}